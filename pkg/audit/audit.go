@@ -0,0 +1,168 @@
+// Package audit records changes made through the gateway, like property
+// writes and thing definition updates, together with the client that
+// requested them
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Common errors
+var (
+	ErrDisabled = errors.NewWithStatus(http.StatusNotFound, "audit log is disabled")
+)
+
+// Kind describes the kind of change recorded by an audit entry
+type Kind string
+
+// Supported entry kinds
+const (
+	KindSet    = Kind("property.set")
+	KindCreate = Kind("thing.create")
+	KindUpdate = Kind("thing.update")
+	KindDelete = Kind("thing.delete")
+
+	KindGroupCreate = Kind("group.create")
+	KindGroupUpdate = Kind("group.update")
+	KindGroupDelete = Kind("group.delete")
+)
+
+// Entry is a single audit log entry
+type Entry struct {
+	// ID uniquely identifies the entry
+	ID string `json:"id"`
+
+	// Timestamp holds the time the change has been requested
+	Timestamp time.Time `json:"timestamp"`
+
+	// Kind describes the change
+	Kind Kind `json:"kind"`
+
+	// Principal holds the subject of the authenticated client, if any
+	Principal string `json:"principal,omitempty"`
+
+	// RemoteAddr holds the address of the client, if any
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// ThingID holds the ID of the affected thing
+	ThingID string `json:"thingID,omitempty"`
+
+	// GroupID holds the ID of the affected group, if any
+	GroupID string `json:"groupID,omitempty"`
+
+	// PropertyID holds the ID of the affected property, if any
+	PropertyID string `json:"propertyID,omitempty"`
+
+	// OldValue holds the property value, thing or group definition before
+	// the change
+	OldValue interface{} `json:"oldValue,omitempty"`
+
+	// NewValue holds the requested property value, thing or group definition
+	NewValue interface{} `json:"newValue,omitempty"`
+
+	// Success is true if the change has been applied
+	Success bool `json:"success"`
+
+	// Error holds the error message if the change failed
+	Error string `json:"error,omitempty"`
+}
+
+// Sink stores audit entries
+type Sink interface {
+	// Record stores entry
+	Record(ctx context.Context, entry *Entry) error
+
+	// Query returns all entries matching filter, newest first
+	Query(ctx context.Context, filter *Filter) ([]*Entry, error)
+}
+
+// Actor describes the client requesting a change
+type Actor struct {
+	// Principal holds the subject of the authenticated client
+	Principal string
+
+	// RemoteAddr holds the address of the client
+	RemoteAddr string
+}
+
+type actorKey struct{}
+
+// WithActor returns a new context that carries actor. Entries recorded using
+// the returned context are attributed to actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored in ctx
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
+
+// Log records audit entries using a Sink. A nil *Log discards all entries
+type Log struct {
+	sink   Sink
+	logger *logrus.Logger
+}
+
+// New returns a new audit log that stores entries in sink
+func New(sink Sink, logger *logrus.Logger) *Log {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &Log{
+		sink:   sink,
+		logger: logger,
+	}
+}
+
+// Record records a change. The ID, timestamp and actor of entry are set
+// by Record. A non-nil err marks the change as failed. Errors of the sink
+// are logged but not returned so a failing audit log never blocks changes
+func (l *Log) Record(ctx context.Context, entry *Entry, err error) {
+	if l == nil {
+		return
+	}
+
+	entry.ID = newID()
+	entry.Timestamp = time.Now()
+	entry.Success = err == nil
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if actor, ok := ActorFrom(ctx); ok {
+		entry.Principal = actor.Principal
+		entry.RemoteAddr = actor.RemoteAddr
+	}
+
+	// the request context may already be cancelled
+	if recordErr := l.sink.Record(context.Background(), entry); recordErr != nil {
+		l.logger.Errorf("[audit] failed to record %s of %s: %s", entry.Kind, entry.ThingID, recordErr.Error())
+	}
+}
+
+// Query returns all entries matching filter, newest first
+func (l *Log) Query(ctx context.Context, filter *Filter) ([]*Entry, error) {
+	if l == nil {
+		return nil, ErrDisabled
+	}
+
+	return l.sink.Query(ctx, filter)
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
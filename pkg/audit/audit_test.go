@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+)
+
+func testSink(t *testing.T, sink Sink) {
+	l := New(sink, nil)
+	ctx := WithActor(context.Background(), Actor{Principal: "alice", RemoteAddr: "10.0.0.1"})
+
+	l.Record(ctx, &Entry{Kind: KindSet, ThingID: "washer", PropertyID: "on", OldValue: true, NewValue: false}, nil)
+	l.Record(context.Background(), &Entry{Kind: KindSet, ThingID: "lamp", PropertyID: "on", NewValue: true}, errors.New("timeout"))
+	l.Record(ctx, &Entry{Kind: KindDelete, ThingID: "lamp"}, nil)
+
+	all, err := l.Query(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Len(t, all, 3)
+
+	// newest first
+	assert.Equal(t, KindDelete, all[0].Kind)
+	assert.Equal(t, "timeout", all[1].Error)
+	assert.False(t, all[1].Success)
+	assert.Empty(t, all[1].Principal)
+
+	washer, err := l.Query(context.Background(), &Filter{ThingID: "washer"})
+	assert.Nil(t, err)
+	assert.Len(t, washer, 1)
+	assert.Equal(t, "alice", washer[0].Principal)
+	assert.Equal(t, "10.0.0.1", washer[0].RemoteAddr)
+	assert.Equal(t, false, washer[0].NewValue)
+	assert.True(t, washer[0].Success)
+	assert.NotEmpty(t, washer[0].ID)
+
+	byAlice, err := l.Query(context.Background(), &Filter{Principal: "alice", Limit: 1})
+	assert.Nil(t, err)
+	assert.Len(t, byAlice, 1)
+	assert.Equal(t, KindDelete, byAlice[0].Kind)
+
+	sets, err := l.Query(context.Background(), &Filter{Kind: KindSet, Since: time.Now().Add(-time.Minute)})
+	assert.Nil(t, err)
+	assert.Len(t, sets, 2)
+
+	future, err := l.Query(context.Background(), &Filter{Since: time.Now().Add(time.Minute)})
+	assert.Nil(t, err)
+	assert.Len(t, future, 0)
+}
+
+func Test_RegistrySink(t *testing.T) {
+	store, err := registry.Open("memory", "")
+	assert.Nil(t, err)
+
+	testSink(t, NewRegistrySink(store, Retention{}))
+}
+
+func Test_FileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink, err := NewFileSink(filepath.Join(dir, "audit.log"))
+	assert.Nil(t, err)
+
+	testSink(t, sink)
+}
+
+func Test_FilterAccept(t *testing.T) {
+	store, err := registry.Open("memory", "")
+	assert.Nil(t, err)
+
+	l := New(NewRegistrySink(store, Retention{}), nil)
+	for _, id := range []string{"lamp", "washer", "washer", "lamp"} {
+		l.Record(context.Background(), &Entry{Kind: KindSet, ThingID: id}, nil)
+	}
+
+	// rejected entries do not count against the limit
+	entries, err := l.Query(context.Background(), &Filter{
+		Limit:  2,
+		Accept: func(e *Entry) bool { return e.ThingID == "washer" },
+	})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	for _, e := range entries {
+		assert.Equal(t, "washer", e.ThingID)
+	}
+}
+
+func Test_RegistrySinkRetention(t *testing.T) {
+	store, err := registry.Open("memory", "")
+	assert.Nil(t, err)
+
+	sink := NewRegistrySink(store, Retention{MaxEntries: 5})
+	l := New(sink, nil)
+
+	for i := 0; i < 23; i++ {
+		l.Record(context.Background(), &Entry{Kind: KindSet, ThingID: "lamp", NewValue: float64(i)}, nil)
+	}
+
+	entries, err := l.Query(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, 22.0, entries[0].NewValue)
+	assert.Equal(t, 18.0, entries[4].NewValue)
+
+	// the value store is pruned as well
+	values, err := store.ItemValues(context.Background(), RegistryThingID, RegistryItemID)
+	assert.Nil(t, err)
+	stored, err := readEntries(context.Background(), values)
+	assert.Nil(t, err)
+	assert.True(t, len(stored) <= 5+sink.retention.pruneInterval(), "%d entries stored", len(stored))
+
+	// entries older than MaxAge are dropped
+	now := time.Now()
+	old := []*Entry{
+		{ID: "a", Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "b", Timestamp: now.Add(-30 * time.Minute)},
+		{ID: "c", Timestamp: now},
+	}
+	kept := Retention{MaxAge: time.Hour}.apply(old, now)
+	assert.Equal(t, old[1:], kept)
+	assert.Equal(t, old, Retention{}.apply(old, now))
+	assert.Equal(t, old[2:], Retention{MaxEntries: 1, MaxAge: time.Hour}.apply(old, now))
+}
+
+func Test_Open(t *testing.T) {
+	store, err := registry.Open("memory", "")
+	assert.Nil(t, err)
+
+	l, err := Open(nil, store, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+
+	l, err = Open(&Config{}, store, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Retention{MaxEntries: DefaultMaxEntries}, l.sink.(*RegistrySink).retention)
+
+	l, err = Open(&Config{MaxEntries: 10, MaxAge: "24h"}, store, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Retention{MaxEntries: 10, MaxAge: 24 * time.Hour}, l.sink.(*RegistrySink).retention)
+
+	for _, cfg := range []*Config{
+		{MaxEntries: -1},
+		{MaxAge: "soon"},
+		{MaxAge: "-1h"},
+		{Sink: "file"},
+		{Sink: "syslog"},
+	} {
+		_, err := Open(cfg, store, nil)
+		assert.NotNil(t, err, "%+v", cfg)
+	}
+}
+
+func Test_Registry(t *testing.T) {
+	store, err := registry.Open("memory", "")
+	assert.Nil(t, err)
+
+	l := New(NewRegistrySink(store, Retention{}), nil)
+	r := Registry(store, l)
+	ctx := WithActor(context.Background(), Actor{Principal: "bob"})
+
+	assert.Nil(t, r.Create(ctx, &spec.Thing{ID: "washer", Title: "Washer"}))
+	assert.Nil(t, r.Update(ctx, &spec.Thing{ID: "washer", Title: "Washing machine"}))
+	assert.NotNil(t, r.Delete(ctx, "unknown", 0))
+	assert.Nil(t, r.Delete(ctx, "washer", 0))
+
+	entries, err := l.Query(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 4)
+
+	assert.Equal(t, KindDelete, entries[0].Kind)
+	assert.Equal(t, "Washing machine", entries[0].OldValue.(*spec.Thing).Title)
+
+	assert.Equal(t, KindDelete, entries[1].Kind)
+	assert.False(t, entries[1].Success)
+	assert.Nil(t, entries[1].OldValue)
+
+	assert.Equal(t, KindUpdate, entries[2].Kind)
+	assert.Equal(t, "Washer", entries[2].OldValue.(*spec.Thing).Title)
+
+	assert.Equal(t, KindCreate, entries[3].Kind)
+	assert.Equal(t, "bob", entries[3].Principal)
+
+	// a disabled log does not wrap the registry
+	assert.Equal(t, store, Registry(store, nil))
+
+	var disabled *Log
+	disabled.Record(ctx, &Entry{}, nil)
+	_, err = disabled.Query(ctx, nil)
+	assert.Equal(t, ErrDisabled, err)
+}
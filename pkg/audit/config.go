@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultMaxEntries is the number of entries kept by the "registry" sink
+// if MaxEntries is not configured
+const DefaultMaxEntries = 10000
+
+// Config configures the audit log
+type Config struct {
+	// Sink is either "file" or "registry" (default)
+	Sink string `json:"sink,omitempty"`
+
+	// Path holds the path of the JSON lines file for the "file" sink
+	Path string `json:"path,omitempty"`
+
+	// MaxEntries limits the number of entries kept by the "registry" sink.
+	// Defaults to DefaultMaxEntries
+	MaxEntries int `json:"maxEntries,omitempty"`
+
+	// MaxAge may limit the age of entries kept by the "registry" sink as
+	// a duration string like "720h"
+	MaxAge string `json:"maxAge,omitempty"`
+}
+
+// Open returns a new audit log for cfg. If cfg is nil the audit log is
+// disabled and nil is returned
+func Open(cfg *Config, store registry.Registry, logger *logrus.Logger) (*Log, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	switch cfg.Sink {
+	case "", "registry":
+		retention := Retention{
+			MaxEntries: cfg.MaxEntries,
+		}
+
+		if retention.MaxEntries == 0 {
+			retention.MaxEntries = DefaultMaxEntries
+		}
+
+		if retention.MaxEntries < 0 {
+			return nil, fmt.Errorf("audit: invalid maxEntries %d", cfg.MaxEntries)
+		}
+
+		if cfg.MaxAge != "" {
+			d, err := time.ParseDuration(cfg.MaxAge)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("audit: invalid maxAge %q", cfg.MaxAge)
+			}
+			retention.MaxAge = d
+		}
+
+		return New(NewRegistrySink(store, retention), logger), nil
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("audit: missing path for file sink")
+		}
+
+		sink, err := NewFileSink(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return New(sink, logger), nil
+	}
+
+	return nil, fmt.Errorf("audit: unknown sink %q", cfg.Sink)
+}
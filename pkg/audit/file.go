@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends audit entries as JSON lines to a file
+type FileSink struct {
+	l    sync.Mutex
+	path string
+}
+
+// NewFileSink returns a new sink writing to path. The file is created
+// if it does not exist
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return &FileSink{path: path}, nil
+}
+
+// Record implements Sink
+func (s *FileSink) Record(_ context.Context, entry *Entry) error {
+	blob, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(blob, '\n'))
+	return err
+}
+
+// Query implements Sink. It reads the whole file so it should only be
+// used for moderately sized logs
+func (s *FileSink) Query(ctx context.Context, filter *Filter) ([]*Entry, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*Entry
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// skip corrupted lines
+			continue
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter.apply(entries), nil
+}
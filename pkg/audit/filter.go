@@ -0,0 +1,70 @@
+package audit
+
+import "time"
+
+// Filter selects audit entries. Empty fields match all entries
+type Filter struct {
+	ThingID    string
+	GroupID    string
+	PropertyID string
+	Principal  string
+	Kind       Kind
+
+	// Since and Until limit the time range of entries
+	Since time.Time
+	Until time.Time
+
+	// Limit limits the number of entries returned. Zero means no limit
+	Limit int
+
+	// Accept may hold an additional filter that is applied before Limit.
+	// It is used to hide entries the client must not see
+	Accept func(*Entry) bool
+}
+
+// Match returns true if e matches the filter
+func (f *Filter) Match(e *Entry) bool {
+	if f == nil {
+		return true
+	}
+
+	switch {
+	case f.ThingID != "" && f.ThingID != e.ThingID:
+		return false
+	case f.GroupID != "" && f.GroupID != e.GroupID:
+		return false
+	case f.PropertyID != "" && f.PropertyID != e.PropertyID:
+		return false
+	case f.Principal != "" && f.Principal != e.Principal:
+		return false
+	case f.Kind != "" && f.Kind != e.Kind:
+		return false
+	case !f.Since.IsZero() && e.Timestamp.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Timestamp.After(f.Until):
+		return false
+	case f.Accept != nil && !f.Accept(e):
+		return false
+	}
+
+	return true
+}
+
+// apply returns all entries matching f, newest first. entries must be
+// ordered oldest first
+func (f *Filter) apply(entries []*Entry) []*Entry {
+	res := []*Entry{}
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		if !f.Match(entries[idx]) {
+			continue
+		}
+
+		res = append(res, entries[idx])
+
+		if f != nil && f.Limit > 0 && len(res) >= f.Limit {
+			break
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,313 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// Identifiers of the value store used by RegistrySink
+const (
+	RegistryThingID = "$audit"
+	RegistryItemID  = "entries"
+)
+
+// Retention limits the entries kept by a RegistrySink. Zero values do not
+// limit the entries
+type Retention struct {
+	// MaxEntries is the maximum number of entries kept
+	MaxEntries int
+
+	// MaxAge is the maximum age of entries kept
+	MaxAge time.Duration
+}
+
+// pruneInterval returns the number of entries recorded between two
+// retention runs
+func (r Retention) pruneInterval() int {
+	if r.MaxEntries > 0 && r.MaxEntries/10 < 100 {
+		return r.MaxEntries/10 + 1
+	}
+
+	return 100
+}
+
+// apply returns the entries that should be kept. entries must be
+// ordered oldest first
+func (r Retention) apply(entries []*Entry, now time.Time) []*Entry {
+	if r.MaxAge > 0 {
+		cutoff := now.Add(-r.MaxAge)
+		for len(entries) > 0 && entries[0].Timestamp.Before(cutoff) {
+			entries = entries[1:]
+		}
+	}
+
+	if r.MaxEntries > 0 && len(entries) > r.MaxEntries {
+		entries = entries[len(entries)-r.MaxEntries:]
+	}
+
+	return entries
+}
+
+// RegistrySink stores audit entries in a value store of the registry
+// driver. Entries exceeding the retention are removed periodically
+type RegistrySink struct {
+	store     registry.Registry
+	retention Retention
+
+	l sync.Mutex
+	// recorded counts the entries recorded since the last retention run
+	recorded int
+}
+
+// NewRegistrySink returns a new sink storing entries in store
+func NewRegistrySink(store registry.Registry, retention Retention) *RegistrySink {
+	return &RegistrySink{
+		store:     store,
+		retention: retention,
+	}
+}
+
+// Record implements Sink
+func (s *RegistrySink) Record(ctx context.Context, entry *Entry) error {
+	values, err := s.store.ItemValues(ctx, RegistryThingID, RegistryItemID)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	copy := *entry
+	if err := values.Put(ctx, &copy); err != nil {
+		return err
+	}
+
+	s.recorded++
+	if s.recorded < s.retention.pruneInterval() {
+		return nil
+	}
+	s.recorded = 0
+
+	return s.prune(ctx, values)
+}
+
+// prune removes all entries exceeding the retention of s. Value stores
+// cannot delete single values so the remaining entries are written again.
+// The caller must hold s.l
+func (s *RegistrySink) prune(ctx context.Context, values driver.ValueStore) error {
+	if s.retention.MaxEntries <= 0 && s.retention.MaxAge <= 0 {
+		return nil
+	}
+
+	entries, err := readEntries(ctx, values)
+	if err != nil {
+		return err
+	}
+
+	keep := s.retention.apply(entries, time.Now())
+	if len(keep) == len(entries) {
+		return nil
+	}
+
+	if err := values.Clear(ctx); err != nil {
+		return err
+	}
+
+	for _, e := range keep {
+		if err := values.Put(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Query implements Sink
+func (s *RegistrySink) Query(ctx context.Context, filter *Filter) ([]*Entry, error) {
+	values, err := s.store.ItemValues(ctx, RegistryThingID, RegistryItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries kept by prune are written again so the time-range of the
+	// value store does not match the timestamps of the entries
+	entries, err := readEntries(ctx, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return filter.apply(s.retention.apply(entries, time.Now())), nil
+}
+
+// readEntries returns all entries of values, oldest first
+func readEntries(ctx context.Context, values driver.ValueStore) ([]*Entry, error) {
+	ch, err := values.Filter(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for v := range ch {
+		e, err := toEntry(v)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// toEntry converts a value returned by a driver to an entry. Drivers that
+// serialize values may return a generic representation
+func toEntry(v interface{}) (*Entry, error) {
+	if e, ok := v.(*Entry); ok {
+		copy := *e
+		return &copy, nil
+	}
+
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(blob, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// auditedRegistry records all changes to thing and group definitions
+type auditedRegistry struct {
+	registry.Registry
+
+	log *Log
+}
+
+// Registry returns a registry that records all thing and group changes
+// made through r in log
+func Registry(r registry.Registry, log *Log) registry.Registry {
+	if log == nil {
+		return r
+	}
+
+	return &auditedRegistry{
+		Registry: r,
+		log:      log,
+	}
+}
+
+// Create implements registry.Registry
+func (r *auditedRegistry) Create(ctx context.Context, thing *spec.Thing) error {
+	err := r.Registry.Create(ctx, thing)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindCreate,
+		ThingID:  thing.ID,
+		NewValue: thing,
+	}, err)
+
+	return err
+}
+
+// Update implements registry.Registry
+func (r *auditedRegistry) Update(ctx context.Context, thing *spec.Thing) error {
+	old, _ := r.Registry.Get(ctx, thing.ID)
+
+	err := r.Registry.Update(ctx, thing)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindUpdate,
+		ThingID:  thing.ID,
+		OldValue: thingValue(old),
+		NewValue: thing,
+	}, err)
+
+	return err
+}
+
+// Delete implements registry.Registry
+func (r *auditedRegistry) Delete(ctx context.Context, id string, revision uint64) error {
+	old, _ := r.Registry.Get(ctx, id)
+
+	err := r.Registry.Delete(ctx, id, revision)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindDelete,
+		ThingID:  id,
+		OldValue: thingValue(old),
+	}, err)
+
+	return err
+}
+
+// CreateGroup implements registry.Registry
+func (r *auditedRegistry) CreateGroup(ctx context.Context, g *spec.Group) error {
+	err := r.Registry.CreateGroup(ctx, g)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindGroupCreate,
+		GroupID:  g.ID,
+		NewValue: g,
+	}, err)
+
+	return err
+}
+
+// UpdateGroup implements registry.Registry
+func (r *auditedRegistry) UpdateGroup(ctx context.Context, g *spec.Group) error {
+	old, _ := r.Registry.GetGroup(ctx, g.ID)
+
+	err := r.Registry.UpdateGroup(ctx, g)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindGroupUpdate,
+		GroupID:  g.ID,
+		OldValue: groupValue(old),
+		NewValue: g,
+	}, err)
+
+	return err
+}
+
+// DeleteGroup implements registry.Registry
+func (r *auditedRegistry) DeleteGroup(ctx context.Context, id string) error {
+	old, _ := r.Registry.GetGroup(ctx, id)
+
+	err := r.Registry.DeleteGroup(ctx, id)
+
+	r.log.Record(ctx, &Entry{
+		Kind:     KindGroupDelete,
+		GroupID:  id,
+		OldValue: groupValue(old),
+	}, err)
+
+	return err
+}
+
+// groupValue avoids storing typed nil pointers in entries
+func groupValue(g *spec.Group) interface{} {
+	if g == nil {
+		return nil
+	}
+
+	return g
+}
+
+// thingValue avoids storing typed nil pointers in entries
+func thingValue(t *spec.Thing) interface{} {
+	if t == nil {
+		return nil
+	}
+
+	return t
+}
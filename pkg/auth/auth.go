@@ -0,0 +1,143 @@
+// Package auth implements authentication and authorization for the
+// REST API using static API tokens and JSON Web Tokens
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+)
+
+// Common errors
+var (
+	ErrUnauthenticated = errors.NewWithStatus(http.StatusUnauthorized, "authentication required")
+	ErrInvalidToken    = errors.NewWithStatus(http.StatusUnauthorized, "invalid token")
+	ErrForbidden       = errors.NewWithStatus(http.StatusForbidden, "insufficient scope")
+	ErrDisabled        = errors.NewWithStatus(http.StatusNotFound, "authentication is disabled")
+	ErrUnknownToken    = errors.NewWithStatus(http.StatusNotFound, "unknown token")
+	ErrStaticToken     = errors.NewWithStatus(http.StatusBadRequest, "static tokens cannot be deleted")
+	ErrDuplicateToken  = errors.NewWithStatus(http.StatusConflict, "token name already in use")
+	ErrInvalidScope    = errors.NewWithStatus(http.StatusBadRequest, "invalid scope")
+	ErrNotPermitted    = errors.NewWithStatus(http.StatusForbidden, "operation not permitted")
+)
+
+// Scope grants access to a set of API operations
+type Scope string
+
+// Supported scopes. Each scope includes all scopes listed before it
+const (
+	// ScopeRead allows to read things, properties and values
+	ScopeRead = Scope("read")
+
+	// ScopeWrite allows to set property values
+	ScopeWrite = Scope("write")
+
+	// ScopeAdmin allows to manage things and API tokens
+	ScopeAdmin = Scope("admin")
+)
+
+var scopeLevels = map[Scope]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+}
+
+// IsValid returns true if s is a supported scope
+func (s Scope) IsValid() bool {
+	_, ok := scopeLevels[s]
+	return ok
+}
+
+// Includes returns true if s grants everything other grants
+func (s Scope) Includes(other Scope) bool {
+	level, ok := scopeLevels[s]
+	if !ok {
+		return false
+	}
+
+	return level >= scopeLevels[other]
+}
+
+// Subject prefixes identify the source of a principal so API tokens and
+// JWTs with the same name cannot be confused
+const (
+	// SubjectToken prefixes the ID of API tokens
+	SubjectToken = "token:"
+
+	// SubjectJWT prefixes the `sub` claim of JWTs
+	SubjectJWT = "jwt:"
+)
+
+// Principal is an authenticated API client
+type Principal struct {
+	// Subject identifies the client. It holds the token ID for API tokens
+	// prefixed with SubjectToken and the `sub` claim for JWTs prefixed with
+	// SubjectJWT
+	Subject string `json:"subject"`
+
+	// Scopes holds all scopes granted to the client
+	Scopes []Scope `json:"scopes"`
+
+	// TokenID holds the ID of the API token used, if any
+	TokenID string `json:"tokenID,omitempty"`
+}
+
+// HasScope returns true if one of the scopes granted to p includes scope
+func (p *Principal) HasScope(scope Scope) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, s := range p.Scopes {
+		if s.Includes(scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Config configures authentication for the REST API
+type Config struct {
+	// Tokens holds static API tokens
+	Tokens []TokenConfig `json:"tokens,omitempty"`
+
+	// JWT may configure validation of JSON Web Tokens
+	JWT *JWTConfig `json:"jwt,omitempty"`
+
+	// Rules may restrict access to things. If no rules are configured
+	// each principal may access all things as permitted by its scopes
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Enabled returns true if any authentication method is configured
+func (cfg *Config) Enabled() bool {
+	return cfg != nil && (len(cfg.Tokens) > 0 || cfg.JWT != nil)
+}
+
+// TokenConfig configures a static API token
+type TokenConfig struct {
+	// ID identifies the token in rule subjects (`token:<id>`). It defaults
+	// to the name of the token and must be unique
+	ID string `json:"id,omitempty"`
+
+	// Name is a human readable name of the token
+	Name string `json:"name"`
+
+	// Token holds the secret bearer token
+	Token string `json:"token"`
+
+	// Scopes holds all scopes granted to the token
+	Scopes []Scope `json:"scopes"`
+}
+
+// bearerToken returns the token from the Authorization header of r
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[7:])
+}
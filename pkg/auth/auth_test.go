@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/macaron.v1"
+)
+
+func Test_ScopeIncludes(t *testing.T) {
+	cases := []struct {
+		s, o Scope
+		r    bool
+	}{
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeWrite, false},
+		{ScopeWrite, ScopeRead, true},
+		{ScopeWrite, ScopeAdmin, false},
+		{ScopeAdmin, ScopeWrite, true},
+		{Scope("other"), ScopeRead, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.r, c.s.Includes(c.o), "%s includes %s", c.s, c.o)
+	}
+}
+
+func request(token string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func Test_StaticTokens(t *testing.T) {
+	a, err := New(&Config{
+		Tokens: []TokenConfig{
+			{Name: "dashboard", Token: "s3cr3t", Scopes: []Scope{ScopeRead}},
+		},
+	})
+	assert.Nil(t, err)
+	assert.True(t, a.Enabled())
+
+	p, err := a.Authenticate(request("s3cr3t"))
+	assert.Nil(t, err)
+	assert.Equal(t, "token:dashboard", p.Subject)
+	assert.True(t, p.HasScope(ScopeRead))
+	assert.False(t, p.HasScope(ScopeWrite))
+
+	p, err = a.Authenticate(request(""))
+	assert.Nil(t, err)
+	assert.Nil(t, p)
+
+	_, err = a.Authenticate(request("wrong"))
+	assert.Equal(t, ErrInvalidToken, err)
+
+	assert.Equal(t, ErrStaticToken, a.DeleteToken(a.Tokens()[0].ID))
+
+	token, err := a.CreateToken("admin", []Scope{ScopeAdmin})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token.Token)
+
+	p, err = a.Authenticate(request(token.Token))
+	assert.Nil(t, err)
+	assert.True(t, p.HasScope(ScopeWrite))
+
+	for _, listed := range a.Tokens() {
+		assert.Empty(t, listed.Token)
+	}
+
+	assert.Nil(t, a.DeleteToken(token.ID))
+	assert.Equal(t, ErrUnknownToken, a.DeleteToken(token.ID))
+
+	_, err = a.Authenticate(request(token.Token))
+	assert.NotNil(t, err)
+
+	_, err = a.CreateToken("invalid", []Scope{"root"})
+	assert.Equal(t, ErrInvalidScope, err)
+
+	// names of static and created tokens cannot be reused
+	_, err = a.CreateToken("dashboard", []Scope{ScopeRead})
+	assert.Equal(t, ErrDuplicateToken, err)
+
+	_, err = a.CreateToken("backup", []Scope{ScopeRead})
+	assert.Nil(t, err)
+
+	_, err = a.CreateToken("backup", []Scope{ScopeRead})
+	assert.Equal(t, ErrDuplicateToken, err)
+
+	_, err = New(&Config{Tokens: []TokenConfig{{Name: "invalid", Token: "x", Scopes: []Scope{"root"}}}})
+	assert.NotNil(t, err)
+}
+
+func Test_JWT_HS256(t *testing.T) {
+	a, err := New(&Config{
+		JWT: &JWTConfig{
+			Secret:   "secret",
+			Issuer:   "issuer",
+			Audience: "gateway",
+		},
+	})
+	assert.Nil(t, err)
+
+	sign := func(claims jwt.MapClaims, key string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		assert.Nil(t, err)
+		return s
+	}
+
+	valid := jwt.MapClaims{
+		"sub":   "alice",
+		"iss":   "issuer",
+		"aud":   []interface{}{"other", "gateway"},
+		"scope": "openid write",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	p, err := a.Authenticate(request(sign(valid, "secret")))
+	assert.Nil(t, err)
+	assert.Equal(t, "jwt:alice", p.Subject)
+	assert.Equal(t, []Scope{ScopeWrite}, p.Scopes)
+
+	_, err = a.Authenticate(request(sign(valid, "wrong")))
+	assert.NotNil(t, err)
+
+	expired := jwt.MapClaims{"sub": "alice", "iss": "issuer", "aud": "gateway", "exp": time.Now().Add(-time.Hour).Unix()}
+	_, err = a.Authenticate(request(sign(expired, "secret")))
+	assert.NotNil(t, err)
+
+	otherIssuer := jwt.MapClaims{"sub": "alice", "iss": "someone", "aud": "gateway"}
+	_, err = a.Authenticate(request(sign(otherIssuer, "secret")))
+	assert.NotNil(t, err)
+
+	otherAudience := jwt.MapClaims{"sub": "alice", "iss": "issuer", "aud": "other"}
+	_, err = a.Authenticate(request(sign(otherAudience, "secret")))
+	assert.NotNil(t, err)
+}
+
+func Test_JWT_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.Nil(t, err)
+
+	f, err := ioutil.TempFile("", "jwt-*.pem")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	assert.Nil(t, pem.Encode(f, &pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	f.Close()
+
+	a, err := New(&Config{
+		JWT: &JWTConfig{
+			Algorithm:     "RS256",
+			PublicKeyFile: f.Name(),
+			ScopeClaim:    "scopes",
+		},
+	})
+	assert.Nil(t, err)
+
+	claims := jwt.MapClaims{"sub": "bob", "scopes": []interface{}{"admin"}}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	assert.Nil(t, err)
+
+	p, err := a.Authenticate(request(token))
+	assert.Nil(t, err)
+	assert.True(t, p.HasScope(ScopeAdmin))
+
+	// tokens using a symmetric algorithm must be rejected
+	hs, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+	assert.Nil(t, err)
+
+	_, err = a.Authenticate(request(hs))
+	assert.NotNil(t, err)
+}
+
+func Test_Middleware(t *testing.T) {
+	setup := func(cfg *Config) *macaron.Macaron {
+		a, err := New(cfg)
+		assert.Nil(t, err)
+
+		m := macaron.New()
+		m.Use(macaron.Renderer())
+		m.Use(a.Middleware())
+		m.Get("/read", Require(ScopeRead), func() string { return "ok" })
+		m.Get("/admin", Require(ScopeAdmin), func() string { return "ok" })
+		return m
+	}
+
+	cases := []struct {
+		cfg   *Config
+		path  string
+		token string
+		code  int
+	}{
+		{nil, "/admin", "", 200},
+		{&Config{Tokens: []TokenConfig{{Token: "r", Scopes: []Scope{ScopeRead}}}}, "/read", "", 401},
+		{&Config{Tokens: []TokenConfig{{Token: "r", Scopes: []Scope{ScopeRead}}}}, "/read", "wrong", 401},
+		{&Config{Tokens: []TokenConfig{{Token: "r", Scopes: []Scope{ScopeRead}}}}, "/read", "r", 200},
+		{&Config{Tokens: []TokenConfig{{Token: "r", Scopes: []Scope{ScopeRead}}}}, "/admin", "r", 403},
+	}
+
+	for _, c := range cases {
+		req := request(c.token)
+		req.URL.Path = c.path
+
+		rec := httptest.NewRecorder()
+		setup(c.cfg).ServeHTTP(rec, req)
+
+		assert.Equal(t, c.code, rec.Code, "%s with token %q", c.path, c.token)
+		if c.code == 401 {
+			assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
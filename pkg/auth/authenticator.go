@@ -0,0 +1,448 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// Token is an API token
+type Token struct {
+	// ID uniquely identifies the token
+	ID string `json:"id"`
+
+	// Name is a human readable name of the token
+	Name string `json:"name"`
+
+	// Scopes holds all scopes granted to the token
+	Scopes []Scope `json:"scopes"`
+
+	// Static is set to true for tokens from the configuration
+	Static bool `json:"static,omitempty"`
+
+	// Created holds the time the token has been created
+	Created time.Time `json:"created"`
+
+	// Token holds the secret bearer token. It is only set when
+	// a new token is created
+	Token string `json:"token,omitempty"`
+}
+
+// Authenticator authenticates API requests
+type Authenticator struct {
+	enabled bool
+	jwt     *jwtValidator
+	rules   []Rule
+
+	l sync.RWMutex
+	// tokens holds all API tokens indexed by the SHA-256 hash
+	// of the secret
+	tokens map[string]*Token
+}
+
+// New returns a new authenticator for cfg. If cfg does not enable
+// authentication all requests are allowed
+func New(cfg *Config) (*Authenticator, error) {
+	a := &Authenticator{
+		enabled: cfg.Enabled(),
+		tokens:  make(map[string]*Token),
+	}
+
+	if !a.enabled {
+		if cfg != nil && len(cfg.Rules) > 0 {
+			return nil, fmt.Errorf("access rules require tokens or jwt to be configured")
+		}
+
+		return a, nil
+	}
+
+	ids := make(map[string]bool, len(cfg.Tokens))
+	names := make(map[string]bool, len(cfg.Tokens))
+	for idx, t := range cfg.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("token %d: empty token", idx)
+		}
+
+		for _, s := range t.Scopes {
+			if !s.IsValid() {
+				return nil, fmt.Errorf("token %d: invalid scope %q", idx, s)
+			}
+		}
+
+		id := t.ID
+		if id == "" {
+			id = t.Name
+		}
+		if id == "" {
+			id = fmt.Sprintf("static-%d", idx)
+		}
+
+		if ids[id] {
+			return nil, fmt.Errorf("token %d: duplicate id %q", idx, id)
+		}
+		ids[id] = true
+
+		if t.Name != "" {
+			if names[t.Name] {
+				return nil, fmt.Errorf("token %d: duplicate name %q", idx, t.Name)
+			}
+			names[t.Name] = true
+		}
+
+		a.tokens[hashToken(t.Token)] = &Token{
+			ID:      id,
+			Name:    t.Name,
+			Scopes:  t.Scopes,
+			Static:  true,
+			Created: time.Now(),
+		}
+	}
+
+	for idx, r := range cfg.Rules {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", idx, err.Error())
+		}
+
+		// rules must not grant anything to tokens that are created later
+		// using the API under a configured ID
+		for _, s := range r.Subjects {
+			if id := strings.TrimPrefix(s, SubjectToken); id != s && !isPattern(id) && !ids[id] {
+				return nil, fmt.Errorf("rule %d: unknown token %q", idx, id)
+			}
+		}
+	}
+	a.rules = cfg.Rules
+
+	if cfg.JWT != nil {
+		v, err := newJWTValidator(*cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+
+	return a, nil
+}
+
+// Enabled returns true if requests must be authenticated
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Authenticate authenticates r. It returns nil if r does not carry
+// credentials and ErrInvalidToken if the credentials are invalid
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	raw := bearerToken(r)
+	if raw == "" {
+		return nil, nil
+	}
+
+	a.l.RLock()
+	t, ok := a.tokens[hashToken(raw)]
+	a.l.RUnlock()
+
+	if ok {
+		return &Principal{
+			Subject: SubjectToken + t.ID,
+			Scopes:  t.Scopes,
+			TokenID: t.ID,
+		}, nil
+	}
+
+	if a.jwt != nil {
+		p, err := a.jwt.validate(raw)
+		if err != nil {
+			return nil, errors.WrapWithStatus(http.StatusUnauthorized, err)
+		}
+
+		return p, nil
+	}
+
+	return nil, ErrInvalidToken
+}
+
+// Authorize returns true if p may perform op on thing. The principal must
+// be granted the scope required for op and, if access rules are configured,
+// at least one rule must grant op on thing. If authentication is disabled
+// all operations are permitted
+func (a *Authenticator) Authorize(p *Principal, op Operation, thing *spec.Thing) bool {
+	if !a.enabled {
+		return true
+	}
+
+	if !p.HasScope(scopes[op]) {
+		return false
+	}
+
+	if len(a.rules) == 0 {
+		return true
+	}
+
+	for idx := range a.rules {
+		if a.rules[idx].Grants(p, op, thing) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizeRequest checks if the principal of the request may perform
+// op on thing. Things the principal may not read are reported as unknown
+// so their existence is not disclosed
+func (a *Authenticator) AuthorizeRequest(ctx *macaron.Context, op Operation, thing *spec.Thing) error {
+	if !a.enabled {
+		return nil
+	}
+
+	p, _ := PrincipalFrom(ctx)
+	if p == nil {
+		return ErrUnauthenticated
+	}
+
+	if a.Authorize(p, op, thing) {
+		return nil
+	}
+
+	if op != OpRead && a.Authorize(p, OpRead, thing) {
+		return ErrNotPermitted
+	}
+
+	return driver.ErrUnknownThing
+}
+
+// Unrestricted returns true if p is granted the admin scope and, if access
+// rules are configured, at least one rule grants admin on all things to p.
+// Only unrestricted principals may manage API tokens as they could otherwise
+// escalate their privileges
+func (a *Authenticator) Unrestricted(p *Principal) bool {
+	if !a.enabled {
+		return true
+	}
+
+	if !p.HasScope(ScopeAdmin) {
+		return false
+	}
+
+	if len(a.rules) == 0 {
+		return true
+	}
+
+	for idx := range a.rules {
+		if a.rules[idx].grantsAll(p, OpAdmin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizeUnrestricted checks if the principal of the request is
+// unrestricted
+func (a *Authenticator) AuthorizeUnrestricted(ctx *macaron.Context) error {
+	if !a.enabled {
+		return nil
+	}
+
+	p, _ := PrincipalFrom(ctx)
+	if p == nil {
+		return ErrUnauthenticated
+	}
+
+	if !a.Unrestricted(p) {
+		return ErrNotPermitted
+	}
+
+	return nil
+}
+
+// Tokens returns all API tokens sorted by name. The secret is never
+// included
+func (a *Authenticator) Tokens() []Token {
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	tokens := make([]Token, 0, len(a.tokens))
+	for _, t := range a.tokens {
+		tokens = append(tokens, *t)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+
+	return tokens
+}
+
+// CreateToken creates a new API token with the given scopes. The name must
+// not be used by another token. The ID of the token is chosen randomly so
+// access rules for configured tokens never apply to it. The returned token
+// is the only one that carries the secret. Created tokens are only kept in
+// memory and are lost when the gateway restarts
+func (a *Authenticator) CreateToken(name string, scopes []Scope) (*Token, error) {
+	if !a.enabled {
+		return nil, ErrDisabled
+	}
+
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+
+	for _, s := range scopes {
+		if !s.IsValid() {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	// names must not be reused as clients may identify tokens by name
+	for _, t := range a.tokens {
+		if t.Name == name {
+			return nil, ErrDuplicateToken
+		}
+	}
+
+	var id string
+	for id == "" || a.hasTokenID(id) {
+		if id, err = randomHex(8); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &Token{
+		ID:      id,
+		Name:    name,
+		Scopes:  scopes,
+		Created: time.Now(),
+	}
+	a.tokens[hashToken(secret)] = t
+
+	res := *t
+	res.Token = secret
+
+	return &res, nil
+}
+
+// DeleteToken deletes the API token with the given ID. Static tokens cannot
+// be deleted
+func (a *Authenticator) DeleteToken(id string) error {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	for hash, t := range a.tokens {
+		if t.ID != id {
+			continue
+		}
+
+		if t.Static {
+			return ErrStaticToken
+		}
+
+		delete(a.tokens, hash)
+		return nil
+	}
+
+	return ErrUnknownToken
+}
+
+// hasTokenID returns true if a token with the given ID exists. The caller
+// must hold a.l
+func (a *Authenticator) hasTokenID(id string) bool {
+	for _, t := range a.tokens {
+		if t.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Middleware returns a macaron handler that authenticates each request
+// and maps the *Principal. Requests with invalid credentials are rejected
+// with 401. If authentication is disabled nothing is mapped and all
+// requests are allowed by Require
+func (a *Authenticator) Middleware() macaron.Handler {
+	return func(ctx *macaron.Context) {
+		if !a.enabled {
+			return
+		}
+
+		p, err := a.Authenticate(ctx.Req.Request)
+		if err != nil {
+			unauthorized(ctx, err)
+			return
+		}
+
+		ctx.Map(p)
+	}
+}
+
+// Require returns a macaron handler that rejects requests whose principal
+// is not granted scope
+func Require(scope Scope) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		p, ok := PrincipalFrom(ctx)
+		if !ok {
+			// authentication is disabled
+			return
+		}
+
+		if p == nil {
+			unauthorized(ctx, ErrUnauthenticated)
+			return
+		}
+
+		if !p.HasScope(scope) {
+			ctx.JSON(http.StatusForbidden, ErrForbidden)
+		}
+	}
+}
+
+// PrincipalFrom returns the principal mapped by the middleware. The second
+// return value is false if authentication is disabled
+func PrincipalFrom(ctx *macaron.Context) (*Principal, bool) {
+	v := ctx.GetVal(reflect.TypeOf((*Principal)(nil)))
+	if !v.IsValid() {
+		return nil, false
+	}
+
+	return v.Interface().(*Principal), true
+}
+
+func unauthorized(ctx *macaron.Context, err error) {
+	ctx.Resp.Header().Set("WWW-Authenticate", `Bearer realm="webthings-mqtt-gateway"`)
+	ctx.JSON(http.StatusUnauthorized, errors.MayWrap(http.StatusUnauthorized, err))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
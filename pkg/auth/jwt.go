@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// JWTConfig configures validation of JSON Web Tokens. Tokens must be signed
+// using a local secret (HS256) or private key (RS256)
+type JWTConfig struct {
+	// Algorithm is either HS256 (default) or RS256
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Secret holds the shared secret for HS256
+	Secret string `json:"secret,omitempty"`
+
+	// PublicKeyFile holds the path to the PEM encoded public key for RS256
+	PublicKeyFile string `json:"publicKeyFile,omitempty"`
+
+	// Issuer may hold the required value of the `iss` claim
+	Issuer string `json:"issuer,omitempty"`
+
+	// Audience may hold the required value of the `aud` claim
+	Audience string `json:"audience,omitempty"`
+
+	// ScopeClaim holds the name of the claim that contains the granted scopes
+	// either as a space separated string or as a list. Defaults to "scope"
+	ScopeClaim string `json:"scopeClaim,omitempty"`
+}
+
+type jwtValidator struct {
+	cfg    JWTConfig
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+func newJWTValidator(cfg JWTConfig) (*jwtValidator, error) {
+	v := &jwtValidator{cfg: cfg}
+
+	if v.cfg.ScopeClaim == "" {
+		v.cfg.ScopeClaim = "scope"
+	}
+
+	switch cfg.Algorithm {
+	case "", "HS256":
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("jwt: missing secret for HS256")
+		}
+
+		v.method = jwt.SigningMethodHS256
+		v.key = []byte(cfg.Secret)
+	case "RS256":
+		if cfg.PublicKeyFile == "" {
+			return nil, fmt.Errorf("jwt: missing public key file for RS256")
+		}
+
+		blob, err := ioutil.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %s", err.Error())
+		}
+
+		key, err := jwt.ParseRSAPublicKeyFromPEM(blob)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: %s", err.Error())
+		}
+
+		v.method = jwt.SigningMethodRS256
+		v.key = key
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	return v, nil
+}
+
+// validate validates raw and returns the principal described by it's claims
+func (v *jwtValidator) validate(raw string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != v.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+
+		return v.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if v.cfg.Issuer != "" && !claims.VerifyIssuer(v.cfg.Issuer, true) {
+		return nil, fmt.Errorf("invalid issuer")
+	}
+
+	if v.cfg.Audience != "" && !verifyAudience(claims, v.cfg.Audience) {
+		return nil, fmt.Errorf("invalid audience")
+	}
+
+	var values []string
+	switch s := claims[v.cfg.ScopeClaim].(type) {
+	case string:
+		values = strings.Fields(s)
+	case []interface{}:
+		for _, elem := range s {
+			if str, ok := elem.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+
+	// unknown scopes may be used by other services accepting the same
+	// tokens so we just ignore them
+	var scopes []Scope
+	for _, value := range values {
+		if Scope(value).IsValid() {
+			scopes = append(scopes, Scope(value))
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+
+	return &Principal{
+		Subject: SubjectJWT + sub,
+		Scopes:  scopes,
+	}, nil
+}
+
+// verifyAudience checks the `aud` claim which may either be a string or
+// a list of strings
+func verifyAudience(claims jwt.MapClaims, audience string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// Operation is an operation performed on a thing
+type Operation string
+
+// Supported operations. Each operation includes all operations listed
+// before it
+const (
+	// OpRead allows to see a thing and read its property values
+	OpRead = Operation("read")
+
+	// OpSet allows to set property values of a thing
+	OpSet = Operation("set")
+
+	// OpAdmin allows to update and delete a thing
+	OpAdmin = Operation("admin")
+)
+
+// scopes maps each operation to the scope a principal must be granted
+var scopes = map[Operation]Scope{
+	OpRead:  ScopeRead,
+	OpSet:   ScopeWrite,
+	OpAdmin: ScopeAdmin,
+}
+
+// IsValid returns true if op is a supported operation
+func (op Operation) IsValid() bool {
+	_, ok := scopes[op]
+	return ok
+}
+
+// Rule grants operations on a set of things to a set of subjects. Subjects,
+// thing IDs and locations are glob patterns where `*` matches any sequence
+// of characters and `?` matches a single character. Subjects must start with
+// the source of the principal (`token:` followed by the token ID or `jwt:`
+// followed by the `sub` claim) or be `*`. Token subjects that are not
+// patterns must refer to a configured token. A thing is selected by a rule
+// if it matches at least one entry of each non-empty selector
+//
+// Example:
+//
+//		rules:
+//		  - subjects: ["jwt:family-*"]
+//		    types: [Light, OnOffSwitch]
+//		    operations: [set]
+//		  - subjects: ["token:owner"] # token with ID (or name) "owner"
+//		    things: ["*"]
+//		    operations: [admin]
+//
+type Rule struct {
+	// Subjects holds patterns for token IDs prefixed with `token:` or
+	// JWT subjects prefixed with `jwt:` the rule applies to
+	Subjects []string `json:"subjects"`
+
+	// Things may hold patterns for thing IDs
+	Things []string `json:"things,omitempty"`
+
+	// Types may hold @type annotations
+	Types []string `json:"types,omitempty"`
+
+	// Locations may hold patterns for thing locations
+	Locations []string `json:"locations,omitempty"`
+
+	// Operations holds the operations granted by the rule
+	Operations []Operation `json:"operations"`
+}
+
+// Validate checks the rule for errors
+func (r *Rule) Validate() error {
+	if len(r.Subjects) == 0 {
+		return fmt.Errorf("no subjects")
+	}
+
+	for _, s := range r.Subjects {
+		if s != "*" && !strings.HasPrefix(s, SubjectToken) && !strings.HasPrefix(s, SubjectJWT) {
+			return fmt.Errorf("subject %q must start with %q or %q", s, SubjectToken, SubjectJWT)
+		}
+	}
+
+	if len(r.Operations) == 0 {
+		return fmt.Errorf("no operations")
+	}
+
+	for _, op := range r.Operations {
+		if !op.IsValid() {
+			return fmt.Errorf("invalid operation %q", op)
+		}
+	}
+
+	return nil
+}
+
+// Grants returns true if r grants op on thing to p
+func (r *Rule) Grants(p *Principal, op Operation, thing *spec.Thing) bool {
+	if !matchAny(r.Subjects, p.Subject) {
+		return false
+	}
+
+	granted := false
+	for _, o := range r.Operations {
+		if scopes[o].Includes(scopes[op]) {
+			granted = true
+			break
+		}
+	}
+
+	if !granted {
+		return false
+	}
+
+	if len(r.Things) > 0 && !matchAny(r.Things, thing.ID) {
+		return false
+	}
+
+	if len(r.Locations) > 0 && !matchAny(r.Locations, thing.Location) {
+		return false
+	}
+
+	if len(r.Types) > 0 {
+		for _, t := range thing.TypeAnnotation {
+			for _, allowed := range r.Types {
+				if t == allowed {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// grantsAll returns true if r grants op on all things to p
+func (r *Rule) grantsAll(p *Principal, op Operation) bool {
+	if len(r.Types) > 0 {
+		return false
+	}
+
+	if len(r.Things) > 0 && !contains(r.Things, "*") {
+		return false
+	}
+
+	if len(r.Locations) > 0 && !contains(r.Locations, "*") {
+		return false
+	}
+
+	return r.Grants(p, op, &spec.Thing{})
+}
+
+func contains(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if p == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPattern returns true if s contains glob wildcards
+func isPattern(s string) bool {
+	return strings.ContainsAny(s, "*?")
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if glob(p, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// glob reports whether s matches pattern. `*` matches any sequence of
+// characters (including `/`) and `?` matches a single character
+func glob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if pattern == "" {
+				return true
+			}
+
+			for i := 0; i <= len(s); i++ {
+				if glob(pattern, s[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+
+	return s == ""
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Glob(t *testing.T) {
+	cases := []struct {
+		p, s string
+		r    bool
+	}{
+		{"*", "", true},
+		{"*", "living/lamp", true},
+		{"living/*", "living/lamp", true},
+		{"living/*", "kitchen/lamp", false},
+		{"*lamp", "living/lamp", true},
+		{"lamp-?", "lamp-1", true},
+		{"lamp-?", "lamp-10", false},
+		{"paz", "paz", true},
+		{"paz", "pa", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.r, glob(c.p, c.s), "%s matches %s", c.p, c.s)
+	}
+}
+
+func Test_Authorize(t *testing.T) {
+	a, err := New(&Config{
+		Tokens: []TokenConfig{
+			{Name: "family-anna", Token: "anna", Scopes: []Scope{ScopeWrite}},
+			{Name: "owner", Token: "owner", Scopes: []Scope{ScopeAdmin}},
+			{Name: "guest", Token: "guest", Scopes: []Scope{ScopeRead}},
+		},
+		Rules: []Rule{
+			{Subjects: []string{"token:family-*"}, Types: []string{"Light"}, Operations: []Operation{OpSet}},
+			{Subjects: []string{"token:family-*", "token:guest"}, Locations: []string{"living*"}, Operations: []Operation{OpRead}},
+			{Subjects: []string{"token:owner"}, Things: []string{"*"}, Operations: []Operation{OpAdmin}},
+		},
+	})
+	assert.Nil(t, err)
+
+	lamp := &spec.Thing{ID: "lamp", TypeAnnotation: []string{"Light"}, Location: "kitchen"}
+	tv := &spec.Thing{ID: "tv", Location: "living-room"}
+	paz := &spec.Thing{ID: "paz", TypeAnnotation: []string{"BinarySensor"}, Location: "owntracks"}
+
+	anna := &Principal{Subject: "token:family-anna", Scopes: []Scope{ScopeWrite}}
+	owner := &Principal{Subject: "token:owner", Scopes: []Scope{ScopeAdmin}}
+	guest := &Principal{Subject: "token:guest", Scopes: []Scope{ScopeRead}}
+
+	// a JWT with the subject of a token is not granted the rules of the
+	// token
+	impostor := &Principal{Subject: "jwt:owner", Scopes: []Scope{ScopeAdmin}}
+
+	cases := []struct {
+		p  *Principal
+		op Operation
+		t  *spec.Thing
+		r  bool
+	}{
+		{anna, OpRead, lamp, true},
+		{anna, OpSet, lamp, true},
+		{anna, OpAdmin, lamp, false},
+		{anna, OpRead, tv, true},
+		{anna, OpSet, tv, false},
+		{anna, OpRead, paz, false},
+		{guest, OpRead, tv, true},
+		{guest, OpRead, lamp, false},
+		{owner, OpAdmin, paz, true},
+		{impostor, OpAdmin, paz, false},
+		{impostor, OpRead, tv, false},
+		{nil, OpRead, tv, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.r, a.Authorize(c.p, c.op, c.t), "%v %s %s", c.p, c.op, c.t.ID)
+	}
+
+	// scopes still apply even if a rule grants more
+	limited := &Principal{Subject: "token:owner", Scopes: []Scope{ScopeRead}}
+	assert.False(t, a.Authorize(limited, OpSet, paz))
+
+	disabled, err := New(nil)
+	assert.Nil(t, err)
+	assert.True(t, disabled.Authorize(nil, OpAdmin, paz))
+
+	_, err = New(&Config{Rules: []Rule{{Subjects: []string{"*"}, Operations: []Operation{OpRead}}}})
+	assert.NotNil(t, err)
+
+	_, err = New(&Config{
+		Tokens: []TokenConfig{{Name: "x", Token: "x", Scopes: []Scope{ScopeRead}}},
+		Rules:  []Rule{{Subjects: []string{"*"}, Operations: []Operation{"delete"}}},
+	})
+	assert.NotNil(t, err)
+
+	// subjects must name their source
+	for _, subject := range []string{"owner", "*owner", "user:owner"} {
+		_, err = New(&Config{
+			Tokens: []TokenConfig{{Name: "x", Token: "x", Scopes: []Scope{ScopeRead}}},
+			Rules:  []Rule{{Subjects: []string{subject}, Operations: []Operation{OpRead}}},
+		})
+		assert.NotNil(t, err, subject)
+	}
+}
+
+func Test_RuleSubjects(t *testing.T) {
+	a, err := New(&Config{
+		Tokens: []TokenConfig{
+			{ID: "kiosk", Name: "Kitchen kiosk", Token: "kiosk", Scopes: []Scope{ScopeRead}},
+			{Name: "owner", Token: "owner", Scopes: []Scope{ScopeAdmin}},
+		},
+		Rules: []Rule{
+			{Subjects: []string{"token:kiosk", "token:owner"}, Operations: []Operation{OpRead}},
+		},
+	})
+	assert.Nil(t, err)
+
+	// subjects of API tokens hold the ID, not the name
+	p, err := a.Authenticate(request("kiosk"))
+	assert.Nil(t, err)
+	assert.Equal(t, "token:kiosk", p.Subject)
+
+	p, err = a.Authenticate(request("owner"))
+	assert.Nil(t, err)
+	assert.Equal(t, "token:owner", p.Subject)
+
+	cases := []struct {
+		tokens []TokenConfig
+		rules  []Rule
+		valid  bool
+	}{
+		{
+			[]TokenConfig{{Name: "a", Token: "a"}, {Name: "a", Token: "b"}},
+			nil, false,
+		},
+		{
+			[]TokenConfig{{ID: "a", Name: "x", Token: "a"}, {ID: "a", Name: "y", Token: "b"}},
+			nil, false,
+		},
+		{
+			[]TokenConfig{{ID: "a", Name: "x", Token: "a"}, {Name: "a", Token: "b"}},
+			nil, false,
+		},
+		{
+			[]TokenConfig{{Name: "a", Token: "a"}},
+			[]Rule{{Subjects: []string{"token:owner"}, Operations: []Operation{OpRead}}},
+			false,
+		},
+		{
+			[]TokenConfig{{Name: "a", Token: "a"}},
+			[]Rule{{Subjects: []string{"token:a", "token:family-*", "jwt:owner"}, Operations: []Operation{OpRead}}},
+			true,
+		},
+	}
+
+	for idx, c := range cases {
+		_, err := New(&Config{Tokens: c.tokens, Rules: c.rules})
+		assert.Equal(t, c.valid, err == nil, "case %d: %v", idx, err)
+	}
+}
+
+func Test_Unrestricted(t *testing.T) {
+	a, err := New(&Config{
+		Tokens: []TokenConfig{
+			{Name: "owner", Token: "owner", Scopes: []Scope{ScopeAdmin}},
+			{Name: "kitchen", Token: "kitchen", Scopes: []Scope{ScopeAdmin}},
+			{Name: "lights", Token: "lights", Scopes: []Scope{ScopeAdmin}},
+			{Name: "reader", Token: "reader", Scopes: []Scope{ScopeRead}},
+		},
+		Rules: []Rule{
+			{Subjects: []string{"token:owner"}, Things: []string{"*"}, Operations: []Operation{OpAdmin}},
+			{Subjects: []string{"token:kitchen"}, Locations: []string{"kitchen"}, Operations: []Operation{OpAdmin}},
+			{Subjects: []string{"token:lights"}, Types: []string{"Light"}, Operations: []Operation{OpAdmin}},
+			{Subjects: []string{"token:reader"}, Operations: []Operation{OpAdmin}},
+		},
+	})
+	assert.Nil(t, err)
+
+	cases := map[string]bool{
+		"owner":   true,
+		"kitchen": false,
+		"lights":  false,
+		"reader":  false,
+	}
+
+	for token, unrestricted := range cases {
+		p, err := a.Authenticate(request(token))
+		assert.Nil(t, err)
+		assert.Equal(t, unrestricted, a.Unrestricted(p), token)
+	}
+
+	noRules, err := New(&Config{Tokens: []TokenConfig{{Name: "admin", Token: "admin", Scopes: []Scope{ScopeAdmin}}}})
+	assert.Nil(t, err)
+	assert.True(t, noRules.Unrestricted(&Principal{Subject: "token:admin", Scopes: []Scope{ScopeAdmin}}))
+	assert.False(t, noRules.Unrestricted(&Principal{Subject: "token:admin", Scopes: []Scope{ScopeWrite}}))
+}
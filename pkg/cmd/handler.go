@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var handlerTest struct {
+	spec        string
+	payload     string
+	payloadFile string
+	encoding    string
+	topic       string
+}
+
+// HandlerCmd groups sub-commands for working with payload handlers
+var HandlerCmd = &cobra.Command{
+	Use:   "handler",
+	Short: "Work with payload handlers",
+}
+
+// HandlerTestCmd parses a sample payload using a handler specification
+var HandlerTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Parse a sample payload using a handler specification",
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := runHandlerTest()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		if res.Error != "" {
+			fmt.Fprintln(os.Stderr, res.Error)
+			os.Exit(1)
+		}
+
+		out, err := json.MarshalIndent(res.Value, "", "  ")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		fmt.Println(string(out))
+	},
+}
+
+// runHandlerTest loads the handler specification and sample payload
+// configured by the command line flags and runs the handler
+func runHandlerTest() (*payload.TestResult, error) {
+	if handlerTest.spec == "" {
+		return nil, fmt.Errorf("missing --spec")
+	}
+
+	data, err := ioutil.ReadFile(handlerTest.spec)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonBlob, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec payload.HandlerSpec
+	if err := json.Unmarshal(jsonBlob, &spec); err != nil {
+		return nil, err
+	}
+
+	sample := handlerTest.payload
+	if handlerTest.payloadFile != "" {
+		blob, err := ioutil.ReadFile(handlerTest.payloadFile)
+		if err != nil {
+			return nil, err
+		}
+		sample = string(blob)
+	}
+
+	body, err := payload.DecodeSample(sample, handlerTest.encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return spec.Test(payload.NewSampleMessage(body, handlerTest.topic))
+}
+
+func init() {
+	f := HandlerTestCmd.Flags()
+
+	f.StringVar(&handlerTest.spec, "spec", "", "Path to the YAML handler specification")
+	f.StringVar(&handlerTest.payload, "payload", "", "Sample payload")
+	f.StringVar(&handlerTest.payloadFile, "payload-file", "", "Path to a file containing the sample payload")
+	f.StringVar(&handlerTest.encoding, "encoding", "text", "Encoding of the sample payload: text, base64 or hex")
+	f.StringVar(&handlerTest.topic, "topic", "", "Topic the sample payload is received on")
+
+	HandlerCmd.AddCommand(HandlerTestCmd)
+	RootCmd.AddCommand(HandlerCmd)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HandlerTestCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "handler-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	jsonSpec := write("json.yaml", "type: json\npath: \"$.{{index .segments 1}}.Temperature\"\n")
+	binarySpec := write("binary.yaml", "type: binary\nencoding: raw\nformat: i16\nscale: 0.01\n")
+	invalidSpec := write("invalid.yaml", "type: [json\n")
+	payloadFile := write("payload.json", `{"AM2301": {"Temperature": 21.5}}`)
+
+	cases := []struct {
+		spec, payload, payloadFile, encoding, topic string
+
+		value interface{}
+		fail  string
+		err   bool
+	}{
+		{jsonSpec, `{"AM2301": {"Temperature": 20}}`, "", "text", "tele/AM2301/SENSOR", 20.0, "", false},
+		{jsonSpec, "", payloadFile, "text", "tele/AM2301/SENSOR", 21.5, "", false},
+		{jsonSpec, `{}`, "", "text", "tele/AM2301/SENSOR", nil, "child 'AM2301' not found in JSON object at 3", false},
+		{binarySpec, "0b0d", "", "hex", "", 28.29, "", false},
+		{binarySpec, "Cw0=", "", "base64", "", 28.29, "", false},
+		{binarySpec, "0b", "", "rot13", "", nil, "", true},
+		{jsonSpec, "", filepath.Join(dir, "missing"), "text", "", nil, "", true},
+		{invalidSpec, "{}", "", "text", "", nil, "", true},
+		{filepath.Join(dir, "missing.yaml"), "{}", "", "text", "", nil, "", true},
+		{"", "{}", "", "text", "", nil, "", true},
+	}
+
+	for _, c := range cases {
+		handlerTest.spec = c.spec
+		handlerTest.payload = c.payload
+		handlerTest.payloadFile = c.payloadFile
+		handlerTest.encoding = c.encoding
+		handlerTest.topic = c.topic
+
+		res, err := runHandlerTest()
+		if c.err {
+			assert.NotNil(t, err, "%+v", c)
+			continue
+		}
+
+		if !assert.Nil(t, err, "%+v", c) {
+			continue
+		}
+
+		assert.Equal(t, c.fail, res.Error, "%+v", c)
+		if c.fail == "" {
+			assert.InDelta(t, c.value, res.Value, 1e-9, "%+v", c)
+		}
+	}
+}
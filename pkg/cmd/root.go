@@ -12,13 +12,21 @@ import (
 	"github.com/spf13/cobra"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/config"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/openapi"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/routes"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/server"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
 
 	"gopkg.in/macaron.v1"
 
@@ -26,9 +34,15 @@ import (
 	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
 
 	// Import payload handler types
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/binary"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/cbor"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/jq"
 	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/json"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/kv"
 	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/lua"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/msgpack"
 	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/string"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/xml"
 )
 
 var cfg *config.Config
@@ -117,22 +131,78 @@ var RootCmd = &cobra.Command{
 		// TODO(ppacher): setup macaron ourself
 		m := macaron.Classic()
 
-		store, err := registry.Open("memory", "")
+		// observe the duration of all HTTP requests
+		m.Use(metrics.Middleware(routes.Params...))
+
+		drv, err := driver.OpenDriver("memory", "")
 		if err != nil {
 			logger.Fatal(err)
 		}
 
+		store := registry.New(metrics.InstrumentDriver(drv))
+
+		// payload handlers may keep state per thing which becomes stale
+		// once the thing is updated or deleted
+		forget := func(t *spec.Thing) {
+			payload.Forget(t.ID)
+		}
+		store.RegisterUpdatedNotifier(forget)
+		store.RegisterDeletedNotifier(forget)
+
 		// register our API renderer
 		render.Bind(m)
 
-		m.MapTo(store, (*registry.Registry)(nil))
+		auditLog, err := audit.Open(cfg.Audit, store, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		// changes made through the API are recorded in the audit log
+		m.Map(auditLog)
+		m.MapTo(audit.Registry(store, auditLog), (*registry.Registry)(nil))
 
 		// Renderer is required to output JSON files using
 		// ctx.JSON()
 		m.Use(macaron.Renderer())
 
+		authenticator, err := auth.New(cfg.Auth)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if !authenticator.Enabled() {
+			logger.Warn("No authentication configured, the REST API is accessible without credentials")
+		}
+
+		m.Map(authenticator)
+		m.Use(authenticator.Middleware())
+
+		m.Map(metrics.NewExporter(store, cfg.Metrics))
+		m.Map(openapi.NewGenerator(store, authenticator.Enabled()))
+
+		binding := wot.Binding{
+			Bearer: authenticator.Enabled(),
+		}
+		if len(cfg.MQTT.Brokers) > 0 {
+			binding.Broker = wot.BrokerURL(cfg.MQTT.Brokers[0])
+		}
+		m.Map(binding)
+
+		// links returned by the API must be absolute and point to the
+		// gateway even if running behind a reverse proxy
+		proxies, err := baseurl.ParseTrustedProxies(cfg.HTTP.TrustedProxies)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		m.Use(baseurl.Middleware(baseurl.Config{
+			External:       cfg.HTTP.ExternalURL,
+			Prefix:         cfg.HTTP.PathPrefix,
+			TrustedProxies: proxies,
+		}))
+
 		// Install our API routes
-		routes.Install(m)
+		routes.Install(m, cfg.HTTP.PathPrefix)
 
 		opts := mqtt.NewClientOptions()
 		if cfg.MQTT.Username != "" {
@@ -145,6 +215,14 @@ var RootCmd = &cobra.Command{
 
 		opts.SetAutoReconnect(true).SetCleanSession(true).SetClientID(cfg.MQTT.ClientID)
 
+		opts.SetOnConnectHandler(func(mqtt.Client) {
+			metrics.MQTTConnected.Set(1)
+		})
+		opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Errorf("lost connection to MQTT broker: %s", err.Error())
+			metrics.MQTTConnected.Set(0)
+		})
+
 		for _, broker := range cfg.MQTT.Brokers {
 			opts.AddBroker(broker)
 		}
@@ -164,6 +242,7 @@ var RootCmd = &cobra.Command{
 			control.WithLogger(logger),
 			control.WithMQTTClient(cli),
 			control.WithRegistry(store),
+			control.WithAuditLog(auditLog),
 		)
 		if err != nil {
 			logger.Fatal(err)
@@ -193,6 +272,24 @@ var RootCmd = &cobra.Command{
 			}
 		}
 
+		// read group definitions
+		if cfg.GroupsDir != "" {
+			groups, err := config.ReadGroupsFromDirectory(cfg.GroupsDir)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			ctx := context.Background()
+
+			for _, g := range groups {
+				g.ApplyDefaults()
+
+				if err := store.CreateGroup(ctx, g); err != nil {
+					logger.Fatalf("group %s: %s", g.ID, err.Error())
+				}
+			}
+		}
+
 		// Serve ...
 		if err := srv.Listen(m); err != nil {
 			logger.Fatal(err)
@@ -214,6 +311,9 @@ func init() {
 	f.StringVarP(&listener.Address, "listen", "l", "", "Address to listen on")
 	f.StringVar(&listener.TLSKeyPath, "tls-key", "", "Path to TLS private key file (PEM format)")
 	f.StringVar(&listener.TLSCertPath, "tls-cert", "", "Path to TLS certificate file (PEM format)")
+	f.StringVar(&cfg.HTTP.ExternalURL, "external-url", "", "URL under which the gateway is reachable by clients")
+	f.StringVar(&cfg.HTTP.PathPrefix, "path-prefix", "", "Path prefix all routes are mounted under")
+	f.StringSliceVar(&cfg.HTTP.TrustedProxies, "trusted-proxy", []string{}, "IP addresses or CIDR networks of reverse proxies allowed to set X-Forwarded-* headers")
 
 	f.StringSliceVarP(&cfg.MQTT.Brokers, "mqtt", "m", []string{}, "MQTT brokers to connect to")
 	f.StringVar(&cfg.MQTT.ClientID, "client-id", "mqtt-home-controller", "Client ID for MQTT connections")
@@ -221,4 +321,5 @@ func init() {
 	f.StringVarP(&cfg.MQTT.Password, "mqtt-password", "p", "", "Password for MQTT connections")
 
 	f.StringVar(&cfg.ThingsDir, "things", "", "Path to directory containing thing definitions")
+	f.StringVar(&cfg.GroupsDir, "groups", "", "Path to directory containing group definitions")
 }
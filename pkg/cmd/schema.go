@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/schema"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// SchemaCmd prints the JSON schema of thing definition files so it can be
+// used by editors to validate them
+var SchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON schema of thing definition files",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := json.MarshalIndent(schema.Definition(), "", "  ")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		fmt.Println(string(out))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(SchemaCmd)
+}
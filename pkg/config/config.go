@@ -1,5 +1,11 @@
 package config
 
+import (
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+)
+
 // LogLevel specifies the general log level used in mqtt-home-controller
 type LogLevel string
 
@@ -20,11 +26,26 @@ type Config struct {
 	// thing definitions
 	ThingsDir string `json:"things"`
 
+	// GroupsDir may hold a directory path that contains
+	// group definitions
+	GroupsDir string `json:"groups"`
+
 	// HTTP holds the HTTP configuration
 	HTTP HTTP `json:"http"`
 
 	// MQTT should the MQTT connection configurations
 	MQTT MQTT `json:"mqtt"`
+
+	// Auth may configure authentication for the REST API. If not
+	// set, the API is not authenticated
+	Auth *auth.Config `json:"auth,omitempty"`
+
+	// Audit may configure the audit log. If not set, changes are
+	// not recorded
+	Audit *audit.Config `json:"audit,omitempty"`
+
+	// Metrics may configure the /metrics endpoint
+	Metrics *metrics.Config `json:"metrics,omitempty"`
 }
 
 // New returns a new empty configuration. Note that using the empty instance directly
@@ -39,6 +60,26 @@ func (cfg *Config) Merge(other *Config) {
 		cfg.LogLevel = other.LogLevel
 	}
 
+	if cfg.ThingsDir == "" {
+		cfg.ThingsDir = other.ThingsDir
+	}
+
+	if cfg.GroupsDir == "" {
+		cfg.GroupsDir = other.GroupsDir
+	}
+
 	cfg.HTTP.Merge(&other.HTTP)
 	cfg.MQTT.Merge(&other.MQTT)
+
+	if cfg.Auth == nil {
+		cfg.Auth = other.Auth
+	}
+
+	if cfg.Audit == nil {
+		cfg.Audit = other.Audit
+	}
+
+	if cfg.Metrics == nil {
+		cfg.Metrics = other.Metrics
+	}
 }
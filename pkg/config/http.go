@@ -18,6 +18,19 @@ type HTTP struct {
 
 	// Listeners holds a list of HTTP listeners to setup
 	Listeners []server.ListenerConfig `json:"listeners"`
+
+	// ExternalURL may hold the URL under which the gateway is reachable
+	// by clients (including PathPrefix). If not set, it is determined from
+	// each request honouring X-Forwarded-Proto, X-Forwarded-Host and
+	// X-Forwarded-Prefix of TrustedProxies
+	ExternalURL string `json:"externalURL,omitempty"`
+
+	// TrustedProxies holds the IP addresses or CIDR networks of reverse
+	// proxies allowed to set X-Forwarded-* headers
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+
+	// PathPrefix may hold a path prefix all routes are mounted under
+	PathPrefix string `json:"pathPrefix,omitempty"`
 }
 
 func (h HTTP) ListenerConfigs() []server.ListenerConfig {
@@ -45,6 +58,18 @@ func (h HTTP) HasListener() bool {
 }
 
 func (h *HTTP) Merge(other *HTTP) {
+	if h.ExternalURL == "" {
+		h.ExternalURL = other.ExternalURL
+	}
+
+	if h.PathPrefix == "" {
+		h.PathPrefix = other.PathPrefix
+	}
+
+	if len(h.TrustedProxies) == 0 {
+		h.TrustedProxies = other.TrustedProxies
+	}
+
 	if h.HasListener() {
 		return
 	}
@@ -49,3 +49,77 @@ func ReadThingsFromDirectory(dir string) ([]*spec.Thing, error) {
 
 	return things, nil
 }
+
+// GroupFromFile reads a spec.Group definition in YAML format
+// from the given file
+func GroupFromFile(fileName string) (*spec.Group, error) {
+	blob, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var g spec.Group
+	if err := yaml.Unmarshal(blob, &g); err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+// ReadGroupsFromDirectory reads all group definition files from a given
+// directory. Groups are returned in an order they can be created in, that
+// is, parents precede their sub-groups
+func ReadGroupsFromDirectory(dir string) ([]*spec.Group, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []*spec.Group
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		group, err := GroupFromFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file.Name(), err.Error())
+		}
+
+		groups = append(groups, group)
+	}
+
+	return orderGroups(groups), nil
+}
+
+// orderGroups sorts groups so parents precede their sub-groups. Groups
+// nested in themselves are kept and rejected by the registry
+func orderGroups(groups []*spec.Group) []*spec.Group {
+	byID := make(map[string]*spec.Group, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+
+	ordered := make([]*spec.Group, 0, len(groups))
+	visited := make(map[*spec.Group]bool, len(groups))
+
+	var visit func(g *spec.Group)
+	visit = func(g *spec.Group) {
+		if visited[g] {
+			return
+		}
+		visited[g] = true
+
+		if parent, ok := byID[g.Parent]; ok {
+			visit(parent)
+		}
+
+		ordered = append(ordered, g)
+	}
+
+	for _, g := range groups {
+		visit(g)
+	}
+
+	return ordered
+}
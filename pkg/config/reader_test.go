@@ -0,0 +1,39 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OrderGroups(t *testing.T) {
+	groups := orderGroups([]*spec.Group{
+		{ID: "room", Parent: "floor"},
+		{ID: "lights"},
+		{ID: "floor", Parent: "house"},
+		{ID: "garden", Parent: "unknown"},
+		{ID: "house"},
+		{ID: "a", Parent: "b"},
+		{ID: "b", Parent: "a"},
+	})
+
+	var ids []string
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+
+	assert.Equal(t, []string{"house", "floor", "room", "lights", "garden", "b", "a"}, ids)
+}
+
+func Test_ReadGroupsFromDirectory(t *testing.T) {
+	groups, err := ReadGroupsFromDirectory("../../example/groups")
+	assert.Nil(t, err)
+
+	var ids []string
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+
+	assert.Equal(t, []string{"house", "living-room", "switches"}, ids)
+}
@@ -0,0 +1,151 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// PropertyValue is a value that should be set for a property
+type PropertyValue struct {
+	// PropertyID is the ID of the property to set
+	PropertyID string
+
+	// Value is the new value of the property
+	Value interface{}
+}
+
+// SetItems publishes requests to set multiple properties of the thing thingID
+// in the given order. If the set topics of adjacent properties resolve to the
+// same topic and their set payloads are JSON objects with distinct keys, they
+// are merged and published as a single message so the device applies them
+// atomically. Requests that would overwrite a key of a previous one are
+// published separately after it. SetItems returns one error per value. Each
+// request is recorded in the audit log, if any
+func (m *MissionControl) SetItems(ctx context.Context, thingID string, values []PropertyValue) []error {
+	errs := make([]error, len(values))
+	entries := make([]*audit.Entry, len(values))
+
+	for idx, v := range values {
+		entries[idx] = &audit.Entry{
+			Kind:       audit.KindSet,
+			ThingID:    thingID,
+			PropertyID: v.PropertyID,
+			NewValue:   v.Value,
+		}
+	}
+
+	var thing *spec.Thing
+	defer func() {
+		for idx, v := range values {
+			m.audit.Record(ctx, entries[idx], errs[idx])
+
+			thingLabel, propLabel := setRequestLabels(thing, v.PropertyID)
+			metrics.SetRequests.WithLabelValues(thingLabel, propLabel, metrics.Result(errs[idx])).Inc()
+		}
+	}()
+
+	thing, err := m.registry.Get(ctx, thingID)
+	if err != nil {
+		for idx := range errs {
+			errs[idx] = err
+		}
+		return errs
+	}
+
+	requests := make([]*setRequest, len(values))
+	for idx, v := range values {
+		requests[idx], errs[idx] = m.renderSetRequest(ctx, thing, v.PropertyID, v.Value, entries[idx])
+	}
+
+	// publish all requests in order. Adjacent requests are combined as long
+	// as they can be merged without changing the outcome
+	var (
+		run    []int
+		merged map[string]interface{}
+	)
+
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+
+		first := requests[run[0]]
+		payload := first.payload
+
+		if len(run) > 1 {
+			blob, err := json.Marshal(merged)
+			if err != nil {
+				// cannot happen as all values have been decoded from JSON
+				panic(err)
+			}
+
+			m.logger.Debugf("[thing: %s] combined %d set requests for '%s'", thing.ID, len(run), first.topic)
+			payload = string(blob)
+		}
+
+		err := m.publishSetRequest(first.topic, first.encoding, payload)
+		for _, idx := range run {
+			errs[idx] = err
+		}
+
+		run = nil
+	}
+
+	for idx, req := range requests {
+		if errs[idx] != nil {
+			continue
+		}
+
+		obj := jsonObject(req.payload)
+		if len(run) == 0 || !combinable(requests[run[0]], merged, req, obj) {
+			flush()
+			merged = obj
+		} else {
+			for key, value := range obj {
+				merged[key] = value
+			}
+		}
+
+		run = append(run, idx)
+	}
+	flush()
+
+	return errs
+}
+
+// combinable returns true if req with the decoded payload obj can be merged
+// into the combined payload merged of the requests starting with first.
+// Requests are only combined if they use the same topic and encoding, both
+// payloads are JSON objects and no key would be overwritten
+func combinable(first *setRequest, merged map[string]interface{}, req *setRequest, obj map[string]interface{}) bool {
+	if merged == nil || obj == nil {
+		return false
+	}
+
+	if req.topic != first.topic || req.encoding != first.encoding {
+		return false
+	}
+
+	for key := range obj {
+		if _, ok := merged[key]; ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// jsonObject decodes payload as a JSON object. It returns nil if payload is
+// not a JSON object
+func jsonObject(payload string) map[string]interface{} {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &obj); err != nil {
+		return nil
+	}
+
+	return obj
+}
@@ -0,0 +1,149 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// Component status values
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// ComponentHealth describes the state of a single gateway component
+type ComponentHealth struct {
+	// Status is either StatusOK or StatusUnavailable
+	Status string `json:"status"`
+
+	// Error may hold the reason the component is unavailable
+	Error string `json:"error,omitempty"`
+}
+
+// MQTTHealth describes the state of the MQTT connection
+type MQTTHealth struct {
+	ComponentHealth
+
+	// Connected is true if the MQTT client is connected to the broker
+	Connected bool `json:"connected"`
+
+	// LastMessage holds the time the last message has been received
+	LastMessage *time.Time `json:"lastMessage,omitempty"`
+}
+
+// SubscriptionHealth compares the active status topic subscriptions with
+// the ones expected from the thing definitions in the registry
+type SubscriptionHealth struct {
+	ComponentHealth
+
+	// Active holds the number of active status topic subscriptions
+	Active int `json:"active"`
+
+	// Expected holds the number of status topic subscriptions required
+	// by the things in the registry
+	Expected int `json:"expected"`
+
+	// Missing holds the number of expected subscriptions that are
+	// not active
+	Missing int `json:"missing"`
+}
+
+// Health describes the state of mission control and its dependencies
+type Health struct {
+	// Status is StatusOK if all components are available
+	Status string `json:"status"`
+
+	MQTT          MQTTHealth         `json:"mqtt"`
+	Registry      ComponentHealth    `json:"registry"`
+	Subscriptions SubscriptionHealth `json:"subscriptions"`
+}
+
+// Ready returns true if all components are available
+func (h *Health) Ready() bool {
+	return h.Status == StatusOK
+}
+
+// Health checks the state of the MQTT connection, the registry and all status
+// topic subscriptions
+func (m *MissionControl) Health(ctx context.Context) *Health {
+	h := &Health{
+		Status: StatusOK,
+	}
+
+	h.MQTT.Status = StatusOK
+	h.MQTT.Connected = m.client != nil && m.client.IsConnected()
+	if !h.MQTT.Connected {
+		h.MQTT.Status = StatusUnavailable
+		h.MQTT.Error = "not connected"
+	}
+
+	if last, ok := m.lastMessage.Load().(time.Time); ok {
+		h.MQTT.LastMessage = &last
+	}
+
+	h.Registry.Status = StatusOK
+	h.Subscriptions.Status = StatusOK
+
+	things, err := m.registry.All(ctx)
+	if err != nil {
+		h.Registry.Status = StatusUnavailable
+		h.Registry.Error = err.Error()
+
+		h.Subscriptions.Status = StatusUnavailable
+		h.Subscriptions.Error = "registry unavailable"
+	} else {
+		expected := expectedFilters(things)
+
+		m.subscriptionsLock.RLock()
+		h.Subscriptions.Active = len(m.subscriptions)
+		for filter := range expected {
+			if _, ok := m.subscriptions[filter]; !ok {
+				h.Subscriptions.Missing++
+			}
+		}
+		m.subscriptionsLock.RUnlock()
+
+		h.Subscriptions.Expected = len(expected)
+		if h.Subscriptions.Missing > 0 {
+			h.Subscriptions.Status = StatusUnavailable
+			h.Subscriptions.Error = "missing status topic subscriptions"
+		}
+	}
+
+	for _, status := range []string{h.MQTT.Status, h.Registry.Status, h.Subscriptions.Status} {
+		if status != StatusOK {
+			h.Status = StatusUnavailable
+		}
+	}
+
+	return h
+}
+
+// expectedFilters returns the status topic filters of all thing properties
+func expectedFilters(things []*spec.Thing) map[string]struct{} {
+	filters := make(map[string]struct{})
+
+	for _, t := range things {
+		if t == nil {
+			continue
+		}
+
+		for _, prop := range t.Properties {
+			topic, err := spec.TopicFromTemplate(prop.MQTT.StatusTopic, t, prop)
+			if err != nil {
+				continue
+			}
+
+			pattern, err := spec.ParseTopicPattern(topic)
+			if err != nil {
+				continue
+			}
+
+			filters[pattern.Filter] = struct{}{}
+		}
+	}
+
+	return filters
+}
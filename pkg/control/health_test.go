@@ -0,0 +1,89 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableRegistry is a registry that cannot list its things
+type unavailableRegistry struct {
+	registry.Registry
+}
+
+func (unavailableRegistry) All(context.Context) ([]*spec.Thing, error) {
+	return nil, errors.New("connection refused")
+}
+
+// message is a received MQTT message
+type message struct {
+	topic   string
+	payload []byte
+}
+
+func (message) Duplicate() bool   { return false }
+func (message) Qos() byte         { return 0 }
+func (message) Retained() bool    { return false }
+func (m message) Topic() string   { return m.topic }
+func (message) MessageID() uint16 { return 0 }
+func (m message) Payload() []byte { return m.payload }
+func (message) Ack()              {}
+
+func Test_Health(t *testing.T) {
+	thing := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on": {},
+		},
+	}
+	thing.ApplyDefaults()
+
+	store := registry.New(memory.New())
+	assert.Nil(t, store.Create(context.Background(), thing))
+
+	cli := &fakeClient{}
+	m, err := New(WithMQTTClient(cli), WithRegistry(store))
+	assert.Nil(t, err)
+
+	// status topics are not subscribed yet
+	h := m.Health(context.Background())
+	assert.False(t, h.Ready())
+	assert.Equal(t, StatusOK, h.MQTT.Status)
+	assert.Equal(t, StatusOK, h.Registry.Status)
+	assert.Equal(t, StatusUnavailable, h.Subscriptions.Status)
+	assert.Equal(t, 1, h.Subscriptions.Expected)
+	assert.Equal(t, 1, h.Subscriptions.Missing)
+
+	// receiving no messages does not affect readiness
+	assert.Nil(t, m.setupThing(thing))
+	h = m.Health(context.Background())
+	assert.True(t, h.Ready())
+	assert.Nil(t, h.MQTT.LastMessage)
+	assert.Equal(t, 0, h.Subscriptions.Missing)
+
+	m.dispatchStatusReport("lamp/status/on", message{"lamp/status/on", []byte("true")})
+	h = m.Health(context.Background())
+	assert.True(t, h.Ready())
+	assert.NotNil(t, h.MQTT.LastMessage)
+
+	cli.disconnected = true
+	h = m.Health(context.Background())
+	assert.False(t, h.Ready())
+	assert.False(t, h.MQTT.Connected)
+	assert.Equal(t, StatusUnavailable, h.MQTT.Status)
+	assert.Equal(t, StatusOK, h.Registry.Status)
+	cli.disconnected = false
+
+	m.registry = unavailableRegistry{store}
+	h = m.Health(context.Background())
+	assert.False(t, h.Ready())
+	assert.Equal(t, StatusOK, h.MQTT.Status)
+	assert.Equal(t, StatusUnavailable, h.Registry.Status)
+	assert.Equal(t, "connection refused", h.Registry.Error)
+	assert.Equal(t, StatusUnavailable, h.Subscriptions.Status)
+}
@@ -2,10 +2,17 @@ package control
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
 
@@ -18,12 +25,56 @@ type MissionControl struct {
 	wg       sync.WaitGroup
 	registry registry.Registry
 	logger   *logrus.Logger
+	audit    *audit.Log
+
+	// subscriptions holds all property status listeners indexed by the
+	// MQTT topic filter they are subscribed to. Multiple properties may
+	// share the same subscription
+	subscriptionsLock sync.RWMutex
+	subscriptions     map[string][]*statusListener
+
+	// pending holds subscriptions that are in progress indexed by the
+	// topic filter. It is protected by subscriptionsLock
+	pending map[string]*pendingSubscription
+
+	// connections holds the connection topic subscribed for each thing
+	// indexed by thing ID. It is protected by subscriptionsLock
+	connections map[string]string
+
+	// lastMessage holds the time.Time the last MQTT message has been
+	// received
+	lastMessage atomic.Value
+}
+
+// statusListener is a thing property that receives status reports from
+// a (possibly shared) MQTT subscription
+type statusListener struct {
+	thing   *spec.Thing
+	prop    *spec.Property
+	pattern *spec.TopicPattern
+}
+
+// pendingSubscription is a status topic subscription that is in progress.
+// Listeners added while subscribing must wait for it to complete
+type pendingSubscription struct {
+	done      chan struct{}
+	err       error
+	listeners []*statusListener
+}
+
+// wait blocks until the subscription completed and returns it's error
+func (p *pendingSubscription) wait() error {
+	<-p.done
+	return p.err
 }
 
 // New creates and initializes a new MissionControl
 func New(opts ...Option) (*MissionControl, error) {
 	m := &MissionControl{
-		logger: logrus.New(),
+		logger:        logrus.New(),
+		subscriptions: make(map[string][]*statusListener),
+		pending:       make(map[string]*pendingSubscription),
+		connections:   make(map[string]string),
 	}
 
 	for _, opt := range opts {
@@ -62,13 +113,8 @@ func (m *MissionControl) Run(ctx context.Context) error {
 	})
 
 	m.registry.RegisterUpdatedNotifier(func(t *spec.Thing) {
-		if err := m.cleanupThing(t); err != nil {
-			m.logger.Errorf("[thing: %s] failed to cleanup thing (updated): %s", t.ID, err.Error())
-			// TODO(ppacher): continue or bail out?
-		}
-
-		if err := m.setupThing(t); err != nil {
-			m.logger.Errorf("[thing: %s] failed to setup thing (updated): %s", t.ID, err.Error())
+		if err := m.updateThing(t); err != nil {
+			m.logger.Errorf("[thing: %s] failed to update thing: %s", t.ID, err.Error())
 		}
 	})
 
@@ -80,25 +126,74 @@ func (m *MissionControl) Run(ctx context.Context) error {
 	return ctx.Err()
 }
 
-func (m *MissionControl) SetItem(ctx context.Context, thingID, propID string, payloadValue interface{}) error {
-	thing, err := m.registry.Get(ctx, thingID)
+// SetItem publishes a request to set the property propID of thing thingID
+// to payloadValue. Each request is recorded in the audit log, if any
+func (m *MissionControl) SetItem(ctx context.Context, thingID, propID string, payloadValue interface{}) (err error) {
+	entry := &audit.Entry{
+		Kind:       audit.KindSet,
+		ThingID:    thingID,
+		PropertyID: propID,
+		NewValue:   payloadValue,
+	}
+	var thing *spec.Thing
+	defer func() {
+		m.audit.Record(ctx, entry, err)
+
+		thingLabel, propLabel := setRequestLabels(thing, propID)
+		metrics.SetRequests.WithLabelValues(thingLabel, propLabel, metrics.Result(err)).Inc()
+	}()
+
+	thing, err = m.registry.Get(ctx, thingID)
 	if err != nil {
 		return err
 	}
 
+	req, err := m.renderSetRequest(ctx, thing, propID, payloadValue, entry)
+	if err != nil {
+		return err
+	}
+
+	return m.publishSetRequest(req.topic, req.encoding, req.payload)
+}
+
+// setRequestLabels returns the thing and property label values of the
+// SetRequests metric. IDs that do not exist are reported as metrics.Unknown
+func setRequestLabels(thing *spec.Thing, propID string) (string, string) {
+	if thing == nil {
+		return metrics.Unknown, metrics.Unknown
+	}
+
+	if thing.Property(propID) == nil {
+		return thing.ID, metrics.Unknown
+	}
+
+	return thing.ID, propID
+}
+
+// setRequest is a rendered request to set a property
+type setRequest struct {
+	topic    string
+	payload  string
+	encoding string
+}
+
+// renderSetRequest renders the set topic and payload of the property propID
+// of thing. The current value of the property is stored in entry
+func (m *MissionControl) renderSetRequest(ctx context.Context, thing *spec.Thing, propID string, payloadValue interface{}, entry *audit.Entry) (*setRequest, error) {
 	prop := thing.Property(propID)
 	if prop == nil {
-		return errors.New("unknown item")
+		return nil, errors.New("unknown item")
 	}
 
 	current, _ := m.registry.GetItemValue(ctx, thing.ID, prop.ID)
+	entry.OldValue = current
 
 	payload, err := spec.TopicFromTemplate(prop.MQTT.SetPayload, thing, prop, map[string]interface{}{
 		"value":   payloadValue,
 		"current": current,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	topic, err := spec.TopicFromTemplate(prop.MQTT.SetTopic, thing, prop, map[string]interface{}{
@@ -106,20 +201,50 @@ func (m *MissionControl) SetItem(ctx context.Context, thingID, propID string, pa
 		"current": current,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	m.logger.Debugf("[thing: %s] item %s: set '%s' to '%s'", thing.ID, prop.ID, topic, payload)
 
+	return &setRequest{
+		topic:    topic,
+		payload:  payload,
+		encoding: prop.MQTT.SetEncoding,
+	}, nil
+}
+
+// publishSetRequest encodes payload and publishes it to topic
+func (m *MissionControl) publishSetRequest(topic, encoding, payload string) error {
+	var body interface{} = payload
+	if encoding != "" {
+		var err error
+		body, err = encodeSetPayload(encoding, payload)
+		if err != nil {
+			return err
+		}
+	}
+
 	// mqtt-smarthome: message published to `set` a new item must not have the
 	// retain flag set
-	if token := m.client.Publish(topic, 0, false, payload); token.Wait() && token.Error() != nil {
+	if token := m.client.Publish(topic, 0, false, body); token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
 
 	return nil
 }
 
+// encodeSetPayload decodes the rendered set payload as JSON and encodes it using
+// the given payload encoding. Payloads that are not valid JSON are encoded as
+// strings
+func encodeSetPayload(encoding string, rendered string) ([]byte, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(rendered), &value); err != nil {
+		value = rendered
+	}
+
+	return payload.Encode(encoding, value)
+}
+
 // setupThing subscribes to various MQTT topics related to the passed
 // thing
 func (m *MissionControl) setupThing(t *spec.Thing) error {
@@ -130,15 +255,10 @@ func (m *MissionControl) setupThing(t *spec.Thing) error {
 		return err
 	}
 
-	handler := func(_ mqtt.Client, msg mqtt.Message) {
-		m.handleThingConnectionUpdate(t, msg)
-	}
-	if token := m.client.Subscribe(connectionTopic, 0, handler); token.Wait() && token.Error() != nil {
-		return token.Error()
+	if err := m.subscribeConnection(t.ID, connectionTopic); err != nil {
+		return err
 	}
 
-	m.logger.Debugf("[thing: %s] subscribed to connection report topic '%s'", t.ID, connectionTopic)
-
 	for _, i := range t.Properties {
 		// TODO(ppacher): cleanup in case of an error
 		if err := m.setupStatusListener(t, i); err != nil {
@@ -161,15 +281,32 @@ func (m *MissionControl) cleanupThing(t *spec.Thing) error {
 		m.logger.Errorf("[thing: %s] failed to generate connection topic: %s", t.ID, err.Error())
 	}
 
-	for _, item := range t.Properties {
-		statusReportTopic, err := spec.TopicFromTemplate(item.MQTT.StatusTopic, t, item)
-		if err != nil {
-			m.logger.Errorf("[thing: %s] item %s failed to generate status report topic: %s", t.ID, item.ID, err.Error())
+	// We remove listeners by thing ID rather than by status topic because t
+	// may already hold the updated thing definition
+	m.subscriptionsLock.Lock()
+	delete(m.connections, t.ID)
+	for filter, listeners := range m.subscriptions {
+		var remaining []*statusListener
+
+		for _, l := range listeners {
+			if l.thing.ID != t.ID {
+				remaining = append(remaining, l)
+			}
+		}
+
+		if len(remaining) == len(listeners) {
 			continue
 		}
 
-		topics = append(topics, statusReportTopic)
+		if len(remaining) > 0 {
+			m.subscriptions[filter] = remaining
+			continue
+		}
+
+		delete(m.subscriptions, filter)
+		topics = append(topics, filter)
 	}
+	m.subscriptionsLock.Unlock()
 
 	if token := m.client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
 		return token.Error()
@@ -178,51 +315,333 @@ func (m *MissionControl) cleanupThing(t *spec.Thing) error {
 	return nil
 }
 
-// setupStatusListener setups the MQTT status report subscription
+// setupStatusListener setups the MQTT status report subscription. If another
+// property already subscribed to the same topic filter the subscription is
+// shared
 func (m *MissionControl) setupStatusListener(t *spec.Thing, prop *spec.Property) error {
 	statusReportTopic, err := spec.TopicFromTemplate(prop.MQTT.StatusTopic, t, prop)
 	if err != nil {
 		return err
 	}
 
-	m.logger.Debugf("[thing: %s] setup status topic subscription for %s", t.ID, statusReportTopic)
+	pattern, err := spec.ParseTopicPattern(statusReportTopic)
+	if err != nil {
+		return err
+	}
+
+	listener := &statusListener{
+		thing:   t,
+		prop:    prop,
+		pattern: pattern,
+	}
+
+	// we must not hold the lock while subscribing as incoming messages
+	// would block the MQTT client from receiving the SUBACK
+	m.subscriptionsLock.Lock()
+	pending, subscribe := m.addListeners(pattern.Filter, listener)
+	m.subscriptionsLock.Unlock()
+
+	if !subscribe {
+		m.logger.Debugf("[thing: %s] item %s: sharing status topic subscription for %s", t.ID, prop.ID, pattern.Filter)
+
+		if pending != nil {
+			return pending.wait()
+		}
+		return nil
+	}
+
+	m.logger.Debugf("[thing: %s] setup status topic subscription for %s", t.ID, pattern.Filter)
+
+	return m.subscribePending(pattern.Filter, pending)
+}
+
+// addListeners adds listeners to the status listeners of filter. If filter
+// is not yet subscribed a new pending subscription is returned and the caller
+// must complete it using subscribePending. Otherwise the subscription that
+// is still in progress, if any, is returned. The caller must hold the
+// subscriptionsLock
+func (m *MissionControl) addListeners(filter string, listeners ...*statusListener) (pending *pendingSubscription, subscribe bool) {
+	existing, exists := m.subscriptions[filter]
+	m.subscriptions[filter] = append(existing, listeners...)
+
+	if pending = m.pending[filter]; pending != nil {
+		pending.listeners = append(pending.listeners, listeners...)
+		return pending, false
+	}
+
+	if exists {
+		return nil, false
+	}
+
+	pending = &pendingSubscription{
+		done:      make(chan struct{}),
+		listeners: listeners,
+	}
+	m.pending[filter] = pending
+
+	return pending, true
+}
+
+// subscribePending subscribes to filter and completes pending. If the
+// subscription fails, all listeners added while subscribing are removed and
+// receive the error
+func (m *MissionControl) subscribePending(filter string, pending *pendingSubscription) error {
+	err := m.subscribeStatus(filter)
+
+	m.subscriptionsLock.Lock()
+	defer m.subscriptionsLock.Unlock()
+
+	delete(m.pending, filter)
+
+	if err != nil {
+		for _, l := range pending.listeners {
+			m.removeListener(filter, l)
+		}
+	}
+
+	pending.err = err
+	close(pending.done)
 
+	return err
+}
+
+// subscribeStatus subscribes to the status report topic filter and dispatches
+// messages to all listeners of filter
+func (m *MissionControl) subscribeStatus(filter string) error {
 	handler := func(cli mqtt.Client, msg mqtt.Message) {
-		m.handleStatusReport(t, prop, msg)
+		m.dispatchStatusReport(filter, msg)
 	}
 
-	if token := m.client.Subscribe(statusReportTopic, 0, handler); token.Wait() && token.Error() != nil {
+	if token := m.client.Subscribe(filter, 0, handler); token.Wait() && token.Error() != nil {
 		return token.Error()
 	}
 
 	return nil
 }
 
-// handleStatusReport handles an MQTT message related to a thing item
-func (m *MissionControl) handleStatusReport(t *spec.Thing, prop *spec.Property, msg mqtt.Message) {
+// subscribeConnection subscribes to the connection report topic of the
+// thing thingID
+func (m *MissionControl) subscribeConnection(thingID, topic string) error {
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		m.handleThingConnectionUpdate(thingID, msg)
+	}
+	if token := m.client.Subscribe(topic, 0, handler); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	m.subscriptionsLock.Lock()
+	m.connections[thingID] = topic
+	m.subscriptionsLock.Unlock()
+
+	m.logger.Debugf("[thing: %s] subscribed to connection report topic '%s'", thingID, topic)
+
+	return nil
+}
+
+// updateThing updates the status listeners of an updated thing. In contrast
+// to cleanupThing and setupThing, only topic filters that are no longer
+// required are unsubscribed and only new ones are subscribed. Listeners of
+// unchanged filters are replaced without touching the MQTT subscription
+func (m *MissionControl) updateThing(t *spec.Thing) error {
+	connectionTopic, err := spec.TopicFromTemplate(t.MQTT.ConnectedTopic, t, nil)
+	if err != nil {
+		return err
+	}
+
+	desired := make(map[string][]*statusListener)
+	for _, prop := range t.Properties {
+		topic, err := spec.TopicFromTemplate(prop.MQTT.StatusTopic, t, prop)
+		if err != nil {
+			return err
+		}
+
+		pattern, err := spec.ParseTopicPattern(topic)
+		if err != nil {
+			return err
+		}
+
+		desired[pattern.Filter] = append(desired[pattern.Filter], &statusListener{
+			thing:   t,
+			prop:    prop,
+			pattern: pattern,
+		})
+	}
+
+	var (
+		unsubscribe []string
+		subscribe   = make(map[string]*pendingSubscription)
+		waiting     []*pendingSubscription
+	)
+
+	m.subscriptionsLock.Lock()
+	for filter, listeners := range m.subscriptions {
+		var remaining []*statusListener
+
+		for _, l := range listeners {
+			if l.thing.ID != t.ID {
+				remaining = append(remaining, l)
+			}
+		}
+
+		if _, ok := desired[filter]; !ok && len(remaining) == 0 {
+			delete(m.subscriptions, filter)
+			unsubscribe = append(unsubscribe, filter)
+			continue
+		}
+
+		m.subscriptions[filter] = remaining
+	}
+
+	// listeners of filters that are already subscribed replace the old
+	// ones without touching the MQTT subscription
+	for filter, listeners := range desired {
+		pending, ok := m.addListeners(filter, listeners...)
+		switch {
+		case ok:
+			subscribe[filter] = pending
+		case pending != nil:
+			waiting = append(waiting, pending)
+		}
+	}
+
+	oldConnectionTopic, hasConnection := m.connections[t.ID]
+	m.subscriptionsLock.Unlock()
+
+	if hasConnection && oldConnectionTopic != connectionTopic {
+		unsubscribe = append(unsubscribe, oldConnectionTopic)
+	}
+
+	if len(unsubscribe) > 0 {
+		m.logger.Debugf("[thing: %s] unsubscribing from %s", t.ID, strings.Join(unsubscribe, ", "))
+
+		if token := m.client.Unsubscribe(unsubscribe...); token.Wait() && token.Error() != nil {
+			m.logger.Errorf("[thing: %s] failed to unsubscribe: %s", t.ID, token.Error())
+		}
+	}
+
+	// all pending subscriptions must be completed even if one of them
+	// fails as other listeners may wait for them
+	var firstErr error
+
+	if !hasConnection || oldConnectionTopic != connectionTopic {
+		firstErr = m.subscribeConnection(t.ID, connectionTopic)
+	}
+
+	for filter, pending := range subscribe {
+		m.logger.Debugf("[thing: %s] setup status topic subscription for %s", t.ID, filter)
+
+		if err := m.subscribePending(filter, pending); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, pending := range waiting {
+		if err := pending.wait(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// removeListener removes l from the listeners of filter. The caller must hold
+// the subscriptionsLock
+func (m *MissionControl) removeListener(filter string, l *statusListener) {
+	listeners := m.subscriptions[filter]
+	for idx, other := range listeners {
+		if other == l {
+			listeners = append(listeners[:idx], listeners[idx+1:]...)
+			break
+		}
+	}
+
+	if len(listeners) == 0 {
+		delete(m.subscriptions, filter)
+		return
+	}
+
+	m.subscriptions[filter] = listeners
+}
+
+// dispatchStatusReport passes msg to all status listeners subscribed to filter
+// whose topic pattern matches the message topic
+func (m *MissionControl) dispatchStatusReport(filter string, msg mqtt.Message) {
 	if msg.Duplicate() {
 		return
 	}
 	defer msg.Ack()
 
-	value, err := prop.MQTT.StatusHandler.Parse(msg.Payload())
+	m.lastMessage.Store(time.Now())
+
+	m.subscriptionsLock.RLock()
+	listeners := append([]*statusListener(nil), m.subscriptions[filter]...)
+	m.subscriptionsLock.RUnlock()
+
+	// each message is counted once for every thing it is dispatched to
+	counted := make(map[string]bool)
+
+	for _, l := range listeners {
+		captures, ok := l.pattern.Match(msg.Topic())
+		if !ok {
+			continue
+		}
+
+		if !counted[l.thing.ID] {
+			counted[l.thing.ID] = true
+			metrics.MessagesReceived.WithLabelValues(l.thing.ID).Inc()
+		}
+
+		m.handleStatusReport(l.thing, l.prop, captures, msg)
+	}
+
+	if len(counted) == 0 {
+		metrics.MessagesReceived.WithLabelValues(metrics.Unknown).Inc()
+	}
+}
+
+// handleStatusReport handles an MQTT message related to a thing item
+func (m *MissionControl) handleStatusReport(t *spec.Thing, prop *spec.Property, captures map[string]string, msg mqtt.Message) {
+	ctx := context.Background()
+	previous, _ := m.registry.GetItemValue(ctx, t.ID, prop.ID)
+
+	metrics.StatusReports.WithLabelValues(t.ID, prop.ID).Inc()
+
+	value, err := prop.MQTT.StatusHandler.ParseMessage(&payload.Message{
+		Payload:    msg.Payload(),
+		Topic:      msg.Topic(),
+		Segments:   strings.Split(msg.Topic(), "/"),
+		Captures:   captures,
+		Retained:   msg.Retained(),
+		QoS:        msg.Qos(),
+		Timestamp:  time.Now(),
+		ThingID:    t.ID,
+		PropertyID: prop.ID,
+		Previous:   previous,
+	})
+	if err == payload.ErrDropped {
+		m.logger.Debugf("[thing: %s] item %s: status report dropped by handler", t.ID, prop.ID)
+		return
+	}
+
 	if err != nil {
 		m.logger.Errorf("[thing: %s] item %s: failed to parse status report: %s", t.ID, prop.ID, err.Error())
+		m.countParseError(t, prop)
 		return
 	}
 
-	m.logger.Infof("[thing: %s] item %s: status report: %v", t.ID, prop.ID, value)
+	value, err = prop.Coerce(t, value)
+	if err != nil {
+		// CoercionError already carries the thing and property ID
+		m.logger.Error(err.Error())
+		m.countParseError(t, prop)
+		return
+	}
 
-	/*
-		if !prop.Kind.IsValidValue(value) {
-			m.logger.Errorf("[thing: %s] item %s: received invalid value for kind %s: %v", t.ID, prop.ID, prop.Kind, value)
-			return
-		}
-	*/
+	m.logger.Infof("[thing: %s] item %s: status report: %v", t.ID, prop.ID, value)
 
-	values, err := m.registry.ItemValues(context.Background(), t.ID, prop.ID)
+	values, err := m.registry.ItemValues(ctx, t.ID, prop.ID)
 	if err == nil {
-		err = values.Put(context.Background(), value)
+		err = values.Put(ctx, value)
 	}
 
 	if err != nil {
@@ -230,12 +649,19 @@ func (m *MissionControl) handleStatusReport(t *spec.Thing, prop *spec.Property,
 	}
 }
 
+// countParseError increments the parse error counter of prop
+func (m *MissionControl) countParseError(t *spec.Thing, prop *spec.Property) {
+	handler, _ := prop.MQTT.StatusHandler["type"].(string)
+	metrics.ParseErrors.WithLabelValues(t.ID, prop.ID, handler).Inc()
+}
+
 // handleThingConnectionUpdate handles a thing connection update
-func (m *MissionControl) handleThingConnectionUpdate(t *spec.Thing, msg mqtt.Message) {
+func (m *MissionControl) handleThingConnectionUpdate(thingID string, msg mqtt.Message) {
 	if msg.Duplicate() {
 		return
 	}
 	defer msg.Ack()
 
-	m.logger.Infof("[thing: %s] connection update", t.ID)
+	m.lastMessage.Store(time.Now())
+	m.logger.Infof("[thing: %s] connection update", thingID)
 }
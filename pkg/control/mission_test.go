@@ -0,0 +1,441 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/string"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// token is a completed mqtt.Token
+type token struct{}
+
+func (token) Wait() bool                     { return true }
+func (token) WaitTimeout(time.Duration) bool { return true }
+func (token) Error() error                   { return nil }
+
+// published is a message published using fakeClient
+type published struct {
+	topic   string
+	payload interface{}
+}
+
+// subscribeToken is the mqtt.Token of a subscription. It completes once
+// gate is closed
+type subscribeToken struct {
+	gate chan struct{}
+	err  error
+}
+
+func (t subscribeToken) Wait() bool {
+	if t.gate != nil {
+		<-t.gate
+	}
+	return true
+}
+
+func (t subscribeToken) WaitTimeout(time.Duration) bool { return t.Wait() }
+func (t subscribeToken) Error() error                   { return t.err }
+
+// fakeClient is a mqtt.Client that records subscriptions and published
+// messages. Subscriptions of filters listed in failing fail and, if gate is
+// set, only complete once it is closed
+type fakeClient struct {
+	l            sync.Mutex
+	disconnected bool
+	subscribed   []string
+	unsubscribed []string
+	published    []published
+	failing      map[string]error
+	gate         chan struct{}
+}
+
+func (c *fakeClient) IsConnected() bool                    { return !c.disconnected }
+func (c *fakeClient) IsConnectionOpen() bool               { return !c.disconnected }
+func (c *fakeClient) Connect() mqtt.Token                  { return token{} }
+func (c *fakeClient) Disconnect(uint)                      {}
+func (c *fakeClient) AddRoute(string, mqtt.MessageHandler) {}
+func (c *fakeClient) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.published = append(c.published, published{topic, payload})
+	return token{}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.subscribed = append(c.subscribed, topic)
+	return subscribeToken{gate: c.gate, err: c.failing[topic]}
+}
+
+func (c *fakeClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	for topic := range filters {
+		c.Subscribe(topic, 0, callback)
+	}
+	return token{}
+}
+
+func (c *fakeClient) Unsubscribe(topics ...string) mqtt.Token {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.unsubscribed = append(c.unsubscribed, topics...)
+	return token{}
+}
+
+// reset clears all recorded subscriptions and returns them sorted
+func (c *fakeClient) reset() (subscribed, unsubscribed []string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	subscribed, unsubscribed = c.subscribed, c.unsubscribed
+	c.subscribed, c.unsubscribed = nil, nil
+
+	sort.Strings(subscribed)
+	sort.Strings(unsubscribed)
+
+	return subscribed, unsubscribed
+}
+
+func Test_UpdateThing(t *testing.T) {
+	cli := &fakeClient{}
+	m, err := New(WithMQTTClient(cli))
+	assert.Nil(t, err)
+
+	thing := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":         {},
+			"brightness": {},
+		},
+	}
+	thing.ApplyDefaults()
+
+	assert.Nil(t, m.setupThing(thing))
+	subscribed, _ := cli.reset()
+	assert.Equal(t, []string{"lamp/connected", "lamp/status/brightness", "lamp/status/on"}, subscribed)
+
+	updated := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":    {Title: "Power"},
+			"color": {},
+		},
+	}
+	updated.ApplyDefaults()
+
+	assert.Nil(t, m.updateThing(updated))
+	subscribed, unsubscribed := cli.reset()
+	assert.Equal(t, []string{"lamp/status/color"}, subscribed)
+	assert.Equal(t, []string{"lamp/status/brightness"}, unsubscribed)
+
+	// listeners of unchanged filters must use the updated definition
+	assert.Equal(t, "Power", m.subscriptions["lamp/status/on"][0].prop.Title)
+
+	updated.MQTT.ConnectedTopic = "lamp/online"
+	assert.Nil(t, m.updateThing(updated))
+	subscribed, unsubscribed = cli.reset()
+	assert.Equal(t, []string{"lamp/online"}, subscribed)
+	assert.Equal(t, []string{"lamp/connected"}, unsubscribed)
+
+	assert.Nil(t, m.cleanupThing(updated))
+	_, unsubscribed = cli.reset()
+	assert.Equal(t, []string{"lamp/online", "lamp/status/color", "lamp/status/on"}, unsubscribed)
+	assert.Empty(t, m.subscriptions)
+	assert.Empty(t, m.connections)
+}
+
+// lampThings returns two things whose properties share the status topic
+// filter home/+/lamp
+func lampThings() (*spec.Thing, *spec.Thing) {
+	shared := spec.MQTTPropertySettings{StatusTopic: "home/+room/lamp"}
+
+	lamp := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":         {MQTT: shared},
+			"brightness": {MQTT: shared},
+		},
+	}
+	lamp.ApplyDefaults()
+
+	desk := &spec.Thing{
+		ID: "desk",
+		Properties: map[string]*spec.Property{
+			"on": {MQTT: shared},
+		},
+	}
+	desk.ApplyDefaults()
+
+	return lamp, desk
+}
+
+func Test_SharedStatusListeners(t *testing.T) {
+	ctx := context.Background()
+	lamp, desk := lampThings()
+
+	store := registry.New(memory.New())
+	assert.Nil(t, store.Create(ctx, lamp))
+	assert.Nil(t, store.Create(ctx, desk))
+
+	cli := &fakeClient{}
+	m, err := New(WithMQTTClient(cli), WithRegistry(store))
+	assert.Nil(t, err)
+
+	// one subscription is shared by all properties
+	assert.Nil(t, m.setupThing(lamp))
+	assert.Nil(t, m.setupThing(desk))
+	subscribed, _ := cli.reset()
+	assert.Equal(t, []string{"desk/connected", "home/+/lamp", "lamp/connected"}, subscribed)
+	assert.Len(t, m.subscriptions["home/+/lamp"], 3)
+
+	// a single message is dispatched to all of them
+	m.dispatchStatusReport("home/+/lamp", message{"home/kitchen/lamp", []byte("ON")})
+	for _, item := range [][2]string{{"lamp", "on"}, {"lamp", "brightness"}, {"desk", "on"}} {
+		value, err := store.GetItemValue(ctx, item[0], item[1])
+		assert.Nil(t, err, item)
+		assert.Equal(t, "ON", value, item)
+	}
+
+	// only changed filters are re-subscribed while shared ones are kept
+	updated := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":    {MQTT: spec.MQTTPropertySettings{StatusTopic: "home/+room/lamp"}},
+			"color": {MQTT: spec.MQTTPropertySettings{StatusTopic: "lamp/color"}},
+		},
+	}
+	updated.ApplyDefaults()
+
+	assert.Nil(t, m.updateThing(updated))
+	subscribed, unsubscribed := cli.reset()
+	assert.Equal(t, []string{"lamp/color"}, subscribed)
+	assert.Empty(t, unsubscribed)
+	assert.Len(t, m.subscriptions["home/+/lamp"], 2)
+
+	// moving the last property of a thing off a shared filter keeps the
+	// subscription for the other thing
+	updated.Properties["on"].MQTT.StatusTopic = "lamp/on"
+	assert.Nil(t, m.updateThing(updated))
+	subscribed, unsubscribed = cli.reset()
+	assert.Equal(t, []string{"lamp/on"}, subscribed)
+	assert.Empty(t, unsubscribed)
+	assert.Len(t, m.subscriptions["home/+/lamp"], 1)
+
+	assert.Nil(t, m.cleanupThing(desk))
+	_, unsubscribed = cli.reset()
+	assert.Equal(t, []string{"desk/connected", "home/+/lamp"}, unsubscribed)
+
+	assert.Nil(t, m.cleanupThing(updated))
+	_, unsubscribed = cli.reset()
+	assert.Equal(t, []string{"lamp/color", "lamp/connected", "lamp/on"}, unsubscribed)
+	assert.Empty(t, m.subscriptions)
+}
+
+func Test_PendingSubscriptionFails(t *testing.T) {
+	lamp, desk := lampThings()
+
+	cli := &fakeClient{
+		gate:    make(chan struct{}),
+		failing: map[string]error{"home/+/lamp": errors.New("not authorized")},
+	}
+	m, err := New(WithMQTTClient(cli))
+	assert.Nil(t, err)
+
+	pending := func() int {
+		m.subscriptionsLock.RLock()
+		defer m.subscriptionsLock.RUnlock()
+
+		if p := m.pending["home/+/lamp"]; p != nil {
+			return len(p.listeners)
+		}
+		return 0
+	}
+
+	errs := make(chan error, 3)
+	go func() { errs <- m.setupStatusListener(lamp, lamp.Properties["on"]) }()
+	assert.Eventually(t, func() bool { return pending() == 1 }, time.Second, time.Millisecond)
+
+	// properties joining while the first subscription is in progress
+	// receive it's error
+	go func() { errs <- m.setupStatusListener(desk, desk.Properties["on"]) }()
+	go func() { errs <- m.updateThing(lamp) }()
+	assert.Eventually(t, func() bool { return pending() == 4 }, time.Second, time.Millisecond)
+
+	close(cli.gate)
+	for i := 0; i < 3; i++ {
+		assert.EqualError(t, <-errs, "not authorized")
+	}
+
+	m.subscriptionsLock.RLock()
+	assert.Empty(t, m.subscriptions["home/+/lamp"])
+	assert.Empty(t, m.pending)
+	m.subscriptionsLock.RUnlock()
+
+	// the next listener subscribes again
+	cli.failing = nil
+	cli.reset()
+	assert.Nil(t, m.setupStatusListener(desk, desk.Properties["on"]))
+	subscribed, _ := cli.reset()
+	assert.Equal(t, []string{"home/+/lamp"}, subscribed)
+}
+
+func Test_SetItems(t *testing.T) {
+	cli := &fakeClient{}
+	store := registry.New(memory.New())
+	m, err := New(WithMQTTClient(cli), WithRegistry(store))
+	assert.Nil(t, err)
+
+	thing := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":         {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: `{"state": {{.value}}}`}},
+			"brightness": {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: `{"brightness": {{.value}}}`}},
+			"color":      {},
+			"name":       {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: "{{.value}}"}},
+		},
+	}
+	thing.ApplyDefaults()
+	assert.Nil(t, store.Create(context.Background(), thing))
+
+	errs := m.SetItems(context.Background(), "lamp", []PropertyValue{
+		{"color", `"red"`},
+		{"on", true},
+		{"unknown", 1},
+		{"brightness", 50},
+	})
+	assert.Len(t, errs, 4)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.NotNil(t, errs[2])
+	assert.Nil(t, errs[3])
+
+	assert.Equal(t, []published{
+		{"lamp/set/color", `"red"`},
+		{"lamp/set", `{"brightness":50,"state":true}`},
+	}, cli.published)
+
+	// payloads that are not JSON objects are published one by one
+	cli.published = nil
+	errs = m.SetItems(context.Background(), "lamp", []PropertyValue{
+		{"brightness", 10},
+		{"name", "kitchen"},
+	})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []published{
+		{"lamp/set", `{"brightness": 10}`},
+		{"lamp/set", "kitchen"},
+	}, cli.published)
+
+	errs = m.SetItems(context.Background(), "unknown", []PropertyValue{{"on", true}})
+	assert.NotNil(t, errs[0])
+}
+
+func Test_SetItemsOrder(t *testing.T) {
+	cli := &fakeClient{}
+	store := registry.New(memory.New())
+	m, err := New(WithMQTTClient(cli), WithRegistry(store))
+	assert.Nil(t, err)
+
+	thing := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on":         {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: `{"state": {{.value}}}`}},
+			"brightness": {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: `{"brightness": {{.value}}}`}},
+			"toggle":     {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/set", SetPayload: `{"state": "TOGGLE"}`}},
+			"color":      {MQTT: spec.MQTTPropertySettings{SetTopic: "lamp/color/set", SetPayload: `{"color": {{.value}}}`}},
+		},
+	}
+	thing.ApplyDefaults()
+	assert.Nil(t, store.Create(context.Background(), thing))
+
+	cases := []struct {
+		values []PropertyValue
+		want   []published
+	}{
+		{
+			// interleaved topics are published in order
+			[]PropertyValue{{"on", true}, {"color", `"red"`}, {"brightness", 50}},
+			[]published{
+				{"lamp/set", `{"state": true}`},
+				{"lamp/color/set", `{"color": "red"}`},
+				{"lamp/set", `{"brightness": 50}`},
+			},
+		},
+		{
+			// duplicate keys are not merged
+			[]PropertyValue{{"on", false}, {"brightness", 10}, {"toggle", nil}, {"brightness", 20}},
+			[]published{
+				{"lamp/set", `{"brightness":10,"state":false}`},
+				{"lamp/set", `{"brightness":20,"state":"TOGGLE"}`},
+			},
+		},
+		{
+			[]PropertyValue{{"toggle", nil}, {"on", true}},
+			[]published{
+				{"lamp/set", `{"state": "TOGGLE"}`},
+				{"lamp/set", `{"state": true}`},
+			},
+		},
+	}
+
+	for idx, c := range cases {
+		cli.published = nil
+
+		errs := m.SetItems(context.Background(), "lamp", c.values)
+		assert.Equal(t, make([]error, len(c.values)), errs, "case %d", idx)
+		assert.Equal(t, c.want, cli.published, "case %d", idx)
+	}
+}
+
+func Test_SetRequestLabels(t *testing.T) {
+	thing := &spec.Thing{
+		ID: "lamp",
+		Properties: map[string]*spec.Property{
+			"on": {},
+		},
+	}
+
+	cases := []struct {
+		thing *spec.Thing
+		prop  string
+		want  [2]string
+	}{
+		{nil, "on", [2]string{metrics.Unknown, metrics.Unknown}},
+		{thing, "color", [2]string{"lamp", metrics.Unknown}},
+		{thing, "on", [2]string{"lamp", "on"}},
+	}
+
+	for _, c := range cases {
+		thingLabel, propLabel := setRequestLabels(c.thing, c.prop)
+		assert.Equal(t, c.want, [2]string{thingLabel, propLabel}, c.prop)
+	}
+
+	// requests for unknown things must not create new label values
+	m, err := New(WithMQTTClient(&fakeClient{}), WithRegistry(registry.New(memory.New())))
+	assert.Nil(t, err)
+
+	counter := metrics.SetRequests.WithLabelValues(metrics.Unknown, metrics.Unknown, "error")
+	before := testutil.ToFloat64(counter)
+
+	assert.NotNil(t, m.SetItem(context.Background(), "does-not-exist", "on", true))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+}
@@ -2,6 +2,7 @@ package control
 
 import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
 	"github.com/sirupsen/logrus"
 )
@@ -35,3 +36,12 @@ func WithLogger(l *logrus.Logger) Option {
 		return nil
 	}
 }
+
+// WithAuditLog is a MissionControl option that configures the audit
+// log used to record set requests
+func WithAuditLog(l *audit.Log) Option {
+	return func(m *MissionControl) error {
+		m.audit = l
+		return nil
+	}
+}
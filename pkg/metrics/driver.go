@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// InstrumentDriver returns a driver that observes the latency of all
+// operations of d
+func InstrumentDriver(d driver.Driver) driver.Driver {
+	return &instrumentedDriver{d}
+}
+
+func observe(operation string, start time.Time) {
+	DriverLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+type instrumentedDriver struct {
+	drv driver.Driver
+}
+
+func (d *instrumentedDriver) Get(ctx context.Context, id string) (*spec.Thing, error) {
+	defer observe("get", time.Now())
+	return d.drv.Get(ctx, id)
+}
+
+func (d *instrumentedDriver) Set(ctx context.Context, thing *spec.Thing, opts *driver.SetOptions) error {
+	defer observe("set", time.Now())
+	return d.drv.Set(ctx, thing, opts)
+}
+
+func (d *instrumentedDriver) Delete(ctx context.Context, id string, opts *driver.DeleteOptions) (*spec.Thing, error) {
+	defer observe("delete", time.Now())
+	return d.drv.Delete(ctx, id, opts)
+}
+
+func (d *instrumentedDriver) Has(ctx context.Context, id string) (bool, error) {
+	defer observe("has", time.Now())
+	return d.drv.Has(ctx, id)
+}
+
+func (d *instrumentedDriver) IDs(ctx context.Context) ([]string, error) {
+	defer observe("ids", time.Now())
+	return d.drv.IDs(ctx)
+}
+
+// Query implements driver.Querier so queries are pushed down to the
+// instrumented driver if supported
+func (d *instrumentedDriver) Query(ctx context.Context, q *driver.Query) (*driver.Page, error) {
+	defer observe("query", time.Now())
+	return driver.QueryThings(ctx, d.drv, q)
+}
+
+// GetGroup implements driver.GroupDriver
+func (d *instrumentedDriver) GetGroup(ctx context.Context, id string) (*spec.Group, error) {
+	defer observe("group_get", time.Now())
+
+	groups, err := driver.Groups(d.drv)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups.GetGroup(ctx, id)
+}
+
+// SetGroup implements driver.GroupDriver
+func (d *instrumentedDriver) SetGroup(ctx context.Context, g *spec.Group, opts *driver.SetOptions) error {
+	defer observe("group_set", time.Now())
+
+	groups, err := driver.Groups(d.drv)
+	if err != nil {
+		return err
+	}
+
+	return groups.SetGroup(ctx, g, opts)
+}
+
+// DeleteGroup implements driver.GroupDriver
+func (d *instrumentedDriver) DeleteGroup(ctx context.Context, id string, opts *driver.DeleteOptions) (*spec.Group, error) {
+	defer observe("group_delete", time.Now())
+
+	groups, err := driver.Groups(d.drv)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups.DeleteGroup(ctx, id, opts)
+}
+
+// GroupIDs implements driver.GroupDriver
+func (d *instrumentedDriver) GroupIDs(ctx context.Context) ([]string, error) {
+	defer observe("group_ids", time.Now())
+
+	groups, err := driver.Groups(d.drv)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups.GroupIDs(ctx)
+}
+
+func (d *instrumentedDriver) ItemValues(ctx context.Context, thingID, itemID string) (driver.ValueStore, error) {
+	defer observe("item_values", time.Now())
+
+	store, err := d.drv.ItemValues(ctx, thingID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedValueStore{store}, nil
+}
+
+type instrumentedValueStore struct {
+	store driver.ValueStore
+}
+
+func (s *instrumentedValueStore) Put(ctx context.Context, value interface{}) error {
+	defer observe("value_put", time.Now())
+	return s.store.Put(ctx, value)
+}
+
+func (s *instrumentedValueStore) Current(ctx context.Context) (interface{}, error) {
+	defer observe("value_current", time.Now())
+	return s.store.Current(ctx)
+}
+
+func (s *instrumentedValueStore) Filter(ctx context.Context, from, to time.Time) (<-chan interface{}, error) {
+	defer observe("value_filter", time.Now())
+	return s.store.Filter(ctx, from, to)
+}
+
+func (s *instrumentedValueStore) Clear(ctx context.Context) error {
+	defer observe("value_clear", time.Now())
+	return s.store.Clear(ctx)
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// Config configures the metrics endpoint
+type Config struct {
+	// PropertyValues enables exporting numeric and boolean property values
+	// as gauges
+	PropertyValues bool `json:"propertyValues,omitempty"`
+}
+
+var propertyValueDesc = prometheus.NewDesc(
+	namespace+"_property_value",
+	"Current value of numeric and boolean thing properties",
+	[]string{"thing", "property", "type", "unit"},
+	nil,
+)
+
+// Exporter serves gateway metrics and, if enabled, property values
+type Exporter struct {
+	store          registry.Registry
+	propertyValues bool
+}
+
+// NewExporter returns a new exporter for the things in store
+func NewExporter(store registry.Registry, cfg *Config) *Exporter {
+	e := &Exporter{
+		store: store,
+	}
+
+	if cfg != nil {
+		e.propertyValues = cfg.PropertyValues
+	}
+
+	return e
+}
+
+// Handler returns a HTTP handler serving all metrics in the Prometheus text
+// format. Property values are only exported for things accepted by visible
+func (e *Exporter) Handler(visible func(*spec.Thing) bool) http.Handler {
+	gatherers := prometheus.Gatherers{Registry}
+
+	if e.propertyValues {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(&propertyCollector{
+			store:   e.store,
+			visible: visible,
+		})
+
+		gatherers = append(gatherers, reg)
+	}
+
+	return promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
+}
+
+// propertyCollector collects the current values of all numeric and boolean
+// properties
+type propertyCollector struct {
+	store   registry.Registry
+	visible func(*spec.Thing) bool
+}
+
+// Describe implements prometheus.Collector
+func (c *propertyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- propertyValueDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *propertyCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	things, err := c.store.All(ctx)
+	if err != nil {
+		logrus.Errorf("[metrics] failed to load things: %s", err.Error())
+		return
+	}
+
+	for _, t := range things {
+		if t == nil || (c.visible != nil && !c.visible(t)) {
+			continue
+		}
+
+		for _, prop := range t.Properties {
+			value, err := c.store.GetItemValue(ctx, t.ID, prop.ID)
+			if err != nil || value == nil {
+				continue
+			}
+
+			f, ok := toGaugeValue(value)
+			if !ok {
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				propertyValueDesc,
+				prometheus.GaugeValue,
+				f,
+				t.ID, prop.ID, prop.TypeAnnotation, prop.Unit,
+			)
+		}
+	}
+}
+
+// toGaugeValue converts numbers and booleans to float64
+func toGaugeValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/macaron.v1"
+)
+
+// Middleware returns a macaron handler that observes the duration of all
+// requests handled after it. params holds the names of all path parameters
+// (like ":thingID") which are used to restore the route pattern
+func Middleware(params ...string) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		status := ctx.Resp.Status()
+		if status == 0 {
+			status = 200
+		}
+
+		HTTPRequestDuration.WithLabelValues(
+			ctx.Req.Method,
+			route(ctx, status, params),
+			strconv.Itoa(status),
+		).Observe(time.Since(start).Seconds())
+	}
+}
+
+// route returns the route pattern of the request by replacing all path
+// parameter values with their names. Macaron does not expose the pattern
+// of the matched route
+func route(ctx *macaron.Context, status int, params []string) string {
+	values := make(map[string]string)
+	for _, name := range params {
+		if value := ctx.Params(name); value != "" {
+			values[value] = name
+		}
+	}
+
+	// unmatched requests would create a new time series for each path
+	if status == 404 && len(values) == 0 {
+		return "unmatched"
+	}
+
+	segments := strings.Split(ctx.Req.URL.Path, "/")
+	for idx, segment := range segments {
+		if name, ok := values[segment]; ok {
+			segments[idx] = name
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
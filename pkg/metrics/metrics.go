@@ -0,0 +1,101 @@
+// Package metrics exposes gateway internals and property values in the
+// Prometheus text format
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gateway"
+
+// Registry holds all gateway metrics
+var Registry = prometheus.NewRegistry()
+
+// Gateway metrics
+var (
+	// MessagesReceived counts MQTT messages received per thing. Messages
+	// that do not match the status topic of any thing are counted as
+	// Unknown
+	MessagesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "mqtt",
+		Name:      "messages_received_total",
+		Help:      "Number of MQTT messages received per thing",
+	}, []string{"thing"})
+
+	// StatusReports counts status reports per thing property
+	StatusReports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_reports_total",
+		Help:      "Number of status reports received per thing property",
+	}, []string{"thing", "property"})
+
+	// ParseErrors counts status reports that could not be parsed or
+	// coerced to the property type
+	ParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_parse_errors_total",
+		Help:      "Number of status reports that failed to parse per thing property and handler type",
+	}, []string{"thing", "property", "handler"})
+
+	// SetRequests counts set requests by result (success or error). Requests
+	// for unknown things or properties are counted as Unknown
+	SetRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "set_requests_total",
+		Help:      "Number of property set requests per thing property and result",
+	}, []string{"thing", "property", "result"})
+
+	// HTTPRequestDuration observes the duration of HTTP requests by route
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests per method, route and status code",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	// DriverLatency observes the duration of registry driver operations
+	DriverLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "registry",
+		Name:      "driver_duration_seconds",
+		Help:      "Duration of registry driver operations",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+
+	// MQTTConnected is 1 if the gateway is connected to the MQTT broker
+	MQTTConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "mqtt",
+		Name:      "connected",
+		Help:      "Whether or not the gateway is connected to the MQTT broker",
+	})
+)
+
+// Unknown is used as label value for things and properties that do not
+// exist so clients cannot create arbitrary label values
+const Unknown = "unknown"
+
+// Result returns the value of the `result` label for err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+func init() {
+	Registry.MustRegister(
+		MessagesReceived,
+		StatusReports,
+		ParseErrors,
+		SetRequests,
+		HTTPRequestDuration,
+		DriverLatency,
+		MQTTConnected,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/macaron.v1"
+)
+
+func Test_ToGaugeValue(t *testing.T) {
+	cases := []struct {
+		i  interface{}
+		o  float64
+		ok bool
+	}{
+		{21.5, 21.5, true},
+		{int64(3), 3, true},
+		{uint8(7), 7, true},
+		{true, 1, true},
+		{false, 0, true},
+		{"21.5", 0, false},
+		{map[string]interface{}{}, 0, false},
+	}
+
+	for _, c := range cases {
+		o, ok := toGaugeValue(c.i)
+		assert.Equal(t, c.ok, ok, "%v", c.i)
+		assert.Equal(t, c.o, o, "%v", c.i)
+	}
+}
+
+func Test_Exporter(t *testing.T) {
+	store := registry.New(InstrumentDriver(memory.New()))
+	ctx := context.Background()
+
+	things := []*spec.Thing{
+		{
+			ID: "weather",
+			Properties: map[string]*spec.Property{
+				"temperature": {ID: "temperature", Type: spec.Number, Unit: "degree celsius", TypeAnnotation: "TemperatureProperty"},
+				"condition":   {ID: "condition", Type: spec.String},
+			},
+		},
+		{
+			ID: "paz",
+			Properties: map[string]*spec.Property{
+				"home": {ID: "home", Type: spec.Boolean},
+			},
+		},
+	}
+
+	for _, thing := range things {
+		assert.Nil(t, store.Create(ctx, thing))
+		for id := range thing.Properties {
+			values, err := store.ItemValues(ctx, thing.ID, id)
+			assert.Nil(t, err)
+
+			switch id {
+			case "temperature":
+				values.Put(ctx, 21.5)
+			case "condition":
+				values.Put(ctx, "sunny")
+			case "home":
+				values.Put(ctx, true)
+			}
+		}
+	}
+
+	visible := func(t *spec.Thing) bool {
+		return t.ID != "paz"
+	}
+
+	rec := httptest.NewRecorder()
+	NewExporter(store, &Config{PropertyValues: true}).Handler(visible).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `gateway_property_value{property="temperature",thing="weather",type="TemperatureProperty",unit="degree celsius"} 21.5`)
+	assert.NotContains(t, body, `property="condition"`)
+	assert.NotContains(t, body, `thing="paz"`)
+	assert.Contains(t, body, `gateway_registry_driver_duration_seconds_count{operation="set"}`)
+
+	rec = httptest.NewRecorder()
+	NewExporter(store, nil).Handler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.NotContains(t, rec.Body.String(), "gateway_property_value")
+}
+
+func Test_Middleware(t *testing.T) {
+	m := macaron.New()
+	m.Use(Middleware(":thingID", ":propID"))
+	m.Get("/things/:thingID/properties/:propID", func() string { return "ok" })
+
+	for _, path := range []string{"/things/lamp/properties/on", "/unknown/path"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rec := httptest.NewRecorder()
+	NewExporter(nil, nil).Handler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	assert.Contains(t, body, `gateway_http_request_duration_seconds_count{code="200",method="GET",route="/things/:thingID/properties/:propID"} 1`)
+	assert.Contains(t, body, `gateway_http_request_duration_seconds_count{code="404",method="GET",route="unmatched"} 1`)
+}
@@ -0,0 +1,147 @@
+// Package baseurl determines the external URL of the gateway as seen by
+// clients. This is required to build absolute links when the gateway is
+// running behind a reverse proxy
+package baseurl
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"gopkg.in/macaron.v1"
+)
+
+// Config configures how the external URL is determined
+type Config struct {
+	// External may hold the external URL of the gateway (like
+	// https://example.com/gateway). If set, it is used for all requests
+	// and X-Forwarded-* headers are ignored
+	External string
+
+	// Prefix is the path prefix all routes are mounted under
+	Prefix string
+
+	// TrustedProxies holds the networks of reverse proxies whose
+	// X-Forwarded-* headers are honoured. The headers of all other
+	// clients are ignored
+	TrustedProxies []*net.IPNet
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR networks
+// (like 10.0.0.0/8) for Config.TrustedProxies
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, p := range proxies {
+		cidr := p
+
+		// single addresses are converted into networks
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %q", p)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// trusted returns true if req has been sent by one of the trusted proxies
+// of cfg
+func (cfg Config) trusted(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range cfg.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL is the external URL of the gateway for the current request without
+// a trailing slash. It is available via dependency injection
+type URL string
+
+// Middleware returns a macaron handler that maps the URL of each request
+func Middleware(cfg Config) macaron.Handler {
+	return func(ctx *macaron.Context) {
+		ctx.Map(FromRequest(ctx.Req.Request, cfg))
+	}
+}
+
+// FromRequest returns the external URL of the gateway for req. Unless
+// configured, the scheme, host and prefix are taken from the request.
+// Requests sent by a trusted proxy may override them using the
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Prefix headers
+func FromRequest(req *http.Request, cfg Config) URL {
+	if cfg.External != "" {
+		return URL(strings.TrimSuffix(cfg.External, "/"))
+	}
+
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	host := req.Host
+	prefix := NormalizePrefix(cfg.Prefix)
+
+	if !cfg.trusted(req) {
+		return URL(scheme + "://" + host + prefix)
+	}
+
+	switch proto := strings.ToLower(forwarded(req, "X-Forwarded-Proto")); proto {
+	case "http", "https":
+		scheme = proto
+	}
+
+	if h := forwarded(req, "X-Forwarded-Host"); h != "" {
+		host = h
+	}
+
+	prefix = NormalizePrefix(forwarded(req, "X-Forwarded-Prefix")) + prefix
+
+	return URL(scheme + "://" + host + prefix)
+}
+
+// NormalizePrefix returns prefix with a leading but without a trailing
+// slash. An empty string is returned for the root path
+func NormalizePrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+
+	return "/" + prefix
+}
+
+// forwarded returns the first value of the forwarded header name. Proxies
+// append their values to the list so the first one is set by the proxy
+// closest to the client
+func forwarded(req *http.Request, name string) string {
+	value := req.Header.Get(name)
+	if idx := strings.Index(value, ","); idx >= 0 {
+		value = value[:idx]
+	}
+
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,94 @@
+package baseurl
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NormalizePrefix(t *testing.T) {
+	cases := map[string]string{
+		"":          "",
+		"/":         "",
+		"gateway":   "/gateway",
+		"/gateway/": "/gateway",
+		"/a/b":      "/a/b",
+	}
+
+	for i, o := range cases {
+		assert.Equal(t, o, NormalizePrefix(i), i)
+	}
+}
+
+func Test_FromRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/things", nil)
+	req.Host = "gateway:4300"
+
+	assert.Equal(t, URL("http://gateway:4300"), FromRequest(req, Config{}))
+	assert.Equal(t, URL("http://gateway:4300/gw"), FromRequest(req, Config{Prefix: "gw/"}))
+
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, URL("https://gateway:4300"), FromRequest(req, Config{}))
+
+	assert.Equal(t, URL("https://example.com/gateway"), FromRequest(req, Config{External: "https://example.com/gateway/", Prefix: "/gw"}))
+}
+
+func Test_FromRequestForwarded(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest("GET", "/api/v1/things", nil)
+	req.Host = "gateway:4300"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "home.example.com, proxy.local")
+	req.Header.Set("X-Forwarded-Prefix", "/smarthome")
+
+	// headers of untrusted clients are ignored
+	assert.Equal(t, URL("http://gateway:4300/gw"), FromRequest(req, Config{Prefix: "/gw"}))
+
+	req.RemoteAddr = "192.0.2.1:4711"
+	assert.Equal(t, URL("https://home.example.com/smarthome/gw"), FromRequest(req, Config{Prefix: "/gw", TrustedProxies: proxies}))
+
+	req.RemoteAddr = "10.1.2.3:4711"
+	assert.Equal(t, URL("https://home.example.com/smarthome/gw"), FromRequest(req, Config{Prefix: "/gw", TrustedProxies: proxies}))
+
+	req.RemoteAddr = "192.0.2.2:4711"
+	assert.Equal(t, URL("http://gateway:4300/gw"), FromRequest(req, Config{Prefix: "/gw", TrustedProxies: proxies}))
+
+	// only http and https are accepted as scheme
+	req.RemoteAddr = "10.1.2.3:4711"
+	req.Header.Set("X-Forwarded-Proto", "javascript")
+	assert.Equal(t, URL("http://home.example.com/smarthome"), FromRequest(req, Config{TrustedProxies: proxies}))
+
+	req.Header.Set("X-Forwarded-Proto", "HTTPS")
+	assert.Equal(t, URL("https://home.example.com/smarthome"), FromRequest(req, Config{TrustedProxies: proxies}))
+}
+
+func Test_ParseTrustedProxies(t *testing.T) {
+	cases := []struct {
+		in    string
+		out   string
+		valid bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", true},
+		{"192.168.1.10", "192.168.1.10/32", true},
+		{"fd00::/8", "fd00::/8", true},
+		{"::1", "::1/128", true},
+		{"proxy.local", "", false},
+		{"10.0.0.0/33", "", false},
+	}
+
+	for _, c := range cases {
+		nets, err := ParseTrustedProxies([]string{c.in})
+		if !c.valid {
+			assert.NotNil(t, err, c.in)
+			continue
+		}
+
+		if assert.Nil(t, err, c.in) && assert.Len(t, nets, 1, c.in) {
+			assert.Equal(t, c.out, nets[0].String(), c.in)
+		}
+	}
+}
@@ -25,6 +25,20 @@ var yamlMimeTypes = []string{
 	"text/x-yaml",
 }
 
+// typed is a payload that should be rendered as JSON using a specific
+// content type
+type typed struct {
+	contentType string
+	payload     interface{}
+}
+
+// WithContentType wraps payload so it is rendered as JSON using contentType
+// instead of application/json. YAML is still returned if requested by the
+// client
+func WithContentType(contentType string, payload interface{}) interface{} {
+	return &typed{contentType, payload}
+}
+
 func macaronFallback(ctx *macaron.Context, values []reflect.Value) {
 	logrus.Errorf("unsupport API response")
 	handler := ctx.GetVal(reflect.TypeOf(OriginalHandler(nil))).Interface()
@@ -43,6 +57,12 @@ func clientWantsYAML(ctx *macaron.Context) bool {
 }
 
 func render(ctx *macaron.Context, code int, payload interface{}) {
+	contentType := ""
+	if t, ok := payload.(*typed); ok {
+		contentType = t.contentType
+		payload = t.payload
+	}
+
 	if clientWantsYAML(ctx) {
 		blob, err := json.Marshal(payload)
 		if err != nil {
@@ -62,6 +82,19 @@ func render(ctx *macaron.Context, code int, payload interface{}) {
 		return
 	}
 
+	if contentType != "" {
+		blob, err := json.Marshal(payload)
+		if err != nil {
+			ctx.Error(500, err.Error())
+			return
+		}
+
+		ctx.Resp.Header().Set("Content-Type", contentType)
+		ctx.Resp.WriteHeader(code)
+		ctx.Resp.Write(blob)
+		return
+	}
+
 	ctx.JSON(code, payload)
 }
 
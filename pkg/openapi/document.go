@@ -0,0 +1,111 @@
+// Package openapi generates an OpenAPI 3 description of the REST API
+// including paths and schemas for each thing in the registry
+package openapi
+
+import "github.com/ppacher/webthings-mqtt-gateway/pkg/schema"
+
+// Version is the OpenAPI version of generated documents
+const Version = "3.0.2"
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+// Info holds metadata about the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server describes a server exposing the API
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem describes the operations available on a single path
+type PathItem struct {
+	Get        *Operation   `json:"get,omitempty"`
+	Put        *Operation   `json:"put,omitempty"`
+	Post       *Operation   `json:"post,omitempty"`
+	Delete     *Operation   `json:"delete,omitempty"`
+	Patch      *Operation   `json:"patch,omitempty"`
+	Parameters []*Parameter `json:"parameters,omitempty"`
+}
+
+// Operation describes a single API operation on a path
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter describes a single operation parameter
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *schema.Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the request body of an operation
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a single response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the content of a request or response body
+type MediaType struct {
+	Schema *schema.Schema `json:"schema,omitempty"`
+}
+
+// Components holds reusable objects of the document
+type Components struct {
+	Schemas         map[string]*schema.Schema  `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes a security scheme used by the API
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// ref returns a schema referencing the component schema name
+func ref(name string) *schema.Schema {
+	return &schema.Schema{Ref: "#/components/schemas/" + name}
+}
+
+// jsonContent returns a JSON media type map for s
+func jsonContent(s *schema.Schema) map[string]*MediaType {
+	return map[string]*MediaType{
+		"application/json": {Schema: s},
+	}
+}
+
+// response returns a response with an optional JSON body
+func response(description string, s *schema.Schema) *Response {
+	r := &Response{Description: description}
+	if s != nil {
+		r.Content = jsonContent(s)
+	}
+
+	return r
+}
@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/schema"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+var invalidIdentifierChars = regexp.MustCompile("[^A-Za-z0-9]+")
+
+// thingDescription holds the paths and schemas generated for a single thing
+type thingDescription struct {
+	thing   *spec.Thing
+	paths   map[string]*PathItem
+	schemas map[string]*schema.Schema
+}
+
+// Generator generates OpenAPI documents for the REST API. Thing specific
+// paths are cached and regenerated whenever the registry changes
+type Generator struct {
+	store    registry.Registry
+	security bool
+
+	l      sync.Mutex
+	things []*thingDescription
+	valid  bool
+}
+
+// NewGenerator returns a new generator for the things in store. If security
+// is true, bearer authentication is added to the document
+func NewGenerator(store registry.Registry, security bool) *Generator {
+	g := &Generator{
+		store:    store,
+		security: security,
+	}
+
+	invalidate := func(*spec.Thing) {
+		g.l.Lock()
+		defer g.l.Unlock()
+
+		g.valid = false
+	}
+
+	store.RegisterCreatedNotifier(invalidate)
+	store.RegisterUpdatedNotifier(invalidate)
+	store.RegisterDeletedNotifier(invalidate)
+
+	return g
+}
+
+// Document returns the OpenAPI document for the REST API served at server.
+// Only things accepted by visible are included. If visible is nil all things
+// are included
+func (g *Generator) Document(ctx context.Context, server string, visible func(*spec.Thing) bool) (*Document, error) {
+	things, err := g.describeThings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "WebThings MQTT Gateway",
+			Description: "REST API for things managed by the gateway",
+			Version:     "v1",
+		},
+		Servers: []Server{
+			{URL: server},
+		},
+		Paths: staticPaths(),
+		Components: Components{
+			Schemas: staticSchemas(),
+		},
+	}
+
+	if g.security {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			"bearerAuth": {
+				Type:   "http",
+				Scheme: "bearer",
+			},
+		}
+		doc.Security = []map[string][]string{
+			{"bearerAuth": {}},
+		}
+	}
+
+	for _, desc := range things {
+		if visible != nil && !visible(desc.thing) {
+			continue
+		}
+
+		for path, item := range desc.paths {
+			doc.Paths[path] = item
+		}
+
+		for name, s := range desc.schemas {
+			doc.Components.Schemas[name] = s
+		}
+	}
+
+	return doc, nil
+}
+
+// describeThings returns the cached thing descriptions or generates new ones
+// if the registry changed
+func (g *Generator) describeThings(ctx context.Context) ([]*thingDescription, error) {
+	g.l.Lock()
+	defer g.l.Unlock()
+
+	if g.valid {
+		return g.things, nil
+	}
+
+	things, err := g.store.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]*thingDescription, 0, len(things))
+	for _, t := range things {
+		if t == nil {
+			continue
+		}
+
+		descriptions = append(descriptions, describeThing(t))
+	}
+
+	g.things = descriptions
+	g.valid = true
+
+	return descriptions, nil
+}
+
+// describeThing generates the paths and schemas for the properties of t
+func describeThing(t *spec.Thing) *thingDescription {
+	desc := &thingDescription{
+		thing:   t,
+		paths:   make(map[string]*PathItem),
+		schemas: make(map[string]*schema.Schema),
+	}
+
+	name := identifier(t.ID)
+	tags := []string{t.ID}
+	base := "/things/" + url.PathEscape(t.ID)
+
+	propertiesSchema := name + "Properties"
+	desc.schemas[propertiesSchema] = schema.FromProperties(t)
+
+	desc.paths[base+"/properties"] = &PathItem{
+		Get: &Operation{
+			OperationID: "get" + name + "Properties",
+			Summary:     "Returns all property values of " + title(t),
+			Tags:        tags,
+			Responses: map[string]*Response{
+				"200": response("property values", ref(propertiesSchema)),
+			},
+		},
+		Put: &Operation{
+			OperationID: "set" + name + "Properties",
+			Summary:     "Sets multiple property values of " + title(t),
+			Tags:        tags,
+			RequestBody: &RequestBody{
+				Required: true,
+				Content:  jsonContent(ref(propertiesSchema)),
+			},
+			Responses: map[string]*Response{
+				"202": response("set requests published", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+				"207": response("some set requests failed", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+			},
+		},
+	}
+
+	ids := make([]string, 0, len(t.Properties))
+	for id := range t.Properties {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		prop := t.Properties[id]
+		propName := name + identifier(id)
+
+		valueSchema := propName + "Value"
+		desc.schemas[valueSchema] = schema.FromProperty(prop)
+
+		var content map[string]*MediaType
+		if prop.Type == "" || spec.IsJSONEncodableValue(prop.Type) {
+			content = jsonContent(&schema.Schema{
+				Type:       "object",
+				Properties: map[string]*schema.Schema{id: ref(valueSchema)},
+				Required:   []string{id},
+			})
+		} else {
+			content = map[string]*MediaType{
+				string(prop.Type): {Schema: ref(valueSchema)},
+			}
+		}
+
+		item := &PathItem{
+			Get: &Operation{
+				OperationID: "get" + propName,
+				Summary:     "Returns the value of " + id,
+				Tags:        tags,
+				Responses: map[string]*Response{
+					"200": {Description: "current value", Content: content},
+					"404": response("unknown thing or property", ref("Error")),
+				},
+			},
+		}
+
+		if !prop.Readonly {
+			item.Post = &Operation{
+				OperationID: "set" + propName,
+				Summary:     "Sets the value of " + id,
+				Tags:        tags,
+				RequestBody: &RequestBody{
+					Required: true,
+					Content:  content,
+				},
+				Responses: map[string]*Response{
+					"202": response("set request published", nil),
+					"400": response("invalid payload", ref("Error")),
+				},
+			}
+		}
+
+		desc.paths[base+"/properties/"+url.PathEscape(id)] = item
+	}
+
+	return desc
+}
+
+// identifier converts id into an upper camel case identifier
+func identifier(id string) string {
+	parts := invalidIdentifierChars.Split(id, -1)
+
+	var res string
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+
+		res += strings.ToUpper(p[:1]) + p[1:]
+	}
+
+	return res
+}
+
+func title(t *spec.Thing) string {
+	if t.Title != "" {
+		return t.Title
+	}
+
+	return t.ID
+}
@@ -0,0 +1,85 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Identifier(t *testing.T) {
+	cases := map[string]string{
+		"paz":              "Paz",
+		"living-room/lamp": "LivingRoomLamp",
+		"temp_1":           "Temp1",
+		"":                 "",
+	}
+
+	for i, o := range cases {
+		assert.Equal(t, o, identifier(i), i)
+	}
+}
+
+func Test_Document(t *testing.T) {
+	ctx := context.Background()
+	store := registry.New(memory.New())
+	g := NewGenerator(store, true)
+
+	min := 5.0
+	max := 30.0
+	assert.Nil(t, store.Create(ctx, &spec.Thing{
+		ID: "heater",
+		Properties: map[string]*spec.Property{
+			"target": {ID: "target", Type: spec.Number, Unit: "degree celsius", Minimum: &min, Maximum: &max},
+			"mode":   {ID: "mode", Type: spec.String, Enum: []interface{}{"eco", "comfort"}},
+			"error":  {ID: "error", Type: spec.String, Readonly: true},
+			"image":  {ID: "image", Type: "image/png", Readonly: true},
+		},
+	}))
+	assert.Nil(t, store.Create(ctx, &spec.Thing{ID: "hidden"}))
+
+	doc, err := g.Document(ctx, "http://gateway/api/v1", func(t *spec.Thing) bool {
+		return t.ID != "hidden"
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Equal(t, []Server{{URL: "http://gateway/api/v1"}}, doc.Servers)
+	assert.NotNil(t, doc.Components.SecuritySchemes["bearerAuth"])
+	assert.NotNil(t, doc.Paths["/things/{thingID}"])
+
+	assert.NotNil(t, doc.Paths["/things/heater/properties"])
+	assert.Nil(t, doc.Paths["/things/hidden/properties"])
+
+	target := doc.Components.Schemas["HeaterTargetValue"]
+	if assert.NotNil(t, target) {
+		assert.Equal(t, "number", target.Type)
+		assert.Equal(t, &min, target.Minimum)
+		assert.Equal(t, &max, target.Maximum)
+		assert.Equal(t, "degree celsius", target.Unit)
+	}
+	assert.Equal(t, []interface{}{"eco", "comfort"}, doc.Components.Schemas["HeaterModeValue"].Enum)
+
+	item := doc.Paths["/things/heater/properties/target"]
+	if assert.NotNil(t, item) {
+		assert.Equal(t, "setHeaterTarget", item.Post.OperationID)
+		assert.NotNil(t, item.Post.RequestBody.Content["application/json"])
+	}
+
+	assert.Nil(t, doc.Paths["/things/heater/properties/error"].Post)
+	assert.NotNil(t, doc.Paths["/things/heater/properties/image"].Get.Responses["200"].Content["image/png"])
+
+	_, err = json.Marshal(doc)
+	assert.Nil(t, err)
+
+	// the document must be regenerated when the registry changes
+	assert.Nil(t, store.Delete(ctx, "heater", 0))
+	assert.Eventually(t, func() bool {
+		doc, err := g.Document(ctx, "/api/v1", nil)
+		return err == nil && doc.Paths["/things/heater/properties"] == nil && doc.Paths["/things/hidden/properties"] != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,607 @@
+package openapi
+
+import "github.com/ppacher/webthings-mqtt-gateway/pkg/schema"
+
+var (
+	thingIDParam = &Parameter{
+		Name:     "thingID",
+		In:       "path",
+		Required: true,
+		Schema:   &schema.Schema{Type: "string"},
+	}
+
+	propIDParam = &Parameter{
+		Name:     "propID",
+		In:       "path",
+		Required: true,
+		Schema:   &schema.Schema{Type: "string"},
+	}
+
+	ifMatchParam = &Parameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: "ETag of the thing. The request fails if the thing has been modified",
+		Schema:      &schema.Schema{Type: "string"},
+	}
+
+	groupIDParam = &Parameter{
+		Name:     "groupID",
+		In:       "path",
+		Required: true,
+		Schema:   &schema.Schema{Type: "string"},
+	}
+
+	tokenIDParam = &Parameter{
+		Name:     "tokenID",
+		In:       "path",
+		Required: true,
+		Schema:   &schema.Schema{Type: "string"},
+	}
+)
+
+// errorResponse returns a response using the Error schema
+func errorResponse(description string) *Response {
+	return response(description, ref("Error"))
+}
+
+// staticSchemas returns the component schemas shared by all paths
+func staticSchemas() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"Error": {
+			Type: "object",
+			Properties: map[string]*schema.Schema{
+				"code":  {Type: "integer"},
+				"error": {Type: "string"},
+			},
+			Required: []string{"code", "error"},
+		},
+		"Thing": {
+			Type:        "object",
+			Description: "Thing description",
+			Properties: map[string]*schema.Schema{
+				"id":          {Type: "string"},
+				"title":       {Type: "string"},
+				"description": {Type: "string"},
+				"@type":       {Type: "array", Items: &schema.Schema{Type: "string"}},
+				"properties": {
+					Type:                 "object",
+					AdditionalProperties: ref("Property"),
+				},
+			},
+			Required: []string{"id"},
+		},
+		"Property": {
+			Type:        "object",
+			Description: "Property definition",
+			Properties: map[string]*schema.Schema{
+				"type":        {Type: "string"},
+				"title":       {Type: "string"},
+				"description": {Type: "string"},
+				"unit":        {Type: "string"},
+				"enum":        {Type: "array", Items: &schema.Schema{}},
+				"readOnly":    {Type: "boolean"},
+				"minimum":     {Type: "number"},
+				"maximum":     {Type: "number"},
+				"multipleOf":  {Type: "number"},
+				"mqtt":        {Type: "object"},
+			},
+		},
+		"Token": {
+			Type: "object",
+			Properties: map[string]*schema.Schema{
+				"id":      {Type: "string"},
+				"name":    {Type: "string"},
+				"scopes":  {Type: "array", Items: &schema.Schema{Type: "string"}},
+				"static":  {Type: "boolean"},
+				"created": {Type: "string", Format: "date-time"},
+				"token":   {Type: "string"},
+			},
+		},
+		"Group": {
+			Type:        "object",
+			Description: "Location or arbitrary group of things",
+			Properties: map[string]*schema.Schema{
+				"id":          {Type: "string"},
+				"title":       {Type: "string"},
+				"description": {Type: "string"},
+				"kind":        {Type: "string", Enum: []interface{}{"location", "group"}},
+				"parent":      {Type: "string"},
+				"things":      {Type: "array", Items: &schema.Schema{Type: "string"}},
+			},
+			Required: []string{"id"},
+		},
+		"ItemResult": {
+			Type:        "object",
+			Description: "Result of reading or setting a property",
+			Properties: map[string]*schema.Schema{
+				"thing":    {Type: "string"},
+				"property": {Type: "string"},
+				"status":   {Type: "integer"},
+				"value":    {},
+				"error":    ref("Error"),
+			},
+			Required: []string{"property", "status"},
+		},
+		"BatchRequest": {
+			Type: "object",
+			Properties: map[string]*schema.Schema{
+				"op":       {Type: "string", Enum: []interface{}{"read", "set"}},
+				"thing":    {Type: "string"},
+				"property": {Type: "string"},
+				"value":    {},
+			},
+			Required: []string{"op", "thing", "property"},
+		},
+		"AuditEntry": {
+			Type: "object",
+			Properties: map[string]*schema.Schema{
+				"id":         {Type: "string"},
+				"timestamp":  {Type: "string", Format: "date-time"},
+				"kind":       {Type: "string"},
+				"principal":  {Type: "string"},
+				"remoteAddr": {Type: "string"},
+				"thingID":    {Type: "string"},
+				"propertyID": {Type: "string"},
+				"oldValue":   {},
+				"newValue":   {},
+				"success":    {Type: "boolean"},
+				"error":      {Type: "string"},
+			},
+		},
+	}
+}
+
+// staticPaths returns the generic paths of the REST API
+func staticPaths() map[string]*PathItem {
+	query := func(name, description string) *Parameter {
+		return &Parameter{
+			Name:        name,
+			In:          "query",
+			Description: description,
+			Schema:      &schema.Schema{Type: "string"},
+		}
+	}
+
+	return map[string]*PathItem{
+		"/things": {
+			Get: &Operation{
+				OperationID: "getThings",
+				Summary:     "Returns all things",
+				Tags:        []string{"things"},
+				Parameters: []*Parameter{
+					query("type", "only return things with this @type"),
+					query("location", "glob pattern the location of things must match"),
+					query("title", "text the title of things must contain"),
+					query("propertyType", "only return things with a property of this @type"),
+					query("sort", "sort by id or title. Prefix with - to sort descending"),
+					query("limit", "maximum number of things"),
+					query("cursor", "cursor of the next page taken from the Link header"),
+				},
+				Responses: map[string]*Response{
+					"200": response("list of things", &schema.Schema{Type: "array", Items: ref("Thing")}),
+					"400": errorResponse("invalid query"),
+				},
+			},
+			Post: &Operation{
+				OperationID: "createThing",
+				Summary:     "Creates a new thing",
+				Tags:        []string{"things"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("Thing"))},
+				Responses: map[string]*Response{
+					"201": response("thing created", ref("Thing")),
+					"400": errorResponse("invalid thing"),
+				},
+			},
+		},
+		"/things/{thingID}": {
+			Parameters: []*Parameter{thingIDParam},
+			Get: &Operation{
+				OperationID: "getThing",
+				Summary:     "Returns a thing",
+				Tags:        []string{"things"},
+				Responses: map[string]*Response{
+					"200": response("thing description", ref("Thing")),
+					"404": errorResponse("unknown thing"),
+				},
+			},
+			Put: &Operation{
+				OperationID: "updateThing",
+				Summary:     "Replaces a thing",
+				Tags:        []string{"things"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("Thing"))},
+				Parameters:  []*Parameter{ifMatchParam},
+				Responses: map[string]*Response{
+					"204": response("thing updated", nil),
+					"400": errorResponse("invalid thing"),
+					"404": errorResponse("unknown thing"),
+					"412": errorResponse("thing has been modified"),
+				},
+			},
+			Patch: &Operation{
+				OperationID: "patchThing",
+				Summary:     "Applies a JSON Merge Patch or JSON Patch to a thing",
+				Tags:        []string{"things"},
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: map[string]*MediaType{
+						"application/merge-patch+json": {Schema: &schema.Schema{Type: "object"}},
+						"application/json-patch+json":  {Schema: &schema.Schema{Type: "array", Items: &schema.Schema{Type: "object"}}},
+					},
+				},
+				Parameters: []*Parameter{ifMatchParam},
+				Responses: map[string]*Response{
+					"200": response("updated thing", ref("Thing")),
+					"400": errorResponse("invalid patch or thing"),
+					"404": errorResponse("unknown thing"),
+					"415": errorResponse("unsupported patch format"),
+					"422": errorResponse("patch cannot be applied"),
+					"412": errorResponse("thing has been modified"),
+				},
+			},
+			Delete: &Operation{
+				OperationID: "deleteThing",
+				Summary:     "Deletes a thing",
+				Tags:        []string{"things"},
+				Parameters:  []*Parameter{ifMatchParam},
+				Responses: map[string]*Response{
+					"202": response("thing deleted", nil),
+					"404": errorResponse("unknown thing"),
+					"412": errorResponse("thing has been modified"),
+				},
+			},
+		},
+		"/things/{thingID}/schema": {
+			Parameters: []*Parameter{thingIDParam},
+			Get: &Operation{
+				OperationID: "getThingSchema",
+				Summary:     "Returns the JSON schema of the property values of a thing",
+				Tags:        []string{"things"},
+				Responses: map[string]*Response{
+					"200": response("JSON schema", &schema.Schema{Type: "object"}),
+					"404": errorResponse("unknown thing"),
+				},
+			},
+		},
+		"/schema/thing": {
+			Get: &Operation{
+				OperationID: "getDefinitionSchema",
+				Summary:     "Returns the JSON schema of thing definitions",
+				Tags:        []string{"meta"},
+				Responses: map[string]*Response{
+					"200": response("JSON schema", &schema.Schema{Type: "object"}),
+				},
+			},
+		},
+		"/things/{thingID}/properties": {
+			Parameters: []*Parameter{thingIDParam},
+			Get: &Operation{
+				OperationID: "getProperties",
+				Summary:     "Returns all property values of a thing",
+				Tags:        []string{"properties"},
+				Responses: map[string]*Response{
+					"200": response("property values", &schema.Schema{Type: "object"}),
+					"404": errorResponse("unknown thing"),
+				},
+			},
+			Put: &Operation{
+				OperationID: "setProperties",
+				Summary:     "Sets multiple property values in order",
+				Tags:        []string{"properties"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(&schema.Schema{Type: "object"})},
+				Responses: map[string]*Response{
+					"202": response("set requests published", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"207": response("some set requests failed", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"400": errorResponse("invalid payload"),
+					"404": errorResponse("unknown thing"),
+				},
+			},
+		},
+		"/things/{thingID}/properties/{propID}": {
+			Parameters: []*Parameter{thingIDParam, propIDParam},
+			Get: &Operation{
+				OperationID: "getProperty",
+				Summary:     "Returns the value of a property",
+				Tags:        []string{"properties"},
+				Responses: map[string]*Response{
+					"200": response("property value keyed by the property ID", &schema.Schema{Type: "object"}),
+					"404": errorResponse("unknown thing or property"),
+				},
+			},
+			Post: &Operation{
+				OperationID: "setProperty",
+				Summary:     "Sets the value of a property",
+				Tags:        []string{"properties"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(&schema.Schema{Type: "object"})},
+				Responses: map[string]*Response{
+					"202": response("set request published", nil),
+					"400": errorResponse("invalid payload"),
+				},
+			},
+		},
+		"/things/{thingID}/properties/{propID}/definition": {
+			Parameters: []*Parameter{thingIDParam, propIDParam},
+			Put: &Operation{
+				OperationID: "putPropertyDefinition",
+				Summary:     "Adds or replaces the definition of a property",
+				Tags:        []string{"properties"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("Property"))},
+				Responses: map[string]*Response{
+					"200": response("property replaced", ref("Property")),
+					"201": response("property added", ref("Property")),
+					"400": errorResponse("invalid property"),
+					"404": errorResponse("unknown thing"),
+				},
+			},
+			Delete: &Operation{
+				OperationID: "deletePropertyDefinition",
+				Summary:     "Removes a property from a thing",
+				Tags:        []string{"properties"},
+				Responses: map[string]*Response{
+					"204": response("property removed", nil),
+					"404": errorResponse("unknown thing or property"),
+				},
+			},
+		},
+		"/things/{thingID}/properties/{propID}/history": {
+			Parameters: []*Parameter{thingIDParam, propIDParam},
+			Get: &Operation{
+				OperationID: "getPropertyHistory",
+				Summary:     "Returns the recorded values of a property",
+				Tags:        []string{"properties"},
+				Responses: map[string]*Response{
+					"200": response("recorded values", &schema.Schema{Type: "array", Items: &schema.Schema{}}),
+				},
+			},
+		},
+		"/batch": {
+			Post: &Operation{
+				OperationID: "batch",
+				Summary:     "Reads or sets properties of multiple things",
+				Tags:        []string{"properties"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(&schema.Schema{Type: "array", Items: ref("BatchRequest")})},
+				Responses: map[string]*Response{
+					"200": response("results in the order of the requests", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"202": response("set requests published", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"207": response("some requests failed", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"400": errorResponse("invalid batch"),
+					"413": errorResponse("too many requests in batch"),
+				},
+			},
+		},
+		"/groups": {
+			Get: &Operation{
+				OperationID: "getGroups",
+				Summary:     "Returns all groups and locations",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"200": response("list of groups", &schema.Schema{Type: "array", Items: ref("Group")}),
+				},
+			},
+			Post: &Operation{
+				OperationID: "createGroup",
+				Summary:     "Creates a new group or location",
+				Tags:        []string{"groups"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("Group"))},
+				Responses: map[string]*Response{
+					"201": response("group created", ref("Group")),
+					"400": errorResponse("invalid group"),
+					"403": errorResponse("not allowed to manage a thing of the group"),
+					"404": errorResponse("unknown thing"),
+					"409": errorResponse("group ID already exists"),
+				},
+			},
+		},
+		"/groups/{groupID}": {
+			Parameters: []*Parameter{groupIDParam},
+			Get: &Operation{
+				OperationID: "getGroup",
+				Summary:     "Returns a group",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"200": response("group", ref("Group")),
+					"404": errorResponse("unknown group"),
+				},
+			},
+			Put: &Operation{
+				OperationID: "updateGroup",
+				Summary:     "Replaces a group",
+				Tags:        []string{"groups"},
+				RequestBody: &RequestBody{Required: true, Content: jsonContent(ref("Group"))},
+				Responses: map[string]*Response{
+					"200": response("group updated", ref("Group")),
+					"400": errorResponse("invalid group"),
+					"403": errorResponse("not allowed to manage an added or removed thing"),
+					"404": errorResponse("unknown group or thing"),
+					"412": errorResponse("group has been modified concurrently"),
+				},
+			},
+			Delete: &Operation{
+				OperationID: "deleteGroup",
+				Summary:     "Deletes a group",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"204": response("group deleted", nil),
+					"403": errorResponse("not allowed to manage a thing of the group"),
+					"404": errorResponse("unknown group"),
+					"409": errorResponse("group has sub-groups"),
+				},
+			},
+		},
+		"/groups/{groupID}/properties": {
+			Parameters: []*Parameter{groupIDParam},
+			Post: &Operation{
+				OperationID: "setGroupProperties",
+				Summary:     "Sets a property of all things in the group and its sub-groups",
+				Tags:        []string{"groups"},
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: jsonContent(&schema.Schema{
+						Type: "object",
+						Properties: map[string]*schema.Schema{
+							"property":     {Type: "string"},
+							"propertyType": {Type: "string"},
+							"value":        {},
+						},
+						Required: []string{"value"},
+					}),
+				},
+				Responses: map[string]*Response{
+					"202": response("set requests published", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"207": response("some set requests failed", &schema.Schema{Type: "array", Items: ref("ItemResult")}),
+					"400": errorResponse("invalid request"),
+					"404": errorResponse("unknown group"),
+				},
+			},
+		},
+		"/groups/{groupID}/things": {
+			Parameters: []*Parameter{groupIDParam},
+			Get: &Operation{
+				OperationID: "getGroupThings",
+				Summary:     "Returns all things in the group and its sub-groups",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"200": response("list of things", &schema.Schema{Type: "array", Items: ref("Thing")}),
+					"404": errorResponse("unknown group"),
+				},
+			},
+		},
+		"/groups/{groupID}/things/{thingID}": {
+			Parameters: []*Parameter{groupIDParam, thingIDParam},
+			Put: &Operation{
+				OperationID: "addGroupThing",
+				Summary:     "Adds a thing to a group",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"204": response("thing added", nil),
+					"404": errorResponse("unknown group or thing"),
+				},
+			},
+			Delete: &Operation{
+				OperationID: "removeGroupThing",
+				Summary:     "Removes a thing from a group",
+				Tags:        []string{"groups"},
+				Responses: map[string]*Response{
+					"204": response("thing removed", nil),
+					"404": errorResponse("unknown group or thing is not a member"),
+				},
+			},
+		},
+		"/audit": {
+			Get: &Operation{
+				OperationID: "getAuditLog",
+				Summary:     "Returns audit log entries",
+				Tags:        []string{"audit"},
+				Parameters: []*Parameter{
+					query("thing", "only return entries of this thing"),
+					query("group", "only return entries of this group"),
+					query("property", "only return entries of this property"),
+					query("principal", "only return entries of this principal"),
+					query("kind", "only return entries of this kind"),
+					query("since", "RFC3339 timestamp of the oldest entry"),
+					query("until", "RFC3339 timestamp of the newest entry"),
+					query("limit", "maximum number of entries"),
+				},
+				Responses: map[string]*Response{
+					"200": response("audit log entries", &schema.Schema{Type: "array", Items: ref("AuditEntry")}),
+					"404": errorResponse("audit log disabled"),
+				},
+			},
+		},
+		"/tokens": {
+			Get: &Operation{
+				OperationID: "getTokens",
+				Summary:     "Returns all API tokens",
+				Tags:        []string{"tokens"},
+				Responses: map[string]*Response{
+					"200": response("API tokens", &schema.Schema{Type: "array", Items: ref("Token")}),
+					"403": errorResponse("access is restricted by rules"),
+				},
+			},
+			Post: &Operation{
+				OperationID: "createToken",
+				Summary:     "Creates a new API token that is kept until the gateway restarts",
+				Tags:        []string{"tokens"},
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: jsonContent(&schema.Schema{
+						Type: "object",
+						Properties: map[string]*schema.Schema{
+							"name":   {Type: "string"},
+							"scopes": {Type: "array", Items: &schema.Schema{Type: "string", Enum: []interface{}{"read", "write", "admin"}}},
+						},
+						Required: []string{"name"},
+					}),
+				},
+				Responses: map[string]*Response{
+					"201": response("token created", ref("Token")),
+					"400": errorResponse("invalid request"),
+					"403": errorResponse("access is restricted by rules"),
+					"409": errorResponse("token name already in use"),
+				},
+			},
+		},
+		"/tokens/{tokenID}": {
+			Parameters: []*Parameter{tokenIDParam},
+			Delete: &Operation{
+				OperationID: "deleteToken",
+				Summary:     "Deletes an API token",
+				Tags:        []string{"tokens"},
+				Responses: map[string]*Response{
+					"204": response("token deleted", nil),
+					"403": errorResponse("access is restricted by rules"),
+					"404": errorResponse("unknown token"),
+				},
+			},
+		},
+		"/payload/handlers": {
+			Get: &Operation{
+				OperationID: "getPayloadHandlers",
+				Summary:     "Returns all payload handler types and their options",
+				Tags:        []string{"payload"},
+				Responses: map[string]*Response{
+					"200": response("payload handler types", &schema.Schema{Type: "array", Items: &schema.Schema{Type: "object"}}),
+				},
+			},
+		},
+		"/payload/test": {
+			Post: &Operation{
+				OperationID: "testPayloadHandler",
+				Summary:     "Runs a payload handler against a sample payload",
+				Tags:        []string{"payload"},
+				RequestBody: &RequestBody{
+					Required: true,
+					Content: jsonContent(&schema.Schema{
+						Type: "object",
+						Properties: map[string]*schema.Schema{
+							"spec":     {Type: "object"},
+							"payload":  {Type: "string"},
+							"encoding": {Type: "string", Enum: []interface{}{"text", "base64", "hex"}},
+							"topic":    {Type: "string"},
+						},
+						Required: []string{"spec", "payload"},
+					}),
+				},
+				Responses: map[string]*Response{
+					"200": response("handler result", &schema.Schema{
+						Type: "object",
+						Properties: map[string]*schema.Schema{
+							"value": {},
+							"error": {Type: "string"},
+						},
+					}),
+					"400": errorResponse("invalid request"),
+				},
+			},
+		},
+		"/openapi.json": {
+			Get: &Operation{
+				OperationID: "getOpenAPI",
+				Summary:     "Returns this document",
+				Tags:        []string{"meta"},
+				Responses: map[string]*Response{
+					"200": response("OpenAPI document", &schema.Schema{Type: "object"}),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,322 @@
+package binary
+
+import (
+	"encoding/base64"
+	bin "encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// sizes holds the number of bytes required for each supported field type
+var sizes = map[string]int{
+	"u8":      1,
+	"u16":     2,
+	"u32":     4,
+	"u64":     8,
+	"i8":      1,
+	"i16":     2,
+	"i32":     4,
+	"i64":     8,
+	"float32": 4,
+	"float64": 8,
+}
+
+// Handler implements `payload.Handler` and decodes packed binary frames as
+// published by LoRa or BLE bridges. The following arguments are supported:
+//
+//		encoding: the encoding of the payload. One of raw (default), hex or base64
+//		endian:   the default byte order of all fields. Either big (default) or little
+//		fields:   a list of fields to decode. If set, an object with all named fields
+//		          is returned. Otherwise a single field is decoded from the
+//		          top-level arguments and returned as a number
+//
+// Each field supports the following arguments:
+//
+//		name:   the name of the field (required for `fields`)
+//		offset: the byte offset of the field inside the frame (defaults to 0)
+//		format: one of u8, u16, u32, u64, i8, i16, i32, i64, float32 or float64
+//		endian: the byte order of the field
+//		mask:   a bit mask applied to the raw value (integer types only). It may be
+//		        specified as a number or as a string like "0x3fff". Signed
+//		        values are sign-extended at the highest bit of the mask
+//		shift:  number of bits the masked value is shifted to the right. At
+//		        least one bit of the (masked) value must remain
+//		scale:  a factor the decoded value is multiplied with
+//
+type Handler struct{}
+
+type field struct {
+	name   string
+	offset int
+	typ    string
+	order  bin.ByteOrder
+	mask   uint64
+	shift  uint
+	scale  float64
+}
+
+// Parse parses the given payload and returns the extracted value. It implements
+// the `Parse()` method of `payload.Handler`
+func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	frame, err := decodeFrame(body, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := getByteOrder(cfg, bin.BigEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldList, ok := cfg["fields"]
+	if !ok {
+		f, err := parseField(cfg, order)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.decode(frame)
+	}
+
+	specs, ok := fieldList.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("`fields` argument must be a list")
+	}
+
+	result := make(map[string]interface{}, len(specs))
+	for idx, s := range specs {
+		m, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("fields[%d]: must be an object", idx)
+		}
+
+		f, err := parseField(payload.HandlerSpec(m), order)
+		if err != nil {
+			return nil, fmt.Errorf("fields[%d]: %s", idx, err.Error())
+		}
+
+		if f.name == "" {
+			return nil, fmt.Errorf("fields[%d]: `name` argument is required", idx)
+		}
+
+		value, err := f.decode(frame)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.name, err.Error())
+		}
+
+		result[f.name] = value
+	}
+
+	return result, nil
+}
+
+// decodeFrame decodes the payload according to the `encoding` argument
+func decodeFrame(body []byte, cfg payload.HandlerSpec) ([]byte, error) {
+	encoding := "raw"
+	if e, ok := cfg["encoding"]; ok {
+		es, oks := e.(string)
+		if !oks {
+			return nil, fmt.Errorf("`encoding` argument must be a string")
+		}
+
+		encoding = es
+	}
+
+	switch encoding {
+	case "raw":
+		return body, nil
+	case "hex":
+		// allow whitespace between bytes like "cb f6 0b"
+		return hex.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+	}
+
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+func getByteOrder(cfg payload.HandlerSpec, def bin.ByteOrder) (bin.ByteOrder, error) {
+	e, ok := cfg["endian"]
+	if !ok {
+		return def, nil
+	}
+
+	switch e {
+	case "big":
+		return bin.BigEndian, nil
+	case "little":
+		return bin.LittleEndian, nil
+	}
+
+	return nil, fmt.Errorf("`endian` argument must be either big or little")
+}
+
+func parseField(cfg payload.HandlerSpec, defaultOrder bin.ByteOrder) (*field, error) {
+	f := &field{
+		scale: 1,
+	}
+
+	if n, ok := cfg["name"]; ok {
+		ns, oks := n.(string)
+		if !oks {
+			return nil, fmt.Errorf("`name` argument must be a string")
+		}
+		f.name = ns
+	}
+
+	offset, hasOffset, isNumber := cfg.GetInt("offset")
+	if hasOffset && (!isNumber || offset < 0) {
+		return nil, fmt.Errorf("`offset` argument must be a positive number")
+	}
+	f.offset = offset
+
+	// we cannot use `type` here as it already holds the handler type
+	t, ok := cfg["format"].(string)
+	if !ok {
+		return nil, fmt.Errorf("`format` argument must be a string")
+	}
+
+	if _, ok := sizes[t]; !ok {
+		return nil, fmt.Errorf("unsupported field format: %s", t)
+	}
+	f.typ = t
+
+	order, err := getByteOrder(cfg, defaultOrder)
+	if err != nil {
+		return nil, err
+	}
+	f.order = order
+
+	if m, ok := cfg["mask"]; ok {
+		if strings.HasPrefix(t, "float") {
+			return nil, fmt.Errorf("`mask` argument not supported for %s", t)
+		}
+
+		mask, err := toUint(m)
+		if err != nil {
+			return nil, fmt.Errorf("`mask` argument: %s", err.Error())
+		}
+		f.mask = mask
+	}
+
+	shift, hasShift, isNumber := cfg.GetInt("shift")
+	if hasShift && (!isNumber || shift < 0 || shift > 63) {
+		return nil, fmt.Errorf("`shift` argument must be a number between 0 and 63")
+	}
+	f.shift = uint(shift)
+
+	// reject masks and shifts that leave no bits of the raw value as the
+	// field would silently decode to zero
+	if !strings.HasPrefix(t, "float") {
+		valueBits := uint64(1)<<uint(sizes[t]*8) - 1
+		if f.mask != 0 {
+			valueBits &= f.mask
+		}
+
+		if valueBits>>f.shift == 0 {
+			return nil, fmt.Errorf("`mask` and `shift` arguments leave no bits of %s", t)
+		}
+	}
+
+	if s, ok := cfg["scale"]; ok {
+		scale, oks := s.(float64)
+		if !oks {
+			if i, oki := s.(int); oki {
+				scale, oks = float64(i), true
+			}
+		}
+
+		if !oks {
+			return nil, fmt.Errorf("`scale` argument must be a number")
+		}
+		f.scale = scale
+	}
+
+	return f, nil
+}
+
+func toUint(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case float64:
+		return uint64(n), nil
+	case int:
+		return uint64(n), nil
+	case string:
+		return strconv.ParseUint(n, 0, 64)
+	}
+
+	return 0, fmt.Errorf("must be a number or a string")
+}
+
+// decode decodes the field from frame and returns the scaled value
+func (f *field) decode(frame []byte) (float64, error) {
+	size := sizes[f.typ]
+	if len(frame) < f.offset+size {
+		return 0, fmt.Errorf("frame too short: need %d bytes at offset %d but got %d bytes", size, f.offset, len(frame))
+	}
+
+	b := frame[f.offset : f.offset+size]
+
+	var raw uint64
+	switch size {
+	case 1:
+		raw = uint64(b[0])
+	case 2:
+		raw = uint64(f.order.Uint16(b))
+	case 4:
+		raw = uint64(f.order.Uint32(b))
+	case 8:
+		raw = f.order.Uint64(b)
+	}
+
+	var value float64
+	switch f.typ {
+	case "float32":
+		value = float64(math.Float32frombits(uint32(raw)))
+	case "float64":
+		value = math.Float64frombits(raw)
+	default:
+		if f.mask != 0 {
+			raw = raw & f.mask
+		}
+		raw = raw >> f.shift
+
+		if strings.HasPrefix(f.typ, "i") {
+			// sign-extend the value based on the width of the type or
+			// the masked bits
+			width := uint(size * 8)
+			if f.mask != 0 {
+				width = uint(bits.Len64(f.mask >> f.shift))
+			}
+			value = float64(int64(raw<<(64-width)) >> (64 - width))
+		} else {
+			value = float64(raw)
+		}
+	}
+
+	return value * f.scale, nil
+}
+
+// Options implements payload.Describer
+func (h Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "encoding", Type: []string{"string"}, Description: "encoding of the payload: raw (default), hex or base64"},
+		{Name: "endian", Type: []string{"string"}, Description: "default byte order: big (default) or little"},
+		{Name: "fields", Type: []string{"array"}, Description: "list of fields to decode into an object"},
+		{Name: "offset", Type: []string{"number"}, Description: "byte offset of the field"},
+		{Name: "format", Type: []string{"string"}, Description: "one of u8, u16, u32, u64, i8, i16, i32, i64, float32 or float64"},
+		{Name: "mask", Type: []string{"number", "string"}, Description: "bit mask applied to the raw value"},
+		{Name: "shift", Type: []string{"number"}, Description: "number of bits the masked value is shifted to the right"},
+		{Name: "scale", Type: []string{"number"}, Description: "factor the decoded value is multiplied with"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("binary", Handler{})
+}
@@ -0,0 +1,219 @@
+package binary
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+// Dragino LHT65 uplink: battery (mV, upper two bits are status flags),
+// temperature (0.01 °C), humidity (0.1 %), external sensor type and value
+const lht65Frame = "CBF60B0D0376010ADD7FFF"
+
+// RuuviTag RAWv2 (data format 5) advertisement
+const ruuviFrame = "0512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"
+
+func Test_BinaryHandler(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "battery", "offset": 0, "format": "u16", "mask": "0x3fff"},
+					map[string]interface{}{"name": "status", "offset": 0, "format": "u8", "mask": 0xc0, "shift": 6},
+					map[string]interface{}{"name": "temperature", "offset": 2, "format": "i16", "scale": 0.01},
+					map[string]interface{}{"name": "humidity", "offset": 4, "format": "u16", "scale": 0.1},
+					map[string]interface{}{"name": "external", "offset": 9, "format": "i16"},
+				},
+			},
+			lht65Frame,
+			map[string]interface{}{
+				"battery":     3062.0,
+				"status":      3.0,
+				"temperature": 28.29,
+				"humidity":    88.60000000000001,
+				"external":    32767.0,
+			},
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"offset":   2,
+				"format":   "i16",
+				"scale":    0.01,
+			},
+			"cb f6 0b 0d",
+			28.29,
+			false,
+		},
+		{
+			// signed values narrower than the type are sign-extended at
+			// the width of the mask
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "temperature", "offset": 0, "format": "i16", "mask": 0x0fff, "scale": 0.1},
+					map[string]interface{}{"name": "offset", "offset": 2, "format": "i8", "mask": 0xf0, "shift": 4},
+					map[string]interface{}{"name": "positive", "offset": 2, "format": "i8", "mask": 0x0f},
+				},
+			},
+			"aff6e3",
+			map[string]interface{}{
+				"temperature": -1.0,
+				"offset":      -2.0,
+				"positive":    3.0,
+			},
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "temperature", "offset": 1, "format": "i16", "scale": 0.005},
+					map[string]interface{}{"name": "humidity", "offset": 3, "format": "u16", "scale": 0.0025},
+					map[string]interface{}{"name": "accelerationY", "offset": 9, "format": "i16"},
+				},
+			},
+			ruuviFrame,
+			map[string]interface{}{
+				"temperature":   24.3,
+				"humidity":      53.49,
+				"accelerationY": -4.0,
+			},
+			false,
+		},
+		{
+			// little endian float32 (21.5) followed by an u32 counter
+			payload.HandlerSpec{
+				"encoding": "base64",
+				"endian":   "little",
+				"fields": []interface{}{
+					map[string]interface{}{"name": "temperature", "format": "float32"},
+					map[string]interface{}{"name": "counter", "offset": 4, "format": "u32"},
+					map[string]interface{}{"name": "counterBE", "offset": 4, "format": "u32", "endian": "big"},
+				},
+			},
+			"AACsQQEAAAA=",
+			map[string]interface{}{
+				"temperature": 21.5,
+				"counter":     1.0,
+				"counterBE":   16777216.0,
+			},
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"format": "u8",
+				"offset": 1,
+			},
+			"\x01\xff",
+			255.0,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"format": "i8",
+				"offset": 1,
+			},
+			"\x01\xff",
+			-1.0,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"offset":   10,
+				"format":   "u16",
+			},
+			lht65Frame,
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"format":   "u24",
+			},
+			lht65Frame,
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"encoding": "hex",
+				"format":   "u8",
+			},
+			"xyz",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"format": "float32",
+				"mask":   0xff,
+			},
+			"\x00\x00\x00\x00",
+			nil,
+			true,
+		},
+		{
+			// the mask is narrower than the shift
+			payload.HandlerSpec{
+				"format": "i8",
+				"mask":   0x0f,
+				"shift":  4,
+			},
+			"\xff",
+			nil,
+			true,
+		},
+		{
+			// the mask selects bits outside of the format
+			payload.HandlerSpec{
+				"format": "u8",
+				"mask":   0xff00,
+			},
+			"\xff",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"format": "u16",
+				"shift":  16,
+			},
+			"\xff\xff",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"fields": []interface{}{
+					map[string]interface{}{"format": "u8"},
+				},
+			},
+			"\x00",
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "binary"
+
+		res, err := c.m.Parse([]byte(c.i))
+		if c.err {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package cbor
+
+import (
+	"github.com/fxamacker/cbor"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload/json"
+)
+
+// Handler is a `payload.Handler` and `payload.MessageHandler` that decodes
+// CBOR (RFC 7049) payloads. It supports the same `path` argument as the
+// json handler
+type Handler struct{}
+
+// Parse implements the `Parse()` method of `payload.Handler`
+func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage implements the `ParseMessage()` method of `payload.MessageHandler`
+func (h Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	var x interface{}
+	if err := cbor.Unmarshal(msg.Payload, &x); err != nil {
+		return nil, err
+	}
+
+	return json.Extract(msg, payload.Normalize(x), cfg)
+}
+
+// Encode encodes value as CBOR
+func Encode(value interface{}) ([]byte, error) {
+	return cbor.Marshal(value, cbor.EncOptions{})
+}
+
+// Options implements payload.Describer
+func (h Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "path", Type: []string{"string"}, Description: "JSONPath of the value to extract. May be a template"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("cbor", Handler{})
+	payload.MustRegisterEncoding("cbor", Encode)
+}
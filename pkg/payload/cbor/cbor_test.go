@@ -0,0 +1,65 @@
+package cbor
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CborHandler(t *testing.T) {
+	cases := []struct {
+		name string
+		i    []byte
+		m    payload.HandlerSpec
+		o    interface{}
+		err  bool
+	}{
+		// integers of all widths are returned as float64
+		{"negative integer", []byte{0x38, 0x63}, nil, -100.0, false},
+		{"uint32", []byte{0x1a, 0x5d, 0x47, 0x3a, 0x40}, nil, 1564949056.0, false},
+		{"half-precision float", []byte{0xf9, 0x3c, 0x00}, nil, 1.0, false},
+
+		// byte strings are kept while tagged values are unwrapped
+		{"byte string", []byte{0x43, 0x01, 0x02, 0x03}, nil, []byte{0x01, 0x02, 0x03}, false},
+		{"epoch time tag", []byte{0xc1, 0x1a, 0x5d, 0x47, 0x3a, 0x40}, nil, 1564949056.0, false},
+		{"URI tag", []byte{0xd8, 0x20, 0x63, 'a', 'b', 'c'}, nil, "abc", false},
+
+		// keys of maps are converted to strings so they can be selected
+		{"integer keys", []byte{0xa1, 0x01, 0x63, 'o', 'n', 'e'}, payload.HandlerSpec{"path": `$["1"]`}, "one", false},
+		{"indefinite array", []byte{0x9f, 0x01, 0x02, 0xff}, payload.HandlerSpec{"path": "$[1]"}, 2.0, false},
+		{"missing path", []byte{0xa1, 0x01, 0x63, 'o', 'n', 'e'}, payload.HandlerSpec{"path": "$.two"}, nil, true},
+		{"invalid path", []byte{0x01}, payload.HandlerSpec{"path": 1}, nil, true},
+
+		// invalid input
+		{"truncated array", []byte{0x82, 0x01}, nil, nil, true},
+		{"byte string key", []byte{0xa1, 0x43, 0x01, 0x02, 0x03, 0x01}, nil, nil, true},
+		{"reserved additional information", []byte{0x1c}, nil, nil, true},
+		{"empty payload", nil, nil, nil, true},
+	}
+
+	for _, c := range cases {
+		spec := payload.HandlerSpec{"type": "cbor"}
+		for key, value := range c.m {
+			spec[key] = value
+		}
+
+		res, err := spec.Parse(c.i)
+		if c.err {
+			assert.NotNil(t, err, c.name)
+		} else {
+			assert.Nil(t, err, c.name)
+			assert.Equal(t, c.o, res, c.name)
+		}
+	}
+}
+
+func Test_CborEncode(t *testing.T) {
+	blob, err := payload.Encode("cbor", map[string]interface{}{"on": true})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xa1, 0x62, 'o', 'n', 0xf5}, blob)
+
+	blob, err = payload.Encode("cbor", []byte{0x01})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x41, 0x01}, blob)
+}
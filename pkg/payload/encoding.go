@@ -0,0 +1,76 @@
+package payload
+
+import (
+	"sort"
+	"sync"
+)
+
+// Encoder encodes a value into a message payload
+type Encoder func(value interface{}) ([]byte, error)
+
+var encoders map[string]Encoder
+var encodersLock sync.RWMutex
+
+// RegisterEncoding registers a new payload encoding that can be used to
+// encode set requests. Each encoding must have a unique name
+func RegisterEncoding(name string, enc Encoder) error {
+	encodersLock.Lock()
+	defer encodersLock.Unlock()
+
+	if encoders == nil {
+		encoders = make(map[string]Encoder)
+	}
+
+	if _, ok := encoders[name]; ok {
+		return ErrAlreadyRegistered
+	}
+
+	encoders[name] = enc
+
+	return nil
+}
+
+// MustRegisterEncoding registers a new payload encoding. It panics if the
+// encoding is already registered
+func MustRegisterEncoding(name string, enc Encoder) {
+	if err := RegisterEncoding(name, enc); err != nil {
+		panic(err)
+	}
+}
+
+// IsValidEncoding returns true if an encoding with the given name has
+// been registered
+func IsValidEncoding(name string) bool {
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+
+	_, ok := encoders[name]
+	return ok
+}
+
+// Encodings returns the names of all registered encodings sorted by name
+func Encodings() []string {
+	encodersLock.RLock()
+	defer encodersLock.RUnlock()
+
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Encode encodes value using the encoding name
+func Encode(name string, value interface{}) ([]byte, error) {
+	encodersLock.RLock()
+	enc, ok := encoders[name]
+	encodersLock.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownEncoding
+	}
+
+	return enc(value)
+}
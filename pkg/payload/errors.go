@@ -8,7 +8,10 @@ import (
 
 // Common errors
 var (
-	ErrNoType            = errors.NewWithStatus(http.StatusBadRequest, "no handler type")
-	ErrInvalidType       = errors.NewWithStatus(http.StatusBadRequest, "invalid handler type")
-	ErrAlreadyRegistered = errors.NewWithStatus(http.StatusInternalServerError, "handler type already registered")
+	ErrNoType                = errors.NewWithStatus(http.StatusBadRequest, "no handler type")
+	ErrInvalidType           = errors.NewWithStatus(http.StatusBadRequest, "invalid handler type")
+	ErrAlreadyRegistered     = errors.NewWithStatus(http.StatusInternalServerError, "handler type already registered")
+	ErrDropped               = errors.NewWithStatus(http.StatusUnprocessableEntity, "message dropped by handler")
+	ErrUnknownEncoding       = errors.NewWithStatus(http.StatusBadRequest, "unknown payload encoding")
+	ErrUnknownSampleEncoding = errors.NewWithStatus(http.StatusBadRequest, "unknown sample encoding")
 )
@@ -1,8 +1,14 @@
 package payload
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"sync"
+	"text/template"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
 )
 
 // HandlerType identifies a handler type by name
@@ -18,9 +24,148 @@ type Handler interface {
 	Parse(payload []byte, cfg HandlerSpec) (interface{}, error)
 }
 
+// Message holds a payload together with additional information about
+// the MQTT message it has been received with
+type Message struct {
+	// Payload holds the raw message payload
+	Payload []byte
+
+	// Topic holds the MQTT topic the message has been received on
+	Topic string
+
+	// Segments holds the topic split at each level separator
+	Segments []string
+
+	// Captures holds the topic levels matched by named wildcards of the
+	// subscription
+	Captures map[string]string
+
+	// Retained is set to true if the message has the retained flag set
+	Retained bool
+
+	// QoS holds the quality-of-service level of the message
+	QoS byte
+
+	// Timestamp holds the time the message has been received
+	Timestamp time.Time
+
+	// ThingID holds the ID of the thing the message is parsed for
+	ThingID string
+
+	// PropertyID holds the ID of the property the message is parsed for
+	PropertyID string
+
+	// Previous holds the last value stored for the property, if any
+	Previous interface{}
+}
+
+// Key identifies the source of the message and may be used by handlers
+// to keep state across invocations. It returns an empty string if neither
+// a thing nor a property ID is set
+func (msg *Message) Key() string {
+	if msg.ThingID == "" && msg.PropertyID == "" {
+		return ""
+	}
+
+	return msg.ThingID + "/" + msg.PropertyID
+}
+
+// TemplateContext returns the context that is used when rendering handler
+// options with Render
+func (msg *Message) TemplateContext() map[string]interface{} {
+	thing := map[string]interface{}{"ID": msg.ThingID}
+	property := map[string]interface{}{"ID": msg.PropertyID}
+
+	return map[string]interface{}{
+		"Thing":     thing,
+		"thing":     thing,
+		"Item":      property,
+		"item":      property,
+		"property":  property,
+		"topic":     msg.Topic,
+		"segments":  msg.Segments,
+		"captures":  msg.Captures,
+		"retained":  msg.Retained,
+		"qos":       msg.QoS,
+		"timestamp": msg.Timestamp,
+	}
+}
+
+// Render renders tmpl as a text/template using the message context.
+// Strings that do not contain template actions are returned as they are.
+// The provided thing and property IDs are accessible via .thing.ID and
+// .property.ID (or .item.ID to match topic templates)
+//
+// Example:
+//
+//		path, err := msg.Render("$.{{.property.ID}}")
+//
+func (msg *Message) Render(tmpl string) (string, error) {
+	if msg == nil || !strings.Contains(tmpl, "{{") {
+		return tmpl, nil
+	}
+
+	var t *template.Template
+	if cached, ok := templateCache.Get(tmpl); ok {
+		t = cached.(*template.Template)
+	} else {
+		var err error
+		t, err = template.New(tmpl).Parse(tmpl)
+		if err != nil {
+			return "", err
+		}
+		templateCache.Add(tmpl, t)
+	}
+
+	var res bytes.Buffer
+	if err := t.Execute(&res, msg.TemplateContext()); err != nil {
+		return "", err
+	}
+
+	return res.String(), nil
+}
+
+// maxCachedTemplates is the number of parsed templates kept by Render
+const maxCachedTemplates = 256
+
+// templateCache holds parsed templates. lru.New only fails for non-positive
+// sizes
+var templateCache, _ = lru.New(maxCachedTemplates)
+
+// MessageHandler is a Handler that makes use of the additional information
+// provided by Message
+type MessageHandler interface {
+	Handler
+
+	// ParseMessage should parse the message payload and return the extracted
+	// value or an error. If the message should be ignored ErrDropped must be
+	// returned
+	ParseMessage(msg *Message, cfg HandlerSpec) (interface{}, error)
+}
+
+// Forgetter is implemented by handlers that keep state across invocations
+// for the same message source
+type Forgetter interface {
+	// Forget drops all state kept for messages of the thing thingID
+	Forget(thingID string)
+}
+
 var handlers map[HandlerType]Handler
 var handlersLock sync.RWMutex
 
+// Forget drops the state all registered handlers keep for thingID. It
+// should be called when a thing is updated or deleted
+func Forget(thingID string) {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+
+	for _, h := range handlers {
+		if f, ok := h.(Forgetter); ok {
+			f.Forget(thingID)
+		}
+	}
+}
+
 // RegisterType registers a new handler type. Each handler type must have
 // a unique name
 func RegisterType(name HandlerType, h Handler) error {
@@ -127,6 +272,31 @@ func (h HandlerSpec) Parse(payload []byte) (res interface{}, err error) {
 	return res, err
 }
 
+// ParseMessage tries to parse the given message. Handlers that do not implement
+// MessageHandler only get access to the message payload
+func (h HandlerSpec) ParseMessage(msg *Message) (res interface{}, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			if e, ok := x.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", x)
+			}
+		}
+	}()
+
+	handler, err := h.Handler()
+	if err != nil {
+		return nil, err
+	}
+
+	if mh, ok := handler.(MessageHandler); ok {
+		return mh.ParseMessage(msg, h)
+	}
+
+	return handler.Parse(msg.Payload, h)
+}
+
 // GetInt returns an integer from the HandlerSpec with the specified key
 // The return values represent the number, if the key was set and if the
 // key was actually a number.
@@ -153,3 +323,43 @@ func (h HandlerSpec) GetInt(key string) (int, bool, bool) {
 
 	return 0, true, false
 }
+
+// GetDuration returns the duration stored at key. Numbers are interpreted
+// as milliseconds and strings are parsed using time.ParseDuration. The
+// second return value reports whether key has been set at all.
+//
+// Example:
+//
+//		timeout, ok, err := h.GetDuration("timeout")
+//
+func (h HandlerSpec) GetDuration(key string) (time.Duration, bool, error) {
+	ms, ok, isNumber := h.GetInt(key)
+	if !ok {
+		return 0, false, nil
+	}
+
+	if isNumber {
+		return time.Duration(ms) * time.Millisecond, true, nil
+	}
+
+	s, isString := h[key].(string)
+	if !isString {
+		return 0, true, fmt.Errorf("`%s` must be a number or a duration string", key)
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, true, err
+	}
+
+	return d, true, nil
+}
+
+// LimitDuration reduces the duration stored at key to max. Values that
+// cannot be parsed are kept so the handler can report them
+func (h HandlerSpec) LimitDuration(key string, max time.Duration) {
+	d, ok, err := h.GetDuration(key)
+	if ok && err == nil && d > max {
+		h[key] = max.String()
+	}
+}
@@ -0,0 +1,99 @@
+package payload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HandlerSpecGetDuration(t *testing.T) {
+	cases := []struct {
+		v   interface{}
+		o   time.Duration
+		ok  bool
+		err bool
+	}{
+		{nil, 0, false, false},
+		{250, 250 * time.Millisecond, true, false},
+		{float64(1500), 1500 * time.Millisecond, true, false},
+		{"2s", 2 * time.Second, true, false},
+		{"soon", 0, true, true},
+		{true, 0, true, true},
+	}
+
+	for _, c := range cases {
+		spec := HandlerSpec{}
+		if c.v != nil {
+			spec["timeout"] = c.v
+		}
+
+		d, ok, err := spec.GetDuration("timeout")
+		assert.Equal(t, c.ok, ok, "%v", c.v)
+		assert.Equal(t, c.err, err != nil, "%v", c.v)
+		assert.Equal(t, c.o, d, "%v", c.v)
+	}
+}
+
+func Test_HandlerSpecLimitDuration(t *testing.T) {
+	cases := []struct {
+		v interface{}
+		o interface{}
+	}{
+		{500, 500},
+		{"10s", "1s"},
+		{5000, "1s"},
+		{"soon", "soon"},
+	}
+
+	for _, c := range cases {
+		spec := HandlerSpec{"timeout": c.v}
+		spec.LimitDuration("timeout", time.Second)
+		assert.Equal(t, c.o, spec["timeout"], "%v", c.v)
+	}
+
+	spec := HandlerSpec{}
+	spec.LimitDuration("timeout", time.Second)
+	assert.NotContains(t, spec, "timeout")
+
+	var nilSpec HandlerSpec
+	nilSpec.LimitDuration("timeout", time.Second)
+}
+
+func Test_MessageRender(t *testing.T) {
+	msg := &Message{
+		Topic:      "tele/plug/SENSOR",
+		Segments:   []string{"tele", "plug", "SENSOR"},
+		Captures:   map[string]string{"device": "plug"},
+		ThingID:    "thing",
+		PropertyID: "prop",
+	}
+
+	cases := []struct {
+		i   string
+		o   string
+		err bool
+	}{
+		{"$.value", "$.value", false},
+		{"$.{{.property.ID}}", "$.prop", false},
+		{"{{.thing.ID}}/{{.item.ID}}", "thing/prop", false},
+		{"{{index .segments 1}}-{{.captures.device}}", "plug-plug", false},
+		{"{{.topic}}", "tele/plug/SENSOR", false},
+		{"{{.topic", "", true},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 2; i++ {
+			// the second iteration uses the cached template
+			res, err := msg.Render(c.i)
+			if c.err {
+				assert.NotNil(t, err, c.i)
+			} else {
+				assert.Nil(t, err, c.i)
+				assert.Equal(t, c.o, res, c.i)
+			}
+		}
+	}
+
+	assert.True(t, templateCache.Len() <= maxCachedTemplates)
+}
@@ -0,0 +1,179 @@
+package jq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/itchyny/gojq"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// DefaultTimeout is the maximum time a query may run
+const DefaultTimeout = time.Second
+
+// MaxResults is the maximum number of results collected if `all` is set.
+// Queries that produce more results fail
+const MaxResults = 1000
+
+// variables holds the names of all variables that are available to queries.
+// The order must match the values passed in ParseMessage
+var variables = []string{
+	"$topic",
+	"$segments",
+	"$captures",
+	"$thing",
+	"$property",
+	"$previous",
+}
+
+// Handler is a `payload.Handler` and `payload.MessageHandler` that evaluates
+// jq expressions against JSON payloads. The following arguments are supported:
+//
+//		query: the jq expression to evaluate (required). Besides the payload as
+//		       input the query has access to the message context using the
+//		       variables $topic, $segments, $captures, $thing, $property and
+//		       $previous
+//		all:   if true, all results are returned as an array. Otherwise only
+//		       the first result is returned. At most MaxResults results
+//		       are collected
+//
+// If the query does not produce any result the message is dropped
+type Handler struct {
+	codes *lru.Cache
+}
+
+// maxCachedQueries is the number of compiled queries kept by a handler
+const maxCachedQueries = 256
+
+// NewHandler returns a new jq handler
+func NewHandler() *Handler {
+	// lru.New only fails for non-positive sizes
+	codes, _ := lru.New(maxCachedQueries)
+
+	return &Handler{
+		codes: codes,
+	}
+}
+
+// Parse implements the `Parse()` method of `payload.Handler`
+func (h *Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage implements the `ParseMessage()` method of `payload.MessageHandler`
+func (h *Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	query, ok := cfg["query"].(string)
+	if !ok {
+		return nil, fmt.Errorf("`query` argument must be a string")
+	}
+
+	all := false
+	if a, ok := cfg["all"]; ok {
+		b, okb := a.(bool)
+		if !okb {
+			return nil, fmt.Errorf("`all` argument must be a boolean")
+		}
+		all = b
+	}
+
+	code, err := h.compile(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var x interface{}
+	if err := json.Unmarshal(msg.Payload, &x); err != nil {
+		return nil, err
+	}
+
+	segments := make([]interface{}, len(msg.Segments))
+	for idx, s := range msg.Segments {
+		segments[idx] = s
+	}
+
+	captures := make(map[string]interface{}, len(msg.Captures))
+	for name, value := range msg.Captures {
+		captures[name] = value
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	iter := code.RunWithContext(ctx, x,
+		msg.Topic,
+		segments,
+		captures,
+		msg.ThingID,
+		msg.PropertyID,
+		payload.Normalize(msg.Previous),
+	)
+
+	var results []interface{}
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+
+		if !all {
+			return v, nil
+		}
+
+		if len(results) == MaxResults {
+			return nil, fmt.Errorf("query produced more than %d results", MaxResults)
+		}
+
+		results = append(results, v)
+	}
+
+	if !all {
+		return nil, payload.ErrDropped
+	}
+
+	if results == nil {
+		results = []interface{}{}
+	}
+
+	return results, nil
+}
+
+// compile returns the cached compiled query or compiles and caches
+// a new one
+func (h *Handler) compile(query string) (*gojq.Code, error) {
+	if cached, ok := h.codes.Get(query); ok {
+		return cached.(*gojq.Code), nil
+	}
+
+	q, err := gojq.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := gojq.Compile(q, gojq.WithVariables(variables))
+	if err != nil {
+		return nil, err
+	}
+
+	h.codes.Add(query, code)
+
+	return code, nil
+}
+
+// Options implements payload.Describer
+func (h *Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "query", Type: []string{"string"}, Description: "jq query evaluated against the decoded payload", Required: true},
+		{Name: "all", Type: []string{"boolean"}, Description: "return all results as an array"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("jq", NewHandler())
+}
@@ -0,0 +1,59 @@
+package jq
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JQHandler(t *testing.T) {
+	msg := &payload.Message{
+		Payload:    []byte(`{"val": 1.5, "sensors": [{"id": "a", "t": 20}, {"id": "b", "t": 22}]}`),
+		Topic:      "tele/plug/SENSOR",
+		Segments:   []string{"tele", "plug", "SENSOR"},
+		Captures:   map[string]string{"device": "plug"},
+		ThingID:    "plug",
+		PropertyID: "power",
+		Previous:   int64(2),
+	}
+
+	cases := []struct {
+		m   payload.HandlerSpec
+		o   interface{}
+		err error
+	}{
+		{payload.HandlerSpec{"query": ".val * 1000"}, 1500.0, nil},
+		{payload.HandlerSpec{"query": `.sensors[] | select(.id == "b") | .t`}, 22.0, nil},
+		{payload.HandlerSpec{"query": ".sensors[].t", "all": true}, []interface{}{20.0, 22.0}, nil},
+		{payload.HandlerSpec{"query": `"\($thing)/\($property): \(.val)"`}, "plug/power: 1.5", nil},
+		{payload.HandlerSpec{"query": `$segments[1] + "-" + $captures.device`}, "plug-plug", nil},
+		{payload.HandlerSpec{"query": ".val + $previous"}, 3.5, nil},
+		{payload.HandlerSpec{"query": `.sensors[] | select(.id == "c")`}, nil, payload.ErrDropped},
+		{payload.HandlerSpec{"query": `.sensors[] | select(.id == "c")`, "all": true}, []interface{}{}, nil},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "jq"
+
+		res, err := c.m.ParseMessage(msg)
+		assert.Equal(t, c.err, err)
+		assert.Equal(t, c.o, res)
+	}
+
+	for _, m := range []payload.HandlerSpec{
+		{"type": "jq"},
+		{"type": "jq", "query": ".val |"},
+		{"type": "jq", "query": ".val.x"},
+		{"type": "jq", "query": ".val", "all": "yes"},
+		{"type": "jq", "query": "range(infinite)", "all": true},
+		{"type": "jq", "query": "range(1001)", "all": true},
+	} {
+		_, err := m.ParseMessage(msg)
+		assert.NotNil(t, err, m["query"])
+	}
+
+	res, err := payload.HandlerSpec{"type": "jq", "query": "range(1000)", "all": true}.ParseMessage(msg)
+	assert.Nil(t, err)
+	assert.Len(t, res, MaxResults)
+}
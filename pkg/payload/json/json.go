@@ -8,43 +8,77 @@ import (
 	"github.com/yalp/jsonpath"
 )
 
-// Handler is a `payload.Handler`
+// Handler is a `payload.Handler` and `payload.MessageHandler`
 type Handler struct {
 	pathOverwrite string
 }
 
 // Parse implements the `Parse()` method of `payload.Handler`
-func (h *Handler) Parse(payload []byte, cfg payload.HandlerSpec) (interface{}, error) {
+func (h *Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage implements the `ParseMessage()` method of `payload.MessageHandler`.
+// The `path` argument may be a template that is rendered using the message
+// context (see payload.Message.Render)
+func (h *Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
 	var x interface{}
-	err := json.Unmarshal(payload, &x)
+	err := json.Unmarshal(msg.Payload, &x)
 	if err != nil {
 		return nil, err
 	}
 
-	path := "$"
 	if h.pathOverwrite != "" {
-		path = h.pathOverwrite
-
 		if _, ok := cfg["path"]; ok {
 			return nil, fmt.Errorf("`path` argument not supported")
 		}
-	} else {
-		p, ok := cfg["path"]
-		if ok {
-			ps, oks := p.(string)
-			if !oks {
-				return nil, fmt.Errorf("`path` argument must be a string")
-			}
-
-			path = ps
+
+		return jsonpath.Read(x, h.pathOverwrite)
+	}
+
+	return Extract(msg, x, cfg)
+}
+
+// Extract returns the value selected by the JSONPath in the `path` argument
+// of cfg from the decoded document x. If `path` is not set the whole document
+// is returned. It is shared by all handlers that decode to the same generic
+// structure as encoding/json (see payload.Normalize)
+func Extract(msg *payload.Message, x interface{}, cfg payload.HandlerSpec) (interface{}, error) {
+	path := "$"
+
+	p, ok := cfg["path"]
+	if ok {
+		ps, oks := p.(string)
+		if !oks {
+			return nil, fmt.Errorf("`path` argument must be a string")
+		}
+
+		var err error
+		path, err = msg.Render(ps)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	val, err := jsonpath.Read(x, path)
-	return val, err
+	return jsonpath.Read(x, path)
+}
+
+// Options implements payload.Describer
+func (h *Handler) Options() []payload.Option {
+	if h.pathOverwrite != "" {
+		return []payload.Option{}
+	}
+
+	return []payload.Option{
+		{Name: "path", Type: []string{"string"}, Description: "JSONPath of the value to extract. May be a template"},
+	}
 }
 
 func init() {
 	payload.MustRegisterType("json", &Handler{})
 	payload.MustRegisterType("json-extended", &Handler{"$.val"})
+
+	payload.MustRegisterEncoding("json", func(value interface{}) ([]byte, error) {
+		return json.Marshal(value)
+	})
 }
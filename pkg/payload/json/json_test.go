@@ -0,0 +1,52 @@
+package json
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JSONHandler(t *testing.T) {
+	msg := &payload.Message{
+		Topic:      "sensors/kitchen/temperature",
+		Segments:   []string{"sensors", "kitchen", "temperature"},
+		Captures:   map[string]string{"room": "kitchen"},
+		ThingID:    "thermometer",
+		PropertyID: "temperature",
+	}
+
+	doc := `{"kitchen": {"temperature": 21.5}, "bath": {"temperature": 19}, "val": true}`
+
+	cases := []struct {
+		h   *Handler
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{&Handler{}, payload.HandlerSpec{}, `{"a": 1}`, map[string]interface{}{"a": 1.0}, false},
+		{&Handler{}, payload.HandlerSpec{"path": "$.bath.temperature"}, doc, 19.0, false},
+		{&Handler{}, payload.HandlerSpec{"path": "$.{{index .segments 1}}.temperature"}, doc, 21.5, false},
+		{&Handler{}, payload.HandlerSpec{"path": "$.{{.captures.room}}.{{.property.ID}}"}, doc, 21.5, false},
+		{&Handler{}, payload.HandlerSpec{"path": "$.{{.captures.unknown}}"}, doc, nil, true},
+		{&Handler{}, payload.HandlerSpec{"path": "$.{{.captures.room"}, doc, nil, true},
+		{&Handler{}, payload.HandlerSpec{"path": 1}, doc, nil, true},
+		{&Handler{}, payload.HandlerSpec{}, `{"a": `, nil, true},
+		{&Handler{"$.val"}, payload.HandlerSpec{}, doc, true, false},
+		{&Handler{"$.val"}, payload.HandlerSpec{"path": "$.bath"}, doc, nil, true},
+	}
+
+	for _, c := range cases {
+		m := *msg
+		m.Payload = []byte(c.i)
+
+		res, err := c.h.ParseMessage(&m, c.m)
+		if c.err {
+			assert.NotNil(t, err, c.m)
+		} else {
+			assert.Nil(t, err, c.m)
+			assert.Equal(t, c.o, res, c.m)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package kv
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// CSVHandler implements `payload.Handler` and extracts values from CSV lines
+// like `21.3,40,ok`. If the payload contains multiple records the last one is
+// used. The following arguments are supported:
+//
+//		separator:  the field separator. Defaults to ","
+//		quote:      the quote character that may be used to enclose fields
+//		            containing separators or line breaks. Quotes within
+//		            quoted fields are doubled. Defaults to `"`, an empty
+//		            string disables quoting
+//		lazyQuotes: if true, quotes may appear in unquoted fields and
+//		            unescaped in quoted fields
+//		headers:    either a list of column names or true if the first record of
+//		            the payload holds the column names
+//		column:     the name of the column to extract (requires `headers`)
+//		index:      the index of the column to extract
+//		number:     if true, values are converted to numbers
+//
+// If neither `column` nor `index` is set all fields are returned, as an object
+// if headers are available or as an array otherwise.
+type CSVHandler struct{}
+
+// Parse parses the given payload and returns the extracted value. It implements
+// the `Parse()` method of `payload.Handler`
+func (h CSVHandler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	separator, err := getString(cfg, "separator", ",")
+	if err != nil {
+		return nil, err
+	}
+
+	if utf8.RuneCountInString(separator) != 1 {
+		return nil, fmt.Errorf("`separator` argument must be a single character")
+	}
+
+	quote, err := getString(cfg, "quote", `"`)
+	if err != nil {
+		return nil, err
+	}
+
+	if utf8.RuneCountInString(quote) > 1 || quote == separator || quote == "\n" {
+		return nil, fmt.Errorf("`quote` argument must be a single character other than the separator or empty")
+	}
+
+	lazyQuotes, err := getBool(cfg, "lazyQuotes")
+	if err != nil {
+		return nil, err
+	}
+
+	asNumber, err := getBool(cfg, "number")
+	if err != nil {
+		return nil, err
+	}
+
+	sep, _ := utf8.DecodeRuneInString(separator)
+	q, _ := utf8.DecodeRuneInString(quote)
+	if quote == "" {
+		q = 0
+	}
+
+	records, err := readRecords(string(body), sep, q, lazyQuotes)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers []string
+	switch v := cfg["headers"].(type) {
+	case nil:
+	case bool:
+		if v {
+			if len(records) < 2 {
+				return nil, fmt.Errorf("expected a header and at least one record")
+			}
+
+			headers = records[0]
+			records = records[1:]
+		}
+	case []interface{}:
+		for _, h := range v {
+			s, ok := h.(string)
+			if !ok {
+				return nil, fmt.Errorf("`headers` must only contain strings")
+			}
+			headers = append(headers, s)
+		}
+	default:
+		return nil, fmt.Errorf("`headers` argument must be a list or a boolean")
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no records")
+	}
+	record := records[len(records)-1]
+
+	index, hasIndex, isNumber := cfg.GetInt("index")
+	if hasIndex && !isNumber {
+		return nil, fmt.Errorf("`index` argument must be a number")
+	}
+
+	if c, ok := cfg["column"]; ok {
+		column, ok := c.(string)
+		if !ok {
+			return nil, fmt.Errorf("`column` argument must be a string")
+		}
+
+		index = -1
+		for idx, h := range headers {
+			if h == column {
+				index = idx
+				break
+			}
+		}
+
+		if index < 0 {
+			return nil, fmt.Errorf("unknown column: %s", column)
+		}
+		hasIndex = true
+	}
+
+	if hasIndex {
+		if index < 0 || index >= len(record) {
+			return nil, fmt.Errorf("index out of bounds")
+		}
+
+		return convert(record[index], asNumber)
+	}
+
+	if headers == nil {
+		values := make([]interface{}, len(record))
+		for idx, field := range record {
+			values[idx], err = convert(field, asNumber)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s", idx, err.Error())
+			}
+		}
+
+		return values, nil
+	}
+
+	values := make(map[string]interface{}, len(headers))
+	for idx, h := range headers {
+		if idx >= len(record) {
+			break
+		}
+
+		values[h], err = convert(record[idx], asNumber)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", h, err.Error())
+		}
+	}
+
+	return values, nil
+}
+
+// Options implements payload.Describer
+func (h CSVHandler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "separator", Type: []string{"string"}, Description: "field separator. Defaults to ,"},
+		{Name: "quote", Type: []string{"string"}, Description: "quote character for fields containing separators. Defaults to \". Empty disables quoting"},
+		{Name: "lazyQuotes", Type: []string{"boolean"}, Description: "allow quotes in unquoted fields and unescaped quotes in quoted fields"},
+		{Name: "headers", Type: []string{"array", "boolean"}, Description: "column names or true if the first record holds them"},
+		{Name: "column", Type: []string{"string"}, Description: "name of the column to extract"},
+		{Name: "index", Type: []string{"number"}, Description: "index of the column to extract"},
+		{Name: "number", Type: []string{"boolean"}, Description: "convert values to numbers"},
+	}
+}
+
+// readRecords splits s into records of fields. Fields may be enclosed in
+// quote (0 disables quoting) to contain separators and line breaks. Quotes
+// within quoted fields must be doubled unless lazyQuotes is set. Leading
+// white space of fields is ignored and empty lines are skipped
+func readRecords(s string, separator, quote rune, lazyQuotes bool) ([][]string, error) {
+	var (
+		records [][]string
+		record  []string
+		field   strings.Builder
+		runes   = []rune(strings.Replace(s, "\r\n", "\n", -1))
+		line    = 1
+		start   = 0
+		i       = 0
+	)
+
+	isEnd := func(i int) bool {
+		return i == len(runes) || runes[i] == separator || runes[i] == '\n'
+	}
+
+	for {
+		for !isEnd(i) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+
+		field.Reset()
+		quoted := quote != 0 && i < len(runes) && runes[i] == quote
+
+		if quoted {
+			i++
+
+			closed := false
+			for i < len(runes) && !closed {
+				r := runes[i]
+				i++
+
+				switch {
+				case r == quote && i < len(runes) && runes[i] == quote:
+					field.WriteRune(quote)
+					i++
+				case r == quote && isEnd(i):
+					closed = true
+				case r == quote && !lazyQuotes:
+					return nil, fmt.Errorf("line %d: extraneous %q in quoted field", line, quote)
+				default:
+					if r == '\n' {
+						line++
+					}
+					field.WriteRune(r)
+				}
+			}
+
+			if !closed && !lazyQuotes {
+				return nil, fmt.Errorf("line %d: missing closing %q", line, quote)
+			}
+		} else {
+			for ; !isEnd(i); i++ {
+				if runes[i] == quote && !lazyQuotes {
+					return nil, fmt.Errorf("line %d: bare %q in unquoted field", line, quote)
+				}
+				field.WriteRune(runes[i])
+			}
+		}
+
+		record = append(record, field.String())
+
+		if i < len(runes) && runes[i] == separator {
+			i++
+			continue
+		}
+
+		// end of record. Lines without any characters are skipped
+		if len(record) > 1 || quoted || i > start {
+			records = append(records, record)
+		}
+		record = nil
+
+		if i == len(runes) {
+			return records, nil
+		}
+
+		i++
+		line++
+		start = i
+	}
+}
@@ -0,0 +1,175 @@
+package kv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// KVHandler implements `payload.Handler` and extracts values from key/value
+// payloads like `temp=21.3;hum=40`. The following arguments are supported:
+//
+//		separator: the separator between pairs. Defaults to ";"
+//		assign:    the separator between key and value. Defaults to "="
+//		quote:     the quote character that may be used to enclose values
+//		           containing separators. Defaults to `"`
+//		key:       the key to extract. If not set, all pairs are returned as
+//		           an object
+//		number:    if true, values are converted to numbers
+//
+type KVHandler struct{}
+
+// Parse parses the given payload and returns the extracted value. It implements
+// the `Parse()` method of `payload.Handler`
+func (h KVHandler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	separator, err := getString(cfg, "separator", ";")
+	if err != nil {
+		return nil, err
+	}
+
+	assign, err := getString(cfg, "assign", "=")
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := getString(cfg, "quote", `"`)
+	if err != nil {
+		return nil, err
+	}
+
+	if separator == "" || assign == "" || len(quote) > 1 {
+		return nil, fmt.Errorf("`separator` and `assign` must not be empty and `quote` must be a single character")
+	}
+
+	asNumber, err := getBool(cfg, "number")
+	if err != nil {
+		return nil, err
+	}
+
+	key, hasKey := cfg["key"]
+	if hasKey {
+		if _, ok := key.(string); !ok {
+			return nil, fmt.Errorf("`key` argument must be a string")
+		}
+	}
+
+	pairs := make(map[string]interface{})
+	for _, pair := range split(strings.TrimSpace(string(body)), separator, quote) {
+		parts := split(pair, assign, quote)
+		if len(parts) == 0 || strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+
+		k := unquote(strings.TrimSpace(parts[0]), quote)
+		v := unquote(strings.TrimSpace(strings.Join(parts[1:], assign)), quote)
+
+		pairs[k] = v
+	}
+
+	if hasKey {
+		v, ok := pairs[key.(string)]
+		if !ok {
+			return nil, fmt.Errorf("unknown key: %s", key)
+		}
+
+		return convert(v.(string), asNumber)
+	}
+
+	for k, v := range pairs {
+		pairs[k], err = convert(v.(string), asNumber)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err.Error())
+		}
+	}
+
+	return pairs, nil
+}
+
+// split splits s at each occurrence of sep that is not enclosed in quotes
+func split(s, sep, quote string) []string {
+	if s == "" {
+		return nil
+	}
+
+	var parts []string
+	inQuote := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		if quote != "" && s[i] == quote[0] {
+			inQuote = !inQuote
+			continue
+		}
+
+		if !inQuote && strings.HasPrefix(s[i:], sep) {
+			parts = append(parts, s[start:i])
+			i += len(sep) - 1
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func unquote(s, quote string) string {
+	if quote != "" && len(s) >= 2 && strings.HasPrefix(s, quote) && strings.HasSuffix(s, quote) {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// convert returns s as a number if asNumber is true
+func convert(s string, asNumber bool) (interface{}, error) {
+	if !asNumber {
+		return s, nil
+	}
+
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+func getString(cfg payload.HandlerSpec, key string, def string) (string, error) {
+	v, ok := cfg[key]
+	if !ok {
+		return def, nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("`%s` argument must be a string", key)
+	}
+
+	return s, nil
+}
+
+func getBool(cfg payload.HandlerSpec, key string) (bool, error) {
+	v, ok := cfg[key]
+	if !ok {
+		return false, nil
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("`%s` argument must be a boolean", key)
+	}
+
+	return b, nil
+}
+
+// Options implements payload.Describer
+func (h KVHandler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "separator", Type: []string{"string"}, Description: "separator between pairs. Defaults to ;"},
+		{Name: "assign", Type: []string{"string"}, Description: "separator between key and value. Defaults to ="},
+		{Name: "quote", Type: []string{"string"}, Description: "quote character for values containing separators"},
+		{Name: "key", Type: []string{"string"}, Description: "key to extract. All pairs are returned if not set"},
+		{Name: "number", Type: []string{"boolean"}, Description: "convert values to numbers"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("kv", KVHandler{})
+	payload.MustRegisterType("csv", CSVHandler{})
+}
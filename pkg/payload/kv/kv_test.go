@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_KVHandler(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{payload.HandlerSpec{"key": "temp"}, "temp=21.3;hum=40", "21.3", false},
+		{payload.HandlerSpec{"key": "temp", "number": true}, "temp=21.3; hum=40", 21.3, false},
+		{payload.HandlerSpec{"key": "msg"}, `temp=21.3;msg="a;b=c"`, "a;b=c", false},
+		{payload.HandlerSpec{"separator": " ", "assign": ":", "key": "hum"}, "temp:21.3 hum:40", "40", false},
+		{payload.HandlerSpec{"number": true}, "temp=21.3;hum=40;", map[string]interface{}{"temp": 21.3, "hum": 40.0}, false},
+		{payload.HandlerSpec{"key": "missing"}, "temp=21.3", nil, true},
+		{payload.HandlerSpec{"key": "temp", "number": true}, "temp=warm", nil, true},
+		{payload.HandlerSpec{"separator": ""}, "temp=21.3", nil, true},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "kv"
+
+		res, err := c.m.Parse([]byte(c.i))
+		if c.err {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
+
+func Test_CSVHandler(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{payload.HandlerSpec{"index": 1}, "21.3,40,ok", "40", false},
+		{payload.HandlerSpec{"index": 1, "number": true}, "21.3,40,ok", 40.0, false},
+		{payload.HandlerSpec{}, `21.3,"a,b"`, []interface{}{"21.3", "a,b"}, false},
+		{payload.HandlerSpec{"separator": ";", "headers": []interface{}{"temp", "hum"}, "column": "hum"}, "21.3;40", "40", false},
+		{payload.HandlerSpec{"headers": true, "number": true}, "temp,hum\n21.3,40\n", map[string]interface{}{"temp": 21.3, "hum": 40.0}, false},
+		{payload.HandlerSpec{"headers": true, "column": "temp"}, "temp,hum\n1,2\n3,4", "3", false},
+		{payload.HandlerSpec{"column": "temp"}, "21.3,40", nil, true},
+		{payload.HandlerSpec{"index": 5}, "21.3,40", nil, true},
+		{payload.HandlerSpec{"headers": true}, "temp,hum", nil, true},
+		{payload.HandlerSpec{"separator": ";;"}, "21.3", nil, true},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "csv"
+
+		res, err := c.m.Parse([]byte(c.i))
+		if c.err {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
+
+func Test_CSVQuoting(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{payload.HandlerSpec{}, `"say ""hi""", b`, []interface{}{`say "hi"`, "b"}, false},
+		{payload.HandlerSpec{"headers": true}, "msg,n\n\"line 1\r\nline 2\",1\n", map[string]interface{}{"msg": "line 1\nline 2", "n": "1"}, false},
+		{payload.HandlerSpec{"quote": "'"}, `'a,b',"c"`, []interface{}{"a,b", `"c"`}, false},
+		{payload.HandlerSpec{"quote": "'"}, `'it''s',x`, []interface{}{"it's", "x"}, false},
+		{payload.HandlerSpec{"quote": ""}, `"a,b"`, []interface{}{`"a`, `b"`}, false},
+		{payload.HandlerSpec{"separator": ";", "quote": "|"}, "|21;3|;40", []interface{}{"21;3", "40"}, false},
+		{payload.HandlerSpec{}, `a"b,c`, nil, true},
+		{payload.HandlerSpec{"lazyQuotes": true}, `a"b,c`, []interface{}{`a"b`, "c"}, false},
+		{payload.HandlerSpec{}, `"a"b",c`, nil, true},
+		{payload.HandlerSpec{"lazyQuotes": true}, `"a"b",c`, []interface{}{`a"b`, "c"}, false},
+		{payload.HandlerSpec{}, `"a,b`, nil, true},
+		{payload.HandlerSpec{"lazyQuotes": true}, `"a,b`, []interface{}{"a,b"}, false},
+		{payload.HandlerSpec{"quote": "''"}, "a", nil, true},
+		{payload.HandlerSpec{"quote": ","}, "a", nil, true},
+		{payload.HandlerSpec{"quote": 1}, "a", nil, true},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "csv"
+
+		res, err := c.m.Parse([]byte(c.i))
+		if c.err {
+			assert.NotNil(t, err, c.i)
+		} else {
+			assert.Nil(t, err, c.i)
+			assert.Equal(t, c.o, res, c.i)
+		}
+	}
+}
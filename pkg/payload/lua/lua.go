@@ -1,32 +1,115 @@
 package lua
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"reflect"
+	"strings"
+	"sync"
+	"time"
 
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
 	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
 	luar "layeh.com/gopher-luar"
 )
 
-var (
-	//refTypeLStatePtr  = reflect.TypeOf((*LState)(nil))
-	refTypeLuaLValue  = reflect.TypeOf((*lua.LValue)(nil)).Elem()
-	refTypeInt        = reflect.TypeOf(int(0))
-	refTypeEmptyIface = reflect.TypeOf((*interface{})(nil)).Elem()
-)
+// DefaultTimeout is the maximum time a converter script may run if no
+// `timeout` is configured in the handler spec
+const DefaultTimeout = time.Second
+
+// MaxTimeout is the upper limit for configured timeouts. Larger values
+// are reduced to MaxTimeout
+const MaxTimeout = 5 * time.Second
+
+// maxCachedScripts is the number of compiled scripts kept in memory
+const maxCachedScripts = 256
+
+// libraries that are loaded into sandboxed VMs. `os`, `io`, `debug`,
+// `package` and `channel` are not available to converter scripts
+var libraries = []struct {
+	name string
+	fn   lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// functions from the base library that would allow to escape the sandbox,
+// to modify globals shared with other scripts, to write to the standard
+// output of the gateway or to interfere with the garbage collector of the
+// pooled VMs
+var unsafeBuiltins = []string{
+	"_G",
+	"collectgarbage",
+	"dofile",
+	"getfenv",
+	"loadfile",
+	"load",
+	"loadstring",
+	"module",
+	"print",
+	"rawget",
+	"rawset",
+	"require",
+	"setfenv",
+}
+
+// Handler implements payload.Handler, payload.MessageHandler and
+// payload.Forgetter
+type Handler struct {
+	protos *lru.Cache
+
+	statesLock sync.Mutex
+	states     map[string]map[string]*scriptState
+
+	vms sync.Pool
+}
+
+// scriptState holds the content of the `state` table that is persisted
+// between invocations for the same message source
+type scriptState struct {
+	sync.Mutex
+	values map[string]interface{}
+}
+
+// NewHandler returns a new lua handler
+func NewHandler() *Handler {
+	// lru.New only fails for non-positive sizes
+	protos, _ := lru.New(maxCachedScripts)
 
-// TODO(ppacher) cache lua.LState based on payload.HandlerSpec
-// create a go-routine to cleanup unused ones
+	h := &Handler{
+		protos: protos,
+		states: make(map[string]map[string]*scriptState),
+	}
+
+	h.vms.New = func() interface{} {
+		return newSandbox()
+	}
 
-// Handler implements payload.Handler
-type Handler struct{}
+	return h
+}
 
 // Parse parses the given payload and returns the extracted value. It implements
 // the `Parse()` method of `payload.Handler`
-func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
-	content, ok := cfg["content"].(string)
+func (h *Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{
+		Payload:   body,
+		Timestamp: time.Now(),
+	}, cfg)
+}
+
+// ParseMessage parses the given message and returns the extracted value. Besides
+// `value` the script has access to `previous`, `timestamp`, `topic`, `segments`,
+// `captures`, `retained`, `qos`, `thing`, `property` and a `state` table that is kept
+// between invocations for the same thing property.
+// If the script returns nil the message is dropped. It implements the
+// `ParseMessage()` method of `payload.MessageHandler`
+func (h *Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	content, _ := cfg["content"].(string)
 
 	code, ok := cfg["return"].(string)
 	if ok {
@@ -35,42 +118,253 @@ func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error
 
 	if !ok {
 		code, ok = cfg["code"].(string)
-		fmt.Println(code)
 		if !ok {
 			return nil, fmt.Errorf("no converter code specified")
 		}
 	}
 
-	vm := lua.NewState(lua.Options{
-		IncludeGoStackTrace: true,
-		MinimizeStackMemory: true,
-		//SkipOpenLibs:        true,
-	})
+	timeout, err := getTimeout(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := h.compile(code)
+	if err != nil {
+		return nil, err
+	}
+
+	state := h.state(msg)
+	state.Lock()
+	defer state.Unlock()
+
+	vm := h.vms.Get().(*lua.LState)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	vm.SetContext(ctx)
+	value, err := run(vm, proto, content, msg, state)
+	vm.RemoveContext()
+
+	// a VM that failed may be left in an inconsistent state so
+	// we only put it back to the pool on success
+	if err != nil {
+		vm.Close()
+		return nil, err
+	}
+
+	vm.SetTop(0)
+	h.vms.Put(vm)
+
+	if value == nil {
+		return nil, payload.ErrDropped
+	}
+
+	return value, nil
+}
+
+// state returns the script state for the source of msg. Messages
+// without a source get a new state each time
+func (h *Handler) state(msg *payload.Message) *scriptState {
+	if msg.Key() == "" {
+		return &scriptState{}
+	}
+
+	h.statesLock.Lock()
+	defer h.statesLock.Unlock()
+
+	props, ok := h.states[msg.ThingID]
+	if !ok {
+		props = make(map[string]*scriptState)
+		h.states[msg.ThingID] = props
+	}
+
+	s, ok := props[msg.PropertyID]
+	if !ok {
+		s = &scriptState{}
+		props[msg.PropertyID] = s
+	}
+
+	return s
+}
+
+// Forget drops the script state of all properties of thingID. It
+// implements payload.Forgetter
+func (h *Handler) Forget(thingID string) {
+	h.statesLock.Lock()
+	defer h.statesLock.Unlock()
+
+	delete(h.states, thingID)
+}
+
+// compile returns the cached function prototype for code or compiles
+// and caches a new one
+func (h *Handler) compile(code string) (*lua.FunctionProto, error) {
+	if proto, ok := h.protos.Get(code); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
 
-	if content == "" {
-		vm.SetGlobal("value", lua.LString(body))
-	} else if content == "json" {
+	chunk, err := parse.Parse(strings.NewReader(code), "<converter>")
+	if err != nil {
+		return nil, err
+	}
+
+	proto, err := lua.Compile(chunk, "<converter>")
+	if err != nil {
+		return nil, err
+	}
+
+	h.protos.Add(code, proto)
+
+	return proto, nil
+}
+
+// run executes proto inside vm. Each run gets a fresh global environment
+// so scripts cannot leak state into subsequent invocations. The only
+// exception is the `state` table which is copied back into state after a
+// successful run
+func run(vm *lua.LState, proto *lua.FunctionProto, content string, msg *payload.Message, state *scriptState) (interface{}, error) {
+	env := newEnvironment(vm)
+
+	switch content {
+	case "":
+		env.RawSetString("value", lua.LString(msg.Payload))
+	case "json":
 		var x interface{}
-		if err := json.Unmarshal(body, &x); err != nil {
+		if err := json.Unmarshal(msg.Payload, &x); err != nil {
 			return nil, err
 		}
 
-		vm.SetGlobal("value", luar.New(vm, x))
-	} else {
+		env.RawSetString("value", luar.New(vm, x))
+	default:
 		return nil, fmt.Errorf("invalid content type")
 	}
 
+	stateTable := vm.NewTable()
+	for key, value := range state.values {
+		stateTable.RawSetString(key, toLuaValue(vm, value))
+	}
+
+	env.RawSetString("state", stateTable)
+	env.RawSetString("previous", toLuaValue(vm, msg.Previous))
+	env.RawSetString("topic", lua.LString(msg.Topic))
+	env.RawSetString("retained", lua.LBool(msg.Retained))
+	env.RawSetString("qos", lua.LNumber(msg.QoS))
+	env.RawSetString("thing", lua.LString(msg.ThingID))
+	env.RawSetString("property", lua.LString(msg.PropertyID))
+
+	segments := vm.NewTable()
+	for _, s := range msg.Segments {
+		segments.Append(lua.LString(s))
+	}
+	env.RawSetString("segments", segments)
+
+	captures := vm.NewTable()
+	for name, value := range msg.Captures {
+		captures.RawSetString(name, lua.LString(value))
+	}
+	env.RawSetString("captures", captures)
+
+	if !msg.Timestamp.IsZero() {
+		env.RawSetString("timestamp", lua.LNumber(float64(msg.Timestamp.UnixNano())/float64(time.Second)))
+	}
+
+	fn := vm.NewFunctionFromProto(proto)
+	fn.Env = env
+
+	vm.Push(fn)
+	if err := vm.PCall(0, 1, nil); err != nil {
+		return nil, err
+	}
+
+	value, err := toGoValue(vm.Get(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	// the script may have replaced the state table
+	if tbl, ok := env.RawGetString("state").(*lua.LTable); ok {
+		values, err := tableToGo(tbl, make(map[*lua.LTable]struct{}))
+		if err != nil {
+			return nil, fmt.Errorf("state: %s", err.Error())
+		}
+
+		// empty tables are converted to objects
+		if m, ok := values.(map[string]interface{}); ok {
+			state.values = m
+		}
+	}
+
+	return value, nil
+}
+
+// newEnvironment returns a new global table for a single run that holds
+// the sandbox globals. Library tables like `string` and `math` are copied
+// so scripts cannot modify the globals of the pooled VM
+func newEnvironment(vm *lua.LState) *lua.LTable {
+	env := vm.NewTable()
+
+	vm.G.Global.ForEach(func(key, value lua.LValue) {
+		if lib, ok := value.(*lua.LTable); ok {
+			value = copyLibrary(vm, lib)
+		}
+
+		env.RawSet(key, value)
+	})
+
+	return env
+}
+
+// copyLibrary returns a shallow copy of lib without metamethods. The string
+// library is its own metatable and holds a reference to itself in __index
+func copyLibrary(vm *lua.LState, lib *lua.LTable) *lua.LTable {
+	cp := vm.NewTable()
+
+	lib.ForEach(func(key, value lua.LValue) {
+		if name, ok := key.(lua.LString); ok && strings.HasPrefix(string(name), "__") {
+			return
+		}
+
+		cp.RawSet(key, value)
+	})
+
+	return cp
+}
+
+// newSandbox creates a new lua VM without access to the file-system,
+// the operating system or the debug library
+func newSandbox() *lua.LState {
+	vm := lua.NewState(lua.Options{
+		IncludeGoStackTrace: true,
+		MinimizeStackMemory: true,
+		SkipOpenLibs:        true,
+	})
+
+	for _, lib := range libraries {
+		vm.Push(vm.NewFunction(lib.fn))
+		vm.Push(lua.LString(lib.name))
+		vm.Call(1, 0)
+	}
+
+	for _, name := range unsafeBuiltins {
+		vm.SetGlobal(name, lua.LNil)
+	}
+
+	// strings share a metatable which is the string library itself. Hide
+	// it from getmetatable so scripts cannot modify it
+	if mt, ok := vm.GetMetatable(lua.LString("")).(*lua.LTable); ok {
+		mt.RawSetString("__metatable", lua.LFalse)
+	}
+
 	vm.SetGlobal("int", vm.NewFunction(func(L *lua.LState) int {
-		n := L.ToInt(1)
 		ud := L.NewUserData()
-		ud.Value = n
+		ud.Value = L.ToInt(1)
+		L.Push(ud)
 		return 1
 	}))
 
 	vm.SetGlobal("bool", vm.NewFunction(func(L *lua.LState) int {
-		n := L.ToBool(1)
-		ud := L.NewUserData()
-		ud.Value = n
+		L.Push(lua.LBool(L.ToBool(1)))
 		return 1
 	}))
 
@@ -84,258 +378,155 @@ func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error
 		return x
 	}))
 
-	vm.SetGlobal("map", luar.New(vm, func(m map[string]interface{}) interface{} {
-		fmt.Println(m)
-		ud := vm.NewUserData()
-		ud.Value = m
-		return ud
+	vm.SetGlobal("map", luar.New(vm, func(m map[string]interface{}) map[string]interface{} {
+		return m
 	}))
 
-	if err := vm.DoString(code); err != nil {
-		return nil, err
-	}
-
-	value := vm.Get(1)
-
-	switch value.Type() {
-	case lua.LTBool:
-		return value == lua.LTrue, nil
-	case lua.LTString:
-		return value.(lua.LString).String(), nil
-	case lua.LTNumber:
-		return float64(value.(lua.LNumber)), nil
-	case lua.LTUserData:
-		return value.(*lua.LUserData).Value, nil
-		/*
-			case lua.LTTable:
-				var x map[string]interface{}
-				val, err := lValueToReflect(vm, value, reflect.TypeOf(x), nil)
-				return val.Interface(), err
-		*/
-	}
-
-	return nil, fmt.Errorf("invalid result")
+	return vm
 }
 
-//
-// the following code is take from Gopher-Luar
-//
-
-type conversionError struct {
-	Lua  lua.LValue
-	Hint reflect.Type
-}
-
-func (c conversionError) Error() string {
-	if _, isNil := c.Lua.(*lua.LNilType); isNil {
-		return fmt.Sprintf("cannot use nil as type %s", c.Hint)
+// getTimeout returns the script timeout configured in cfg. It may either
+// be specified as a number of milliseconds or as a duration string. The
+// timeout must be positive and is limited to MaxTimeout
+func getTimeout(cfg payload.HandlerSpec) (time.Duration, error) {
+	timeout, ok, err := cfg.GetDuration("timeout")
+	if err != nil {
+		return 0, err
 	}
 
-	var val interface{}
-
-	if userData, ok := c.Lua.(*lua.LUserData); ok {
-		val = userData.Value
-	} else {
-		val = c.Lua
+	if !ok {
+		return DefaultTimeout, nil
 	}
 
-	return fmt.Sprintf("cannot use %v (type %T) as type %s", val, val, c.Hint)
-}
-
-type structFieldError struct {
-	Field string
-	Type  reflect.Type
-}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("`timeout` must be positive")
+	}
 
-func (s structFieldError) Error() string {
-	return `type ` + s.Type.String() + ` has no field ` + s.Field
-}
+	if timeout > MaxTimeout {
+		timeout = MaxTimeout
+	}
 
-func lValueToReflect(L *lua.LState, v lua.LValue, hint reflect.Type, tryConvertPtr *bool) (reflect.Value, error) {
-	visited := make(map[*lua.LTable]reflect.Value)
-	return lValueToReflectInner(L, v, hint, visited, tryConvertPtr)
+	return timeout, nil
 }
 
-func lValueToReflectInner(L *lua.LState, v lua.LValue, hint reflect.Type, visited map[*lua.LTable]reflect.Value, tryConvertPtr *bool) (reflect.Value, error) {
-	if hint.Implements(refTypeLuaLValue) {
-		return reflect.ValueOf(v), nil
-	}
-
-	switch converted := v.(type) {
+// toGoValue converts a lua value to it's Go representation. Tables with
+// consecutive integer keys starting at 1 are converted to []interface{}, all
+// other tables to map[string]interface{}
+func toGoValue(value lua.LValue) (interface{}, error) {
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
 	case lua.LBool:
-		val := reflect.ValueOf(bool(converted))
-		if !val.Type().ConvertibleTo(hint) {
-			return reflect.Value{}, conversionError{
-				Lua:  v,
-				Hint: hint,
-			}
-		}
-		return val.Convert(hint), nil
-	case lua.LChannel:
-		val := reflect.ValueOf(converted)
-		if !val.Type().ConvertibleTo(hint) {
-			return reflect.Value{}, conversionError{
-				Lua:  v,
-				Hint: hint,
-			}
-		}
-		return val.Convert(hint), nil
+		return bool(v), nil
+	case lua.LString:
+		return string(v), nil
 	case lua.LNumber:
-		val := reflect.ValueOf(float64(converted))
-		if !val.Type().ConvertibleTo(hint) {
-			return reflect.Value{}, conversionError{
-				Lua:  v,
-				Hint: hint,
-			}
-		}
-		return val.Convert(hint), nil
-	case *lua.LFunction:
-		panic("function not supported")
+		return float64(v), nil
+	case *lua.LUserData:
+		return v.Value, nil
+	case *lua.LTable:
+		return tableToGo(v, make(map[*lua.LTable]struct{}))
+	}
 
-	case *lua.LNilType:
-		switch hint.Kind() {
-		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice, reflect.UnsafePointer, reflect.Uintptr:
-			return reflect.Zero(hint), nil
-		}
+	return nil, fmt.Errorf("unsupported result type %s", value.Type().String())
+}
 
-		return reflect.Value{}, conversionError{
-			Lua:  v,
-			Hint: hint,
+// toLuaValue converts a Go value to it's lua representation. Maps and slices
+// of empty interfaces are converted to tables, all other values are passed to
+// gopher-luar
+func toLuaValue(vm *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case []interface{}:
+		tbl := vm.NewTable()
+		for _, elem := range v {
+			tbl.Append(toLuaValue(vm, elem))
 		}
-
-	case *lua.LState:
-		val := reflect.ValueOf(converted)
-		if !val.Type().ConvertibleTo(hint) {
-			return reflect.Value{}, conversionError{
-				Lua:  v,
-				Hint: hint,
-			}
+		return tbl
+	case map[string]interface{}:
+		tbl := vm.NewTable()
+		for key, elem := range v {
+			tbl.RawSetString(key, toLuaValue(vm, elem))
 		}
-		return val.Convert(hint), nil
+		return tbl
+	}
 
-	case lua.LString:
-		val := reflect.ValueOf(string(converted))
-		if !val.Type().ConvertibleTo(hint) {
-			return reflect.Value{}, conversionError{
-				Lua:  v,
-				Hint: hint,
-			}
-		}
-		return val.Convert(hint), nil
+	return luar.New(vm, value)
+}
 
-	case *lua.LTable:
-		if existing := visited[converted]; existing.IsValid() {
-			return existing, nil
-		}
+func tableToGo(tbl *lua.LTable, visited map[*lua.LTable]struct{}) (interface{}, error) {
+	if _, ok := visited[tbl]; ok {
+		return nil, fmt.Errorf("cyclic tables are not supported")
+	}
+	visited[tbl] = struct{}{}
+	defer delete(visited, tbl)
 
-		if hint == refTypeEmptyIface {
-			hint = reflect.MapOf(refTypeEmptyIface, refTypeEmptyIface)
+	convert := func(value lua.LValue) (interface{}, error) {
+		if t, ok := value.(*lua.LTable); ok {
+			return tableToGo(t, visited)
 		}
+		return toGoValue(value)
+	}
 
-		switch {
-		case hint.Kind() == reflect.Array:
-			elemType := hint.Elem()
-			length := converted.Len()
-			if length != hint.Len() {
-				return reflect.Value{}, conversionError{
-					Lua:  v,
-					Hint: hint,
-				}
-			}
-			s := reflect.New(hint).Elem()
-			visited[converted] = s
-
-			for i := 0; i < length; i++ {
-				value := converted.RawGetInt(i + 1)
-				elemValue, err := lValueToReflectInner(L, value, elemType, visited, nil)
-				if err != nil {
-					return reflect.Value{}, err
-				}
-				s.Index(i).Set(elemValue)
-			}
+	length := tbl.Len()
+	count := 0
+	tbl.ForEach(func(_, _ lua.LValue) {
+		count++
+	})
 
-			return s, nil
-
-		case hint.Kind() == reflect.Slice:
-			elemType := hint.Elem()
-			length := converted.Len()
-			s := reflect.MakeSlice(hint, length, length)
-			visited[converted] = s
-
-			for i := 0; i < length; i++ {
-				value := converted.RawGetInt(i + 1)
-				elemValue, err := lValueToReflectInner(L, value, elemType, visited, nil)
-				if err != nil {
-					return reflect.Value{}, err
-				}
-				s.Index(i).Set(elemValue)
+	if length > 0 && length == count {
+		arr := make([]interface{}, length)
+		for i := 0; i < length; i++ {
+			value, err := convert(tbl.RawGetInt(i + 1))
+			if err != nil {
+				return nil, err
 			}
+			arr[i] = value
+		}
 
-			return s, nil
-
-		case hint.Kind() == reflect.Map:
-			keyType := hint.Key()
-			elemType := hint.Elem()
-			s := reflect.MakeMap(hint)
-			visited[converted] = s
-
-			for key := lua.LNil; ; {
-				var value lua.LValue
-				key, value = converted.Next(key)
-				if key == lua.LNil {
-					break
-				}
-
-				lKey, err := lValueToReflectInner(L, key, keyType, visited, nil)
-				if err != nil {
-					return reflect.Value{}, err
-				}
-				lValue, err := lValueToReflectInner(L, value, elemType, visited, nil)
-				if err != nil {
-					return reflect.Value{}, err
-				}
-				s.SetMapIndex(lKey, lValue)
-			}
+		return arr, nil
+	}
 
-			return s, nil
+	obj := make(map[string]interface{}, count)
 
-		case hint.Kind() == reflect.Ptr && hint.Elem().Kind() == reflect.Struct:
-			hint = hint.Elem()
-			fallthrough
-		case hint.Kind() == reflect.Struct:
-			panic("struct not supported")
+	var err error
+	tbl.ForEach(func(key, value lua.LValue) {
+		if err != nil {
+			return
 		}
 
-		return reflect.Value{}, conversionError{
-			Lua:  v,
-			Hint: hint,
-		}
-
-	case *lua.LUserData:
-		val := reflect.ValueOf(converted.Value)
-		if tryConvertPtr != nil && val.Kind() != reflect.Ptr && hint.Kind() == reflect.Ptr && val.Type() == hint.Elem() {
-			newVal := reflect.New(hint.Elem())
-			newVal.Elem().Set(val)
-			val = newVal
-			*tryConvertPtr = true
-		} else {
-			if !val.Type().ConvertibleTo(hint) {
-				return reflect.Value{}, conversionError{
-					Lua:  converted,
-					Hint: hint,
-				}
-			}
-			val = val.Convert(hint)
-			if tryConvertPtr != nil {
-				*tryConvertPtr = false
-			}
-		}
-		return val, nil
+		var v interface{}
+		v, err = convert(value)
+		obj[key.String()] = v
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	panic("never reaches")
+	return obj, nil
+}
+
+// Options implements payload.Describer
+func (h *Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "code", Type: []string{"string"}, Description: "lua script returning the value"},
+		{Name: "return", Type: []string{"string"}, Description: "lua expression returning the value. Takes precedence over code"},
+		{Name: "content", Type: []string{"string"}, Description: "set to json to decode the payload before running the script"},
+		{Name: "timeout", Type: []string{"number", "string"}, Description: "maximum run time in milliseconds or as a duration string (at most 5s)"},
+	}
 }
 
 func init() {
-	payload.MustRegisterType("lua", Handler{})
+	payload.MustRegisterType("lua", NewHandler())
 }
@@ -0,0 +1,261 @@
+package lua
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_LuaHandler(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		i   string
+		o   interface{}
+		err bool
+	}{
+		{
+			payload.HandlerSpec{
+				"return": "json(value).val == 1",
+			},
+			`{"val": 1}`,
+			true,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"content": "json",
+				"return":  "value.val * 2",
+			},
+			`{"val": 21}`,
+			42.0,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "int(value)",
+			},
+			"10",
+			10,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "{a = 1, b = {1, 2, 'x'}}",
+			},
+			"",
+			map[string]interface{}{
+				"a": 1.0,
+				"b": []interface{}{1.0, 2.0, "x"},
+			},
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"code": "x = value\nreturn x",
+			},
+			"foo",
+			"foo",
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "x",
+			},
+			"foo",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "os.time()",
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "io.open('/etc/passwd')",
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "dofile('/etc/passwd')",
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"code":    "while true do end",
+				"timeout": 10,
+			},
+			"",
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"return": "json(value)",
+			},
+			"{invalid",
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "lua"
+
+		res, err := c.m.Parse([]byte(c.i))
+		if c.err {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
+
+func Test_LuaHandlerState(t *testing.T) {
+	spec := payload.HandlerSpec{
+		"type": "lua",
+		"code": `
+local v = tonumber(value)
+local last = state.last
+state.last = v
+if last == nil or previous == nil then
+	return nil
+end
+return previous + (v - last)
+`,
+	}
+
+	msg := &payload.Message{
+		ThingID:    "thing",
+		PropertyID: "energy",
+		Payload:    []byte("10"),
+		Previous:   0.0,
+	}
+
+	_, err := spec.ParseMessage(msg)
+	assert.Equal(t, payload.ErrDropped, err)
+
+	msg.Payload = []byte("15")
+	res, err := spec.ParseMessage(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.0, res)
+
+	// state is kept per message source
+	msg.PropertyID = "other"
+	_, err = spec.ParseMessage(msg)
+	assert.Equal(t, payload.ErrDropped, err)
+
+	msg.Topic = "thing/status/energy"
+	msg.Segments = []string{"thing", "status", "energy"}
+	res, err = payload.HandlerSpec{"type": "lua", "return": "topic .. ':' .. segments[3] .. ':' .. property"}.ParseMessage(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "thing/status/energy:energy:other", res)
+}
+
+func Test_LuaSandboxIsolation(t *testing.T) {
+	h := NewHandler()
+
+	// escape hatches are not available
+	res, err := h.Parse(nil, payload.HandlerSpec{
+		"return": "_G == nil and getfenv == nil and setfenv == nil and rawset == nil and rawget == nil and getmetatable('') == false and print == nil and collectgarbage == nil",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, true, res)
+
+	// the first script modifies globals and library tables
+	_, err = h.Parse(nil, payload.HandlerSpec{
+		"code": `
+string.format = function() return "evil" end
+math.floor = nil
+json = nil
+leaked = 1
+return 1
+`,
+	})
+	assert.Nil(t, err)
+
+	// which must not be visible to the next script running in the same VM
+	res, err = h.Parse(nil, payload.HandlerSpec{
+		"return": "string.format('%d', 2) .. ('x'):upper() .. tostring(math.floor(1.5)) .. tostring(json ~= nil) .. tostring(leaked)",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "2X1truenil", res)
+}
+
+func Test_LuaTimeout(t *testing.T) {
+	cases := []struct {
+		v   interface{}
+		o   time.Duration
+		err bool
+	}{
+		{nil, DefaultTimeout, false},
+		{100, 100 * time.Millisecond, false},
+		{"2s", 2 * time.Second, false},
+		{60000, MaxTimeout, false},
+		{"1h", MaxTimeout, false},
+		{0, 0, true},
+		{-10, 0, true},
+		{"-1s", 0, true},
+		{"soon", 0, true},
+		{true, 0, true},
+	}
+
+	for _, c := range cases {
+		cfg := payload.HandlerSpec{}
+		if c.v != nil {
+			cfg["timeout"] = c.v
+		}
+
+		timeout, err := getTimeout(cfg)
+		if c.err {
+			assert.NotNil(t, err, "%v", c.v)
+		} else {
+			assert.Nil(t, err, "%v", c.v)
+			assert.Equal(t, c.o, timeout, "%v", c.v)
+		}
+	}
+}
+
+func Test_LuaForget(t *testing.T) {
+	h := NewHandler()
+	cfg := payload.HandlerSpec{"code": "state.n = (state.n or 0) + 1\nreturn state.n"}
+
+	for _, thingID := range []string{"lamp", "lamp/1", "lamp", "lamp/1"} {
+		_, err := h.ParseMessage(&payload.Message{ThingID: thingID, PropertyID: "on"}, cfg)
+		assert.Nil(t, err)
+	}
+
+	h.Forget("lamp")
+
+	res, err := h.ParseMessage(&payload.Message{ThingID: "lamp", PropertyID: "on"}, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.0, res)
+
+	res, err = h.ParseMessage(&payload.Message{ThingID: "lamp/1", PropertyID: "on"}, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, res)
+}
+
+func Test_LuaScriptCache(t *testing.T) {
+	h := NewHandler()
+
+	for i := 0; i < maxCachedScripts+10; i++ {
+		_, err := h.Parse(nil, payload.HandlerSpec{"return": strconv.Itoa(i)})
+		assert.Nil(t, err)
+	}
+
+	assert.Equal(t, maxCachedScripts, h.protos.Len())
+}
@@ -0,0 +1,44 @@
+package msgpack
+
+import (
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload/json"
+	"github.com/vmihailenco/msgpack"
+)
+
+// Handler is a `payload.Handler` and `payload.MessageHandler` that decodes
+// MessagePack payloads. It supports the same `path` argument as the json
+// handler
+type Handler struct{}
+
+// Parse implements the `Parse()` method of `payload.Handler`
+func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage implements the `ParseMessage()` method of `payload.MessageHandler`
+func (h Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	var x interface{}
+	if err := msgpack.Unmarshal(msg.Payload, &x); err != nil {
+		return nil, err
+	}
+
+	return json.Extract(msg, payload.Normalize(x), cfg)
+}
+
+// Encode encodes value as MessagePack
+func Encode(value interface{}) ([]byte, error) {
+	return msgpack.Marshal(value)
+}
+
+// Options implements payload.Describer
+func (h Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "path", Type: []string{"string"}, Description: "JSONPath of the value to extract. May be a template"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("msgpack", Handler{})
+	payload.MustRegisterEncoding("msgpack", Encode)
+}
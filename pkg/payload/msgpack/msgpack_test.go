@@ -0,0 +1,74 @@
+package msgpack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MsgpackHandler(t *testing.T) {
+	cases := []struct {
+		name string
+		i    []byte
+		m    payload.HandlerSpec
+		o    interface{}
+		err  bool
+	}{
+		// integers of all widths are returned as float64
+		{"positive fixint", []byte{0x2a}, nil, 42.0, false},
+		{"int8", []byte{0xd0, 0xff}, nil, -1.0, false},
+		{"uint64", []byte{0xcf, 0, 0, 0, 0x01, 0, 0, 0, 0}, nil, 4294967296.0, false},
+		{"float32", []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, nil, 1.5, false},
+		{"bin8", []byte{0xc4, 0x03, 0x01, 0x02, 0x03}, nil, []byte{0x01, 0x02, 0x03}, false},
+
+		// keys of maps are converted to strings so they can be selected
+		{"integer keys", []byte{0x81, 0x01, 0xa3, 'o', 'n', 'e'}, payload.HandlerSpec{"path": `$["1"]`}, "one", false},
+		{"binary keys", []byte{0x81, 0xc4, 0x01, 'A', 0x01}, payload.HandlerSpec{"path": "$.A"}, 1.0, false},
+		{"missing path", []byte{0x81, 0x01, 0xa3, 'o', 'n', 'e'}, payload.HandlerSpec{"path": "$.two"}, nil, true},
+
+		// only the timestamp extension type is supported
+		{"unknown extension", []byte{0xd4, 0x01, 0x05}, nil, nil, true},
+
+		// invalid input
+		{"truncated array", []byte{0x92, 0x01}, nil, nil, true},
+		{"never used code", []byte{0xc1}, nil, nil, true},
+		{"empty payload", nil, nil, nil, true},
+	}
+
+	for _, c := range cases {
+		spec := payload.HandlerSpec{"type": "msgpack"}
+		for key, value := range c.m {
+			spec[key] = value
+		}
+
+		res, err := spec.Parse(c.i)
+		if c.err {
+			assert.NotNil(t, err, c.name)
+		} else {
+			assert.Nil(t, err, c.name)
+			assert.Equal(t, c.o, res, c.name)
+		}
+	}
+}
+
+func Test_MsgpackTimestamp(t *testing.T) {
+	// timestamp 32 extension (type -1)
+	res, err := payload.HandlerSpec{"type": "msgpack"}.Parse([]byte{0xd6, 0xff, 0x5d, 0x47, 0x3a, 0x40})
+	assert.Nil(t, err)
+
+	if assert.IsType(t, &time.Time{}, res) {
+		assert.Equal(t, int64(1564949056), res.(*time.Time).Unix())
+	}
+}
+
+func Test_MsgpackEncode(t *testing.T) {
+	blob, err := payload.Encode("msgpack", map[string]interface{}{"on": true})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x81, 0xa2, 'o', 'n', 0xc3}, blob)
+
+	blob, err = payload.Encode("msgpack", []byte{0x01})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xc4, 0x01, 0x01}, blob)
+}
@@ -0,0 +1,42 @@
+package payload
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Normalize converts values decoded by non-JSON decoders (like CBOR or
+// MessagePack) to the same generic structure encoding/json would produce.
+// Maps are converted to map[string]interface{}, slices to []interface{} and
+// all numbers to float64. Byte slices are kept as they are. Maps and slices
+// are copied so v is never modified
+func Normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, bool, string, float64, []byte:
+		return x
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, key := range rv.MapKeys() {
+			m[fmt.Sprintf("%v", Normalize(key.Interface()))] = Normalize(rv.MapIndex(key).Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, rv.Len())
+		for idx := range s {
+			s[idx] = Normalize(rv.Index(idx).Interface())
+		}
+		return s
+	}
+
+	return v
+}
@@ -0,0 +1,62 @@
+package payload
+
+import "sort"
+
+// Option describes an argument supported by a handler type
+type Option struct {
+	// Name is the key of the argument inside the HandlerSpec
+	Name string `json:"name"`
+
+	// Type holds the JSON types accepted for the argument
+	Type []string `json:"type"`
+
+	// Description is a short, human readable description of the argument
+	Description string `json:"description,omitempty"`
+
+	// Required is set to true if the argument must be specified
+	Required bool `json:"required,omitempty"`
+}
+
+// Describer may be implemented by handlers to describe the arguments
+// they support
+type Describer interface {
+	// Options returns all arguments supported by the handler
+	Options() []Option
+}
+
+// TypeInfo describes a registered handler type
+type TypeInfo struct {
+	// Type is the name of the handler type
+	Type HandlerType `json:"type"`
+
+	// Options holds all arguments supported by the handler type. It is
+	// empty if the handler does not implement Describer
+	Options []Option `json:"options"`
+}
+
+// Types returns information about all registered handler types sorted
+// by name
+func Types() []TypeInfo {
+	handlersLock.RLock()
+	defer handlersLock.RUnlock()
+
+	types := make([]TypeInfo, 0, len(handlers))
+	for name, h := range handlers {
+		info := TypeInfo{
+			Type:    name,
+			Options: []Option{},
+		}
+
+		if d, ok := h.(Describer); ok {
+			info.Options = d.Options()
+		}
+
+		types = append(types, info)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Type < types[j].Type
+	})
+
+	return types
+}
@@ -0,0 +1,64 @@
+package payload
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// TestResult holds the outcome of running a handler against a sample payload
+type TestResult struct {
+	// Value holds the value extracted by the handler
+	Value interface{} `json:"value"`
+
+	// Error holds the error returned by the handler, if any
+	Error string `json:"error,omitempty"`
+}
+
+// DecodeSample decodes a sample payload. Supported encodings are
+// text (default), base64 and hex
+func DecodeSample(sample string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "text":
+		return []byte(sample), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(sample))
+	case "hex":
+		return hex.DecodeString(strings.Join(strings.Fields(sample), ""))
+	}
+
+	return nil, ErrUnknownSampleEncoding
+}
+
+// NewSampleMessage returns a message for body as if it has been received
+// on topic right now
+func NewSampleMessage(body []byte, topic string) *Message {
+	msg := &Message{
+		Payload:   body,
+		Topic:     topic,
+		Timestamp: time.Now(),
+	}
+
+	if topic != "" {
+		msg.Segments = strings.Split(topic, "/")
+	}
+
+	return msg
+}
+
+// Test runs the handler against msg. An error is only returned if the spec
+// itself is invalid, errors returned by the handler are reported in the
+// result
+func (h HandlerSpec) Test(msg *Message) (*TestResult, error) {
+	if _, err := h.Type(); err != nil {
+		return nil, err
+	}
+
+	value, err := h.ParseMessage(msg)
+	if err != nil {
+		return &TestResult{Error: err.Error()}, nil
+	}
+
+	return &TestResult{Value: Normalize(value)}, nil
+}
@@ -0,0 +1,113 @@
+package payload
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoHandler returns the payload as a string or fails if the spec has
+// `fail` set
+type echoHandler struct{}
+
+func (h echoHandler) Parse(body []byte, cfg HandlerSpec) (interface{}, error) {
+	if _, ok := cfg["fail"]; ok {
+		return nil, fmt.Errorf("failed")
+	}
+
+	return string(body), nil
+}
+
+// describedEchoHandler is an echoHandler that describes its options
+type describedEchoHandler struct {
+	echoHandler
+}
+
+func (describedEchoHandler) Options() []Option {
+	return []Option{{Name: "fail", Type: []string{"boolean"}}}
+}
+
+func init() {
+	MustRegisterType("test-echo", echoHandler{})
+	MustRegisterType("test-described-echo", describedEchoHandler{})
+}
+
+func Test_DecodeSample(t *testing.T) {
+	cases := []struct {
+		s   string
+		e   string
+		o   []byte
+		err error
+	}{
+		{"hello", "", []byte("hello"), nil},
+		{"hello", "text", []byte("hello"), nil},
+		{" aGVsbG8= \n", "base64", []byte("hello"), nil},
+		{"68 65 6c\n6c 6f", "hex", []byte("hello"), nil},
+		{"68656C6C6F", "hex", []byte("hello"), nil},
+		{"6", "hex", nil, fmt.Errorf("odd length")},
+		{"!!", "base64", nil, fmt.Errorf("illegal data")},
+		{"hello", "rot13", nil, ErrUnknownSampleEncoding},
+	}
+
+	for _, c := range cases {
+		res, err := DecodeSample(c.s, c.e)
+		if c.err != nil {
+			assert.NotNil(t, err, "%s: %q", c.e, c.s)
+			if c.err == ErrUnknownSampleEncoding {
+				assert.Equal(t, c.err, err)
+			}
+		} else {
+			assert.Nil(t, err, "%s: %q", c.e, c.s)
+			assert.Equal(t, c.o, res, "%s: %q", c.e, c.s)
+		}
+	}
+}
+
+func Test_NewSampleMessage(t *testing.T) {
+	msg := NewSampleMessage([]byte("x"), "tele/plug/SENSOR")
+	assert.Equal(t, []byte("x"), msg.Payload)
+	assert.Equal(t, []string{"tele", "plug", "SENSOR"}, msg.Segments)
+	assert.False(t, msg.Timestamp.IsZero())
+
+	msg = NewSampleMessage(nil, "")
+	assert.Nil(t, msg.Segments)
+}
+
+func Test_HandlerSpecTest(t *testing.T) {
+	msg := NewSampleMessage([]byte("on"), "")
+
+	res, err := HandlerSpec{"type": "test-echo"}.Test(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, &TestResult{Value: "on"}, res)
+
+	// handler errors are reported in the result
+	res, err = HandlerSpec{"type": "test-echo", "fail": true}.Test(msg)
+	assert.Nil(t, err)
+	assert.Equal(t, &TestResult{Error: "failed"}, res)
+
+	_, err = HandlerSpec{}.Test(msg)
+	assert.Equal(t, ErrNoType, err)
+
+	_, err = HandlerSpec{"type": 1}.Test(msg)
+	assert.Equal(t, ErrInvalidType, err)
+}
+
+func Test_Types(t *testing.T) {
+	types := Types()
+
+	var names []HandlerType
+	options := make(map[HandlerType][]Option)
+	for _, info := range types {
+		names = append(names, info.Type)
+		options[info.Type] = info.Options
+	}
+
+	for idx := 1; idx < len(names); idx++ {
+		assert.True(t, names[idx-1] < names[idx], "types must be sorted")
+	}
+
+	assert.Contains(t, names, HandlerType("test-echo"))
+	assert.Equal(t, []Option{}, options["test-echo"])
+	assert.Equal(t, []Option{{Name: "fail", Type: []string{"boolean"}}}, options["test-described-echo"])
+}
@@ -8,20 +8,33 @@ import (
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
 )
 
-// Handler implements `payload.Handler` and is capable of extracting data
-// from strings
+// Handler implements `payload.Handler` and `payload.MessageHandler` and is capable
+// of extracting data from strings
 type Handler struct{}
 
 // Parse parses the given payload and returns the extracted value. It implements
 // the `Parse()` method of `payload.Handler`
 func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
-	p := string(body)
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage parses the given message and returns the extracted value. The
+// `regex` argument may be a template that is rendered using the message context
+// (see payload.Message.Render). It implements the `ParseMessage()` method of
+// `payload.MessageHandler`
+func (h Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	p := string(msg.Payload)
 	if reg, hasRegex := cfg["regex"]; hasRegex {
 		r, ok := reg.(string)
 		if !ok {
 			return nil, fmt.Errorf("regex argument must be a string")
 		}
 
+		r, err := msg.Render(r)
+		if err != nil {
+			return nil, err
+		}
+
 		re, err := regexp.Compile(r)
 		if err != nil {
 			return nil, err
@@ -62,6 +75,15 @@ func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error
 	return p, nil
 }
 
+// Options implements payload.Describer
+func (h Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "regex", Type: []string{"string"}, Description: "regular expression used to extract the value. May be a template"},
+		{Name: "index", Type: []string{"number"}, Description: "index of the match or capture group to return"},
+		{Name: "group", Type: []string{"number"}, Description: "index of the match to select the capture group from"},
+	}
+}
+
 func init() {
 	payload.MustRegisterType("string", Handler{})
 }
@@ -94,3 +94,41 @@ func Test_StringHandler(t *testing.T) {
 		}
 	}
 }
+
+func Test_StringHandlerTemplates(t *testing.T) {
+	msg := &payload.Message{
+		Topic:      "sensors/kitchen/temperature",
+		Segments:   []string{"sensors", "kitchen", "temperature"},
+		Captures:   map[string]string{"room": "kitchen"},
+		ThingID:    "thermometer",
+		PropertyID: "temperature",
+	}
+
+	cases := []struct {
+		regex string
+		i     string
+		o     string
+		err   bool
+	}{
+		{`{{index .segments 1}}=\d+`, "bath=10 kitchen=21", "kitchen=21", false},
+		{`{{.captures.room}}=\d+`, "bath=10 kitchen=21", "kitchen=21", false},
+		{`{{.property.ID}}:\S+`, "humidity:40 temperature:21.5", "temperature:21.5", false},
+		{`{{.thing.ID}}`, "no match", "", false},
+		{`{{.captures.room`, "kitchen=21", "", true},
+		{`{{index .segments 5}}`, "kitchen=21", "", true},
+	}
+
+	h := Handler{}
+	for _, c := range cases {
+		m := *msg
+		m.Payload = []byte(c.i)
+
+		res, err := h.ParseMessage(&m, payload.HandlerSpec{"regex": c.regex})
+		if c.err {
+			assert.NotNil(t, err, c.regex)
+		} else {
+			assert.Nil(t, err, c.regex)
+			assert.Equal(t, c.o, res, c.regex)
+		}
+	}
+}
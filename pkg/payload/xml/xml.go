@@ -0,0 +1,135 @@
+package xml
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// Handler is a `payload.Handler` and `payload.MessageHandler` that extracts
+// values from XML documents using XPath expressions
+type Handler struct{}
+
+// Parse implements the `Parse()` method of `payload.Handler`
+func (h Handler) Parse(body []byte, cfg payload.HandlerSpec) (interface{}, error) {
+	return h.ParseMessage(&payload.Message{Payload: body}, cfg)
+}
+
+// ParseMessage implements the `ParseMessage()` method of `payload.MessageHandler`.
+// The following arguments are supported:
+//
+//		xpath:      the XPath expression to evaluate. It may be a template that is
+//		            rendered using the message context (see payload.Message.Render).
+//		            Defaults to "/" which selects the text of the whole document
+//		namespaces: a map of namespace prefixes to URIs used in `xpath`
+//		multiple:   if true, all matching nodes are returned as an array
+//
+func (h Handler) ParseMessage(msg *payload.Message, cfg payload.HandlerSpec) (interface{}, error) {
+	doc, err := xmlquery.Parse(bytes.NewReader(msg.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/"
+	if p, ok := cfg["xpath"]; ok {
+		ps, oks := p.(string)
+		if !oks {
+			return nil, fmt.Errorf("`xpath` argument must be a string")
+		}
+
+		path, err = msg.Render(ps)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces, err := getNamespaces(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	multiple := false
+	if m, ok := cfg["multiple"]; ok {
+		b, okb := m.(bool)
+		if !okb {
+			return nil, fmt.Errorf("`multiple` argument must be a boolean")
+		}
+
+		multiple = b
+	}
+
+	expr, err := xpath.CompileWithNS(path, namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	res := expr.Evaluate(xmlquery.CreateXPathNavigator(doc))
+
+	iter, ok := res.(*xpath.NodeIterator)
+	if !ok {
+		// numbers, strings and booleans from XPath functions like count()
+		if multiple {
+			return []interface{}{res}, nil
+		}
+		return res, nil
+	}
+
+	var values []interface{}
+	for iter.MoveNext() {
+		values = append(values, iter.Current().Value())
+
+		if !multiple {
+			return values[0], nil
+		}
+	}
+
+	if len(values) == 0 {
+		if multiple {
+			return []interface{}{}, nil
+		}
+
+		return nil, fmt.Errorf("no node matches %s", path)
+	}
+
+	return values, nil
+}
+
+func getNamespaces(cfg payload.HandlerSpec) (map[string]string, error) {
+	ns, ok := cfg["namespaces"]
+	if !ok {
+		return nil, nil
+	}
+
+	m, ok := ns.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("`namespaces` argument must be a map")
+	}
+
+	namespaces := make(map[string]string, len(m))
+	for prefix, uri := range m {
+		s, ok := uri.(string)
+		if !ok {
+			return nil, fmt.Errorf("`namespaces`: URI for %s must be a string", prefix)
+		}
+
+		namespaces[prefix] = s
+	}
+
+	return namespaces, nil
+}
+
+// Options implements payload.Describer
+func (h Handler) Options() []payload.Option {
+	return []payload.Option{
+		{Name: "xpath", Type: []string{"string"}, Description: "XPath expression of the value to extract. May be a template"},
+		{Name: "namespaces", Type: []string{"object"}, Description: "namespace prefixes used in the expression"},
+		{Name: "multiple", Type: []string{"boolean"}, Description: "return all matching nodes as an array"},
+	}
+}
+
+func init() {
+	payload.MustRegisterType("xml", Handler{})
+}
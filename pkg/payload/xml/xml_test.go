@@ -0,0 +1,96 @@
+package xml
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDocument = `<?xml version="1.0"?>
+<station xmlns:w="http://example.org/weather" id="vienna">
+	<w:temperature unit="C">21.5</w:temperature>
+	<sensor name="a">1</sensor>
+	<sensor name="b">2</sensor>
+</station>`
+
+func Test_XMLHandler(t *testing.T) {
+	cases := []struct {
+		m   payload.HandlerSpec
+		o   interface{}
+		err bool
+	}{
+		{
+			payload.HandlerSpec{
+				"xpath": "/station/@id",
+			},
+			"vienna",
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": "//sensor[@name='b']",
+			},
+			"2",
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath":    "//sensor/text()",
+				"multiple": true,
+			},
+			[]interface{}{"1", "2"},
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": "count(//sensor)",
+			},
+			2.0,
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": "//x:temperature/@unit",
+				"namespaces": map[string]interface{}{
+					"x": "http://example.org/weather",
+				},
+			},
+			"C",
+			false,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": "//missing",
+			},
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": "//[",
+			},
+			nil,
+			true,
+		},
+		{
+			payload.HandlerSpec{
+				"xpath": 1,
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		c.m["type"] = "xml"
+
+		res, err := c.m.Parse([]byte(testDocument))
+		if c.err {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
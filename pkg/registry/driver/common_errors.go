@@ -20,6 +20,10 @@ var (
 	// ErrUnknownDriver indicates that the requested driver is not registered
 	ErrUnknownDriver = errors.NewWithStatus(http.StatusNotFound, "unknown driver. Did you forget to import it?")
 
+	// ErrRevisionMismatch is returned if the revision of a thing does not
+	// match the expected revision
+	ErrRevisionMismatch = errors.NewWithStatus(http.StatusPreconditionFailed, "thing has been modified")
+
 	// ErrInvalidOptions is returned if a driver encounters invalid operation options
 	ErrInvalidOptions = errors.NewWithStatus(http.StatusBadRequest, "invalid options passed to the driver")
 )
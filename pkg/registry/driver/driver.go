@@ -11,11 +11,21 @@ import (
 type SetOptions struct {
 	UpdateOnly bool
 	CreateOnly bool
+
+	// ExpectedRevision may hold the revision the stored thing must have.
+	// If it doesn't match, ErrRevisionMismatch is returned. Zero disables
+	// the check
+	ExpectedRevision uint64
 }
 
 // DeleteOptions alter the behavior of the delete operation
 type DeleteOptions struct {
 	MustExist bool
+
+	// ExpectedRevision may hold the revision the stored thing must have.
+	// If it doesn't match, ErrRevisionMismatch is returned. Zero disables
+	// the check
+	ExpectedRevision uint64
 }
 
 // Driver is a storage driver for thing and item definitions
@@ -24,7 +34,9 @@ type Driver interface {
 	// error
 	Get(context.Context, string) (*spec.Thing, error)
 
-	// Set updates a complete thing definition
+	// Set updates a complete thing definition. Drivers must increment the
+	// revision of the thing with each call and store it in the Revision
+	// field of the passed thing. The first revision of a thing is 1
 	Set(context.Context, *spec.Thing, *SetOptions) error
 
 	// Delete deletes a thing from the storage
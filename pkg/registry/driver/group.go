@@ -0,0 +1,53 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+var (
+	// ErrGroupExists is returned if the given group ID already exists
+	ErrGroupExists = errors.NewWithStatus(http.StatusConflict, "group ID already exists")
+
+	// ErrUnknownGroup indicates that the requested group does not exist
+	ErrUnknownGroup = errors.NewWithStatus(http.StatusNotFound, "unknown group")
+
+	// ErrGroupsNotSupported is returned if the driver cannot store groups
+	ErrGroupsNotSupported = errors.NewWithStatus(http.StatusNotImplemented, "driver does not support groups")
+
+	// ErrGroupRevisionMismatch is returned if the revision of a group does
+	// not match the expected revision
+	ErrGroupRevisionMismatch = errors.NewWithStatus(http.StatusPreconditionFailed, "group has been modified")
+)
+
+// GroupDriver may be implemented by drivers that can store groups. The
+// ExpectedRevision of DeleteOptions is ignored for groups. Drivers must not
+// return groups that may be modified by the caller
+type GroupDriver interface {
+	// GetGroup returns the group identified by ID or ErrUnknownGroup
+	GetGroup(context.Context, string) (*spec.Group, error)
+
+	// SetGroup stores a group definition. If the ExpectedRevision of
+	// SetOptions does not match, ErrGroupRevisionMismatch is returned.
+	// Like Driver.Set, it must increment the revision of the group and
+	// store it in the Revision field of the passed group
+	SetGroup(context.Context, *spec.Group, *SetOptions) error
+
+	// DeleteGroup deletes a group from the storage
+	DeleteGroup(context.Context, string, *DeleteOptions) (*spec.Group, error)
+
+	// GroupIDs returns a slice of all group IDs
+	GroupIDs(context.Context) ([]string, error)
+}
+
+// Groups returns d as a GroupDriver or ErrGroupsNotSupported
+func Groups(d Driver) (GroupDriver, error) {
+	if g, ok := d.(GroupDriver); ok {
+		return g, nil
+	}
+
+	return nil, ErrGroupsNotSupported
+}
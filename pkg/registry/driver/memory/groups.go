@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// copyGroup returns a copy of g so callers cannot modify stored groups
+func copyGroup(g *spec.Group) *spec.Group {
+	c := *g
+	c.Things = append([]string(nil), g.Things...)
+	return &c
+}
+
+// GetGroup implements driver.GroupDriver
+func (mem *memDriver) GetGroup(ctx context.Context, id string) (*spec.Group, error) {
+	if !mem.m.TryLock(ctx) {
+		return nil, ctx.Err()
+	}
+	defer mem.m.Unlock()
+
+	g, ok := mem.groups[id]
+	if !ok {
+		return nil, driver.ErrUnknownGroup
+	}
+
+	return copyGroup(g), nil
+}
+
+// SetGroup implements driver.GroupDriver
+func (mem *memDriver) SetGroup(ctx context.Context, g *spec.Group, opts *driver.SetOptions) error {
+	if opts == nil {
+		opts = &driver.SetOptions{}
+	}
+
+	if opts.UpdateOnly && opts.CreateOnly {
+		return driver.ErrInvalidOptions
+	}
+
+	if !mem.m.TryLock(ctx) {
+		return ctx.Err()
+	}
+	defer mem.m.Unlock()
+
+	existing, ok := mem.groups[g.ID]
+
+	if opts.CreateOnly && ok {
+		return driver.ErrGroupExists
+	}
+
+	if opts.UpdateOnly && !ok {
+		return driver.ErrUnknownGroup
+	}
+
+	var revision uint64
+	if ok {
+		revision = existing.Revision
+	}
+
+	if opts.ExpectedRevision != 0 && opts.ExpectedRevision != revision {
+		return driver.ErrGroupRevisionMismatch
+	}
+
+	g.Revision = revision + 1
+	mem.groups[g.ID] = copyGroup(g)
+
+	return nil
+}
+
+// DeleteGroup implements driver.GroupDriver
+func (mem *memDriver) DeleteGroup(ctx context.Context, id string, opts *driver.DeleteOptions) (*spec.Group, error) {
+	if !mem.m.TryLock(ctx) {
+		return nil, ctx.Err()
+	}
+	defer mem.m.Unlock()
+
+	g, ok := mem.groups[id]
+	if !ok {
+		if opts != nil && opts.MustExist {
+			return nil, driver.ErrUnknownGroup
+		}
+
+		return nil, nil
+	}
+
+	delete(mem.groups, id)
+
+	return g, nil
+}
+
+// GroupIDs implements driver.GroupDriver
+func (mem *memDriver) GroupIDs(ctx context.Context) ([]string, error) {
+	ids := []string{}
+
+	if !mem.m.TryLock(ctx) {
+		return nil, ctx.Err()
+	}
+	defer mem.m.Unlock()
+
+	for id := range mem.groups {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
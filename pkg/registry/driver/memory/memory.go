@@ -18,6 +18,7 @@ func init() {
 type memDriver struct {
 	m          *mutex.Mutex
 	things     map[string]*spec.Thing
+	groups     map[string]*spec.Group
 	itemStores map[string]*itemValues
 }
 
@@ -26,6 +27,7 @@ func New() driver.Driver {
 	return &memDriver{
 		m:          mutex.New(),
 		things:     make(map[string]*spec.Thing),
+		groups:     make(map[string]*spec.Group),
 		itemStores: make(map[string]*itemValues),
 	}
 }
@@ -58,18 +60,26 @@ func (mem *memDriver) Set(ctx context.Context, thing *spec.Thing, opts *driver.S
 	}
 	defer mem.m.Unlock()
 
-	if opts.CreateOnly || opts.UpdateOnly {
-		_, ok := mem.things[thing.ID]
+	existing, ok := mem.things[thing.ID]
 
-		if opts.CreateOnly && ok {
-			return driver.ErrThingExists
-		}
+	if opts.CreateOnly && ok {
+		return driver.ErrThingExists
+	}
+
+	if opts.UpdateOnly && !ok {
+		return driver.ErrUnknownThing
+	}
+
+	var revision uint64
+	if ok {
+		revision = existing.Revision
+	}
 
-		if opts.UpdateOnly && !ok {
-			return driver.ErrUnknownThing
-		}
+	if opts.ExpectedRevision != 0 && opts.ExpectedRevision != revision {
+		return driver.ErrRevisionMismatch
 	}
 
+	thing.Revision = revision + 1
 	mem.things[thing.ID] = thing
 
 	return nil
@@ -86,6 +96,10 @@ func (mem *memDriver) Delete(ctx context.Context, id string, opts *driver.Delete
 		return nil, driver.ErrUnknownThing
 	}
 
+	if opts != nil && opts.ExpectedRevision != 0 && (!ok || t.Revision != opts.ExpectedRevision) {
+		return nil, driver.ErrRevisionMismatch
+	}
+
 	delete(mem.things, id)
 
 	return t, nil
@@ -112,6 +126,21 @@ func (mem *memDriver) IDs(ctx context.Context) ([]string, error) {
 	return ids, nil
 }
 
+// Query implements driver.Querier
+func (mem *memDriver) Query(ctx context.Context, q *driver.Query) (*driver.Page, error) {
+	if !mem.m.TryLock(ctx) {
+		return nil, ctx.Err()
+	}
+	defer mem.m.Unlock()
+
+	things := make([]*spec.Thing, 0, len(mem.things))
+	for _, t := range mem.things {
+		things = append(things, t)
+	}
+
+	return q.Apply(things)
+}
+
 func (mem *memDriver) ItemValues(ctx context.Context, thingID string, itemID string) (driver.ValueStore, error) {
 	id := fmt.Sprintf("%s/%s", thingID, itemID)
 	if !mem.m.TryLock(ctx) {
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Revision(t *testing.T) {
+	ctx := context.Background()
+	drv := New()
+
+	thing := &spec.Thing{ID: "lamp"}
+	assert.Nil(t, drv.Set(ctx, thing, &driver.SetOptions{CreateOnly: true}))
+	assert.Equal(t, uint64(1), thing.Revision)
+
+	updated := &spec.Thing{ID: "lamp", Title: "Lamp"}
+	assert.Equal(t, driver.ErrRevisionMismatch, drv.Set(ctx, updated, &driver.SetOptions{ExpectedRevision: 2}))
+	assert.Nil(t, drv.Set(ctx, updated, &driver.SetOptions{ExpectedRevision: 1}))
+	assert.Equal(t, uint64(2), updated.Revision)
+
+	// a zero revision disables the check
+	assert.Nil(t, drv.Set(ctx, &spec.Thing{ID: "lamp"}, nil))
+
+	stored, err := drv.Get(ctx, "lamp")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), stored.Revision)
+
+	_, err = drv.Delete(ctx, "lamp", &driver.DeleteOptions{ExpectedRevision: 2})
+	assert.Equal(t, driver.ErrRevisionMismatch, err)
+
+	_, err = drv.Delete(ctx, "lamp", &driver.DeleteOptions{ExpectedRevision: 3})
+	assert.Nil(t, err)
+}
+
+func Test_GroupRevision(t *testing.T) {
+	ctx := context.Background()
+	drv := New().(driver.GroupDriver)
+
+	group := &spec.Group{ID: "lights"}
+	assert.Nil(t, drv.SetGroup(ctx, group, &driver.SetOptions{CreateOnly: true}))
+	assert.Equal(t, uint64(1), group.Revision)
+
+	updated := &spec.Group{ID: "lights", Things: []string{"lamp"}}
+	assert.Equal(t, driver.ErrGroupRevisionMismatch, drv.SetGroup(ctx, updated, &driver.SetOptions{ExpectedRevision: 2}))
+	assert.Nil(t, drv.SetGroup(ctx, updated, &driver.SetOptions{ExpectedRevision: 1}))
+	assert.Equal(t, uint64(2), updated.Revision)
+
+	// a zero revision disables the check
+	assert.Nil(t, drv.SetGroup(ctx, &spec.Group{ID: "lights"}, nil))
+
+	stored, err := drv.GetGroup(ctx, "lights")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), stored.Revision)
+}
@@ -2,7 +2,6 @@ package memory
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/mutex"
@@ -53,13 +52,34 @@ func (iv *itemValues) Current(ctx context.Context) (interface{}, error) {
 	return last, nil
 }
 
+// Filter returns all values stored between from and to in the order
+// they have been put. A zero from or to leaves the range open
 func (iv *itemValues) Filter(ctx context.Context, from time.Time, to time.Time) (<-chan interface{}, error) {
 	if !iv.l.TryLock(ctx) {
 		return nil, ctx.Err()
 	}
 	defer iv.l.Unlock()
 
-	return nil, fmt.Errorf("not yet implemented")
+	var values []interface{}
+	for idx, ts := range iv.timestamps {
+		if !from.IsZero() && ts.Before(from) {
+			continue
+		}
+
+		if !to.IsZero() && ts.After(to) {
+			continue
+		}
+
+		values = append(values, iv.values[idx])
+	}
+
+	ch := make(chan interface{}, len(values))
+	for _, v := range values {
+		ch <- v
+	}
+	close(ch)
+
+	return ch, nil
 }
 
 func (iv *itemValues) Clear(ctx context.Context) error {
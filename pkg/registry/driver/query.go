@@ -0,0 +1,258 @@
+package driver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// Sort orders supported by Query
+const (
+	// SortByID sorts things by their ID
+	SortByID = "id"
+
+	// SortByTitle sorts things by their title. Things with the same title
+	// are sorted by ID
+	SortByTitle = "title"
+)
+
+var (
+	// ErrInvalidCursor is returned if the cursor of a query is malformed
+	ErrInvalidCursor = errors.NewWithStatus(http.StatusBadRequest, "invalid cursor")
+
+	// ErrInvalidSort is returned if a query uses an unsupported sort order
+	ErrInvalidSort = errors.NewWithStatus(http.StatusBadRequest, "invalid sort order")
+)
+
+// Query describes a filtered, sorted and paginated list of things
+type Query struct {
+	// Type may hold a @type annotation the thing must have
+	Type string
+
+	// Location may hold a glob pattern (see path.Match) the location
+	// of the thing must match
+	Location string
+
+	// Title may hold a text the title of the thing must contain. The
+	// comparison is case-insensitive
+	Title string
+
+	// PropertyType may hold a @type annotation at least one property
+	// of the thing must have
+	PropertyType string
+
+	// Sort defines the order of the things and defaults to SortByID
+	Sort string
+
+	// Descending reverses the sort order
+	Descending bool
+
+	// Limit is the maximum number of things returned. Zero means no limit
+	Limit int
+
+	// Cursor may hold the Next cursor of a previous page
+	Cursor string
+
+	// Filter may hold an additional filter that is applied before
+	// pagination. It is used to hide things the client must not see
+	Filter func(*spec.Thing) bool
+}
+
+// Page is the result of a Query
+type Page struct {
+	// Things holds the things of the page in order
+	Things []*spec.Thing
+
+	// Next holds the cursor of the next page or an empty string if this
+	// is the last one
+	Next string
+}
+
+// Querier may be implemented by drivers that support querying things
+// natively. Drivers that don't are queried by filtering all things
+type Querier interface {
+	// Query returns the page of things matching q
+	Query(context.Context, *Query) (*Page, error)
+}
+
+// QueryThings queries the things stored in d. If d does not implement
+// Querier all things are loaded and filtered using q.Apply
+func QueryThings(ctx context.Context, d Driver, q *Query) (*Page, error) {
+	if querier, ok := d.(Querier); ok {
+		return querier.Query(ctx, q)
+	}
+
+	ids, err := d.IDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	things := make([]*spec.Thing, 0, len(ids))
+	for _, id := range ids {
+		t, err := d.Get(ctx, id)
+		if err != nil {
+			// seem like the thing has been deleted in between
+			if err == ErrUnknownThing {
+				continue
+			}
+
+			return nil, err
+		}
+
+		things = append(things, t)
+	}
+
+	return q.Apply(things)
+}
+
+// Validate checks the sort order and cursor of q
+func (q *Query) Validate() error {
+	switch q.Sort {
+	case "", SortByID, SortByTitle:
+	default:
+		return ErrInvalidSort
+	}
+
+	if q.Cursor != "" {
+		if _, err := decodeCursor(q.Cursor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if t matches all filters of q
+func (q *Query) Matches(t *spec.Thing) bool {
+	if q.Type != "" && !contains(t.TypeAnnotation, q.Type) {
+		return false
+	}
+
+	if q.Location != "" {
+		if ok, _ := path.Match(q.Location, t.Location); !ok {
+			return false
+		}
+	}
+
+	if q.Title != "" && !strings.Contains(strings.ToLower(t.Title), strings.ToLower(q.Title)) {
+		return false
+	}
+
+	if q.PropertyType != "" {
+		found := false
+		for _, p := range t.Properties {
+			if p.TypeAnnotation == q.PropertyType {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if q.Filter != nil && !q.Filter(t) {
+		return false
+	}
+
+	return true
+}
+
+// Apply filters, sorts and paginates things according to q. It may be
+// used by drivers that cannot push queries down to their storage
+func (q *Query) Apply(things []*spec.Thing) (*Page, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	matches := make([]*spec.Thing, 0, len(things))
+	for _, t := range things {
+		if t != nil && q.Matches(t) {
+			matches = append(matches, t)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return q.less(q.key(matches[i]), q.key(matches[j]))
+	})
+
+	start := 0
+	if q.Cursor != "" {
+		after, _ := decodeCursor(q.Cursor)
+		start = sort.Search(len(matches), func(i int) bool {
+			return q.less(after, q.key(matches[i]))
+		})
+	}
+	matches = matches[start:]
+
+	page := &Page{Things: matches}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		page.Things = matches[:q.Limit]
+		page.Next = encodeCursor(q.key(page.Things[q.Limit-1]))
+	}
+
+	return page, nil
+}
+
+// cursor is the sort key of a thing. Cursors point to the last thing
+// of a page
+type cursor [2]string
+
+func (q *Query) key(t *spec.Thing) cursor {
+	if q.Sort == SortByTitle {
+		return cursor{t.Title, t.ID}
+	}
+
+	return cursor{t.ID, ""}
+}
+
+// less reports whether a sorts before b in the order of q
+func (q *Query) less(a, b cursor) bool {
+	if q.Descending {
+		a, b = b, a
+	}
+
+	if a[0] != b[0] {
+		return a[0] < b[0]
+	}
+
+	return a[1] < b[1]
+}
+
+func encodeCursor(c cursor) string {
+	blob, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(blob)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	blob, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(blob, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
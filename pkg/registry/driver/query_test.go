@@ -0,0 +1,77 @@
+package driver
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(page *Page) []string {
+	var res []string
+	for _, t := range page.Things {
+		res = append(res, t.ID)
+	}
+	return res
+}
+
+func Test_QueryApply(t *testing.T) {
+	things := []*spec.Thing{
+		{ID: "tv", Title: "Television", TypeAnnotation: []string{"OnOffSwitch"}, Location: "living-room"},
+		{ID: "lamp", Title: "Ceiling Light", TypeAnnotation: []string{"Light", "OnOffSwitch"}, Location: "living-room"},
+		{ID: "weather", Title: "Weather", Properties: map[string]*spec.Property{
+			"temperature": {TypeAnnotation: "TemperatureProperty"},
+		}},
+		{ID: "desk", Title: "Desk Light", TypeAnnotation: []string{"Light"}, Location: "office"},
+		nil,
+	}
+
+	cases := []struct {
+		q   Query
+		ids []string
+	}{
+		{Query{}, []string{"desk", "lamp", "tv", "weather"}},
+		{Query{Type: "Light"}, []string{"desk", "lamp"}},
+		{Query{Location: "living*"}, []string{"lamp", "tv"}},
+		{Query{Title: "light"}, []string{"desk", "lamp"}},
+		{Query{PropertyType: "TemperatureProperty"}, []string{"weather"}},
+		{Query{Sort: SortByTitle}, []string{"lamp", "desk", "tv", "weather"}},
+		{Query{Sort: SortByID, Descending: true}, []string{"weather", "tv", "lamp", "desk"}},
+		{Query{Filter: func(t *spec.Thing) bool { return t.ID != "tv" }}, []string{"desk", "lamp", "weather"}},
+	}
+
+	for _, c := range cases {
+		page, err := c.q.Apply(things)
+		assert.Nil(t, err)
+		assert.Equal(t, c.ids, ids(page), "%+v", c.q)
+		assert.Empty(t, page.Next)
+	}
+
+	// paginate through all things sorted by title
+	q := &Query{Sort: SortByTitle, Limit: 3}
+	page, err := q.Apply(things)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"lamp", "desk", "tv"}, ids(page))
+	assert.NotEmpty(t, page.Next)
+
+	q.Cursor = page.Next
+	page, err = q.Apply(things)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"weather"}, ids(page))
+	assert.Empty(t, page.Next)
+
+	// things added before the cursor are not returned twice
+	q = &Query{Limit: 2}
+	page, _ = q.Apply(things)
+	assert.Equal(t, []string{"desk", "lamp"}, ids(page))
+
+	q.Cursor = page.Next
+	page, _ = q.Apply(append(things, &spec.Thing{ID: "alarm"}))
+	assert.Equal(t, []string{"tv", "weather"}, ids(page))
+
+	_, err = (&Query{Cursor: "%%%"}).Apply(things)
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	_, err = (&Query{Sort: "location"}).Apply(things)
+	assert.Equal(t, ErrInvalidSort, err)
+}
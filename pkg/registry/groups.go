@@ -0,0 +1,250 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+var (
+	// ErrUnknownParentGroup is returned if the parent of a group does not exist
+	ErrUnknownParentGroup = errors.NewWithStatus(http.StatusBadRequest, "unknown parent group")
+
+	// ErrInvalidGroupNesting is returned if a group would be nested in a
+	// group of another kind
+	ErrInvalidGroupNesting = errors.NewWithStatus(http.StatusBadRequest, "locations may only be nested in locations and groups in groups")
+
+	// ErrGroupCycle is returned if a group would become its own ancestor
+	ErrGroupCycle = errors.NewWithStatus(http.StatusBadRequest, "group cannot be nested in itself")
+
+	// ErrGroupHasChildren is returned when deleting a group that still
+	// has sub-groups
+	ErrGroupHasChildren = errors.NewWithStatus(http.StatusConflict, "group has sub-groups")
+)
+
+// AllGroups returns all groups sorted by ID
+func (r *registry) AllGroups(ctx context.Context) ([]*spec.Group, error) {
+	gd, err := driver.Groups(r.drv)
+	if err != nil {
+		return nil, err
+	}
+
+	return allGroups(ctx, gd)
+}
+
+// GetGroup returns a single group
+func (r *registry) GetGroup(ctx context.Context, id string) (*spec.Group, error) {
+	gd, err := driver.Groups(r.drv)
+	if err != nil {
+		return nil, err
+	}
+
+	return gd.GetGroup(ctx, id)
+}
+
+// CreateGroup creates a new group
+func (r *registry) CreateGroup(ctx context.Context, g *spec.Group) error {
+	return r.setGroup(ctx, g, &driver.SetOptions{CreateOnly: true})
+}
+
+// UpdateGroup updates an existing group
+func (r *registry) UpdateGroup(ctx context.Context, g *spec.Group) error {
+	return r.setGroup(ctx, g, &driver.SetOptions{
+		UpdateOnly:       true,
+		ExpectedRevision: g.Revision,
+	})
+}
+
+// DeleteGroup deletes a group. Groups that still have sub-groups cannot
+// be deleted
+func (r *registry) DeleteGroup(ctx context.Context, id string) error {
+	gd, err := driver.Groups(r.drv)
+	if err != nil {
+		return err
+	}
+
+	r.groups.Lock()
+	defer r.groups.Unlock()
+
+	groups, err := allGroups(ctx, gd)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		if g.Parent == id {
+			return ErrGroupHasChildren
+		}
+	}
+
+	_, err = gd.DeleteGroup(ctx, id, &driver.DeleteOptions{MustExist: true})
+	return err
+}
+
+func (r *registry) setGroup(ctx context.Context, g *spec.Group, opts *driver.SetOptions) error {
+	gd, err := driver.Groups(r.drv)
+	if err != nil {
+		return err
+	}
+
+	if err := spec.ValidateGroup(g); err != nil {
+		return err
+	}
+
+	// references must not change until the group is stored
+	r.groups.Lock()
+	defer r.groups.Unlock()
+
+	groups, err := allGroups(ctx, gd)
+	if err != nil {
+		return err
+	}
+
+	if err := checkGroupReferences(g, groups); err != nil {
+		return err
+	}
+
+	return gd.SetGroup(ctx, g, opts)
+}
+
+// checkGroupReferences makes sure the parent of g exists and g is
+// neither nested in a group of another kind nor in itself
+func checkGroupReferences(g *spec.Group, groups []*spec.Group) error {
+	byID := make(map[string]*spec.Group, len(groups))
+	for _, other := range groups {
+		byID[other.ID] = other
+
+		if other.Parent == g.ID && other.ID != g.ID && other.Kind != g.Kind {
+			return ErrInvalidGroupNesting
+		}
+	}
+
+	if g.Parent == "" {
+		return nil
+	}
+
+	parent, ok := byID[g.Parent]
+	if !ok {
+		return ErrUnknownParentGroup
+	}
+
+	if parent.Kind != g.Kind {
+		return ErrInvalidGroupNesting
+	}
+
+	seen := map[string]bool{g.ID: true}
+	for parent != nil {
+		if seen[parent.ID] {
+			return ErrGroupCycle
+		}
+		seen[parent.ID] = true
+
+		parent = byID[parent.Parent]
+	}
+
+	return nil
+}
+
+func allGroups(ctx context.Context, gd driver.GroupDriver) ([]*spec.Group, error) {
+	ids, err := gd.GroupIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]*spec.Group, 0, len(ids))
+	for _, id := range ids {
+		g, err := gd.GetGroup(ctx, id)
+		if err != nil {
+			// seem like the group has been deleted in between
+			if err == driver.ErrUnknownGroup {
+				continue
+			}
+
+			return nil, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+
+	return groups, nil
+}
+
+// SubGroups returns the group id and all groups nested in it
+func SubGroups(ctx context.Context, r Registry, id string) ([]*spec.Group, error) {
+	root, err := r.GetGroup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := r.AllGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]*spec.Group)
+	for _, g := range groups {
+		if g.Parent != "" {
+			children[g.Parent] = append(children[g.Parent], g)
+		}
+	}
+
+	// groups are checked for cycles when stored but drivers may still
+	// return them, e.g. if modified externally
+	seen := map[string]bool{root.ID: true}
+	result := []*spec.Group{root}
+	for i := 0; i < len(result); i++ {
+		for _, child := range children[result[i].ID] {
+			if seen[child.ID] {
+				continue
+			}
+			seen[child.ID] = true
+
+			result = append(result, child)
+		}
+	}
+
+	return result, nil
+}
+
+// Members returns all things that are members of the group id or any of
+// its sub-groups sorted by ID. Things that have been added to a group but
+// do not exist anymore are ignored
+func Members(ctx context.Context, r Registry, id string) ([]*spec.Thing, error) {
+	groups, err := SubGroups(ctx, r, id)
+	if err != nil {
+		return nil, err
+	}
+
+	things, err := r.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*spec.Thing
+	for _, t := range things {
+		if t == nil {
+			continue
+		}
+
+		for _, g := range groups {
+			if g.Contains(t) {
+				members = append(members, t)
+				break
+			}
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+
+	return members, nil
+}
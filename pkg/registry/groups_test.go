@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Groups(t *testing.T) {
+	ctx := context.Background()
+	r := New(memory.New())
+
+	for _, g := range []*spec.Group{
+		{ID: "house", Kind: spec.GroupLocation},
+		{ID: "ground-floor", Kind: spec.GroupLocation, Parent: "house"},
+		{ID: "living-room", Kind: spec.GroupLocation, Parent: "ground-floor"},
+		{ID: "office", Kind: spec.GroupLocation, Parent: "house"},
+		{ID: "lights", Kind: spec.GroupGeneric, Things: []string{"desk", "unknown"}},
+	} {
+		assert.Nil(t, r.CreateGroup(ctx, g), g.ID)
+	}
+
+	for _, thing := range []*spec.Thing{
+		{ID: "tv", Location: "living-room"},
+		{ID: "desk", Location: "office"},
+		{ID: "weather"},
+	} {
+		assert.Nil(t, r.Create(ctx, thing))
+	}
+
+	cases := []struct {
+		g   *spec.Group
+		err error
+	}{
+		{&spec.Group{ID: "house", Kind: spec.GroupLocation}, driver.ErrGroupExists},
+		{&spec.Group{ID: "kitchen", Kind: spec.GroupLocation, Parent: "attic"}, ErrUnknownParentGroup},
+		{&spec.Group{ID: "kitchen", Kind: spec.GroupGeneric, Parent: "house"}, ErrInvalidGroupNesting},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.err, r.CreateGroup(ctx, c.g), c.g.ID)
+	}
+
+	// the house cannot be moved into one of its rooms
+	assert.Equal(t, ErrGroupCycle, r.UpdateGroup(ctx, &spec.Group{ID: "house", Kind: spec.GroupLocation, Parent: "living-room"}))
+
+	// locations with sub-locations cannot become generic groups
+	assert.Equal(t, ErrInvalidGroupNesting, r.UpdateGroup(ctx, &spec.Group{ID: "house", Kind: spec.GroupGeneric}))
+
+	assert.NotNil(t, r.UpdateGroup(ctx, &spec.Group{ID: "lights"}))
+
+	members := func(id string) []string {
+		things, err := Members(ctx, r, id)
+		assert.Nil(t, err)
+
+		var ids []string
+		for _, t := range things {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"desk", "tv"}, members("house"))
+	assert.Equal(t, []string{"tv"}, members("ground-floor"))
+	assert.Equal(t, []string{"desk"}, members("lights"))
+
+	_, err := Members(ctx, r, "attic")
+	assert.Equal(t, driver.ErrUnknownGroup, err)
+
+	assert.Equal(t, ErrGroupHasChildren, r.DeleteGroup(ctx, "ground-floor"))
+	assert.Nil(t, r.DeleteGroup(ctx, "living-room"))
+	assert.Nil(t, r.DeleteGroup(ctx, "ground-floor"))
+	assert.Equal(t, driver.ErrUnknownGroup, r.DeleteGroup(ctx, "ground-floor"))
+
+	groups, err := r.AllGroups(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, "house", groups[0].ID)
+}
+
+func Test_GroupRevision(t *testing.T) {
+	ctx := context.Background()
+	r := New(memory.New())
+
+	assert.Nil(t, r.CreateGroup(ctx, &spec.Group{ID: "lights", Kind: spec.GroupGeneric}))
+
+	first, err := r.GetGroup(ctx, "lights")
+	assert.Nil(t, err)
+	second, err := r.GetGroup(ctx, "lights")
+	assert.Nil(t, err)
+
+	first.Things = []string{"lamp"}
+	assert.Nil(t, r.UpdateGroup(ctx, first))
+
+	// the group has been modified since second has been read
+	second.Things = []string{"desk"}
+	assert.Equal(t, driver.ErrGroupRevisionMismatch, r.UpdateGroup(ctx, second))
+
+	stored, err := r.GetGroup(ctx, "lights")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"lamp"}, stored.Things)
+}
+
+func Test_SubGroupsCycle(t *testing.T) {
+	ctx := context.Background()
+	drv := memory.New()
+	r := New(drv)
+
+	// groups stored by the driver directly are not checked for cycles
+	for _, g := range []*spec.Group{
+		{ID: "a", Kind: spec.GroupGeneric, Parent: "b"},
+		{ID: "b", Kind: spec.GroupGeneric, Parent: "a"},
+	} {
+		assert.Nil(t, drv.(driver.GroupDriver).SetGroup(ctx, g, nil))
+	}
+
+	groups, err := SubGroups(ctx, r, "a")
+	assert.Nil(t, err)
+	assert.Len(t, groups, 2)
+}
+
+func Test_ConcurrentGroupNesting(t *testing.T) {
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		r := New(memory.New())
+		assert.Nil(t, r.CreateGroup(ctx, &spec.Group{ID: "a", Kind: spec.GroupGeneric}))
+		assert.Nil(t, r.CreateGroup(ctx, &spec.Group{ID: "b", Kind: spec.GroupGeneric}))
+
+		// nesting both groups into each other must not create a cycle
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for idx, g := range []*spec.Group{
+			{ID: "a", Kind: spec.GroupGeneric, Parent: "b"},
+			{ID: "b", Kind: spec.GroupGeneric, Parent: "a"},
+		} {
+			wg.Add(1)
+			go func(idx int, g *spec.Group) {
+				defer wg.Done()
+				errs[idx] = r.UpdateGroup(ctx, g)
+			}(idx, g)
+		}
+		wg.Wait()
+
+		assert.False(t, errs[0] == nil && errs[1] == nil, "both groups nested into each other")
+	}
+}
@@ -13,6 +13,10 @@ type Registry interface {
 	// All returns all things stored at the registry
 	All(context.Context) ([]*spec.Thing, error)
 
+	// Query returns a filtered, sorted and paginated list of things.
+	// It is pushed down to the driver if it implements driver.Querier
+	Query(context.Context, *driver.Query) (*driver.Page, error)
+
 	// Get returns the thing by ID
 	Get(context.Context, string) (*spec.Thing, error)
 
@@ -21,11 +25,34 @@ type Registry interface {
 	Create(context.Context, *spec.Thing) error
 
 	// Update updates an existing thing. The thing must already
-	// exist. It's not allowed to change the ID of a thing
+	// exist. It's not allowed to change the ID of a thing. If the
+	// Revision of the thing is set, the update fails with
+	// driver.ErrRevisionMismatch unless it matches the stored revision
 	Update(context.Context, *spec.Thing) error
 
-	// Delete a thing by ID
-	Delete(context.Context, string) error
+	// Delete a thing by ID. If revision is not zero, it must match the
+	// revision of the stored thing
+	Delete(context.Context, string, uint64) error
+
+	// AllGroups returns all groups sorted by ID. All group methods return
+	// driver.ErrGroupsNotSupported if the driver cannot store groups
+	AllGroups(context.Context) ([]*spec.Group, error)
+
+	// GetGroup returns the group by ID
+	GetGroup(context.Context, string) (*spec.Group, error)
+
+	// CreateGroup creates a new group. The ID of the group must not
+	// yet exist and its parent must exist
+	CreateGroup(context.Context, *spec.Group) error
+
+	// UpdateGroup updates an existing group. If the Revision of the
+	// group is set, the update fails with driver.ErrGroupRevisionMismatch
+	// unless it matches the stored revision
+	UpdateGroup(context.Context, *spec.Group) error
+
+	// DeleteGroup deletes a group by ID. Groups with sub-groups cannot
+	// be deleted
+	DeleteGroup(context.Context, string) error
 
 	// ItemValues allows to store and retrieve item values
 	ItemValues(context.Context, string, string) (driver.ValueStore, error)
@@ -54,14 +81,23 @@ func Open(driverName, driverOptions string) (Registry, error) {
 		return nil, err
 	}
 
+	return New(drv), nil
+}
+
+// New returns a new registry that uses drv as the storage backend
+func New(drv driver.Driver) Registry {
 	return &registry{
 		drv: drv,
-	}, nil
+	}
 }
 
 type registry struct {
 	drv driver.Driver
 
+	// groups serializes group changes so references are checked
+	// against the groups that are actually stored
+	groups sync.Mutex
+
 	notifiers        sync.RWMutex
 	createdNotifiers []func(*spec.Thing)
 	updatedNotifiers []func(*spec.Thing)
@@ -94,6 +130,11 @@ func (r *registry) All(ctx context.Context) ([]*spec.Thing, error) {
 	return things, nil
 }
 
+// Query returns the page of things matching q
+func (r *registry) Query(ctx context.Context, q *driver.Query) (*driver.Page, error) {
+	return driver.QueryThings(ctx, r.drv, q)
+}
+
 // Get returns a single thing defintion
 func (r *registry) Get(ctx context.Context, id string) (*spec.Thing, error) {
 	return r.drv.Get(ctx, id)
@@ -115,7 +156,8 @@ func (r *registry) Create(ctx context.Context, thing *spec.Thing) error {
 // Update an existing thing definition inside the registry
 func (r *registry) Update(ctx context.Context, thing *spec.Thing) error {
 	err := r.drv.Set(ctx, thing, &driver.SetOptions{
-		UpdateOnly: true,
+		UpdateOnly:       true,
+		ExpectedRevision: thing.Revision,
 	})
 
 	if err == nil {
@@ -126,9 +168,10 @@ func (r *registry) Update(ctx context.Context, thing *spec.Thing) error {
 }
 
 // Delete a thing definition from the registry
-func (r *registry) Delete(ctx context.Context, id string) error {
+func (r *registry) Delete(ctx context.Context, id string, revision uint64) error {
 	t, err := r.drv.Delete(ctx, id, &driver.DeleteOptions{
-		MustExist: true,
+		MustExist:        true,
+		ExpectedRevision: revision,
 	})
 
 	if err == nil {
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// getAuditLog handles `GET /api/v1/audit` and returns all audit entries
+// matching the query parameters thing, group, property, principal, kind, since,
+// until (RFC3339) and limit. Entries of things the client may not manage
+// are omitted
+func getAuditLog(ctx context.Context, m *macaron.Context, log *audit.Log, store registry.Registry, a *auth.Authenticator) interface{} {
+	filter := &audit.Filter{
+		ThingID:    m.Query("thing"),
+		GroupID:    m.Query("group"),
+		PropertyID: m.Query("property"),
+		Principal:  m.Query("principal"),
+		Kind:       audit.Kind(m.Query("kind")),
+	}
+
+	for key, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := m.Query(key); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return errors.NewWithStatus(400, "invalid `"+key+"` parameter")
+			}
+			*target = t
+		}
+	}
+
+	if v := m.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return errors.NewWithStatus(400, "invalid `limit` parameter")
+		}
+		filter.Limit = limit
+	}
+
+	// entries are checked before the limit is applied so hidden entries
+	// do not shorten the result
+	filter.Accept = func(e *audit.Entry) bool {
+		thing, err := store.Get(ctx, e.ThingID)
+		if err != nil {
+			// the thing may have been deleted in the meantime
+			thing = &spec.Thing{ID: e.ThingID}
+		}
+
+		return a.AuthorizeRequest(m, auth.OpAdmin, thing) == nil
+	}
+
+	entries, err := log.Query(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return entries
+}
@@ -0,0 +1,54 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetAuditLog(t *testing.T) {
+	s := newTestServer(t, &auth.Config{
+		Tokens: append(testTokens, auth.TokenConfig{Name: "lamp-admin", Token: "lamp-admin", Scopes: []auth.Scope{auth.ScopeAdmin}}),
+		Rules: []auth.Rule{
+			{Subjects: []string{"token:admin"}, Things: []string{"*"}, Operations: []auth.Operation{auth.OpAdmin}},
+			{Subjects: []string{"token:lamp-admin"}, Things: []string{"lamp"}, Operations: []auth.Operation{auth.OpAdmin}},
+		},
+	})
+	s.create(t, testThing("lamp", ""), testThing("washer", ""))
+
+	for _, id := range []string{"lamp", "lamp", "washer", "washer"} {
+		s.log.Record(context.Background(), &audit.Entry{Kind: audit.KindSet, ThingID: id, PropertyID: "on"}, nil)
+	}
+
+	query := func(token, params string) []*audit.Entry {
+		rec := s.do("GET", "/api/v1/audit"+params, token, "")
+		if !assert.Equal(t, http.StatusOK, rec.Code, params) {
+			return nil
+		}
+
+		var entries []*audit.Entry
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		return entries
+	}
+
+	assert.Len(t, query("admin", ""), 4)
+	assert.Len(t, query("admin", "?limit=1"), 1)
+	assert.Len(t, query("admin", "?thing=washer"), 2)
+
+	// entries of other things must not use up the limit
+	entries := query("lamp-admin", "?limit=1")
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "lamp", entries[0].ThingID)
+	}
+	assert.Len(t, query("lamp-admin", ""), 2)
+	assert.Len(t, query("lamp-admin", "?thing=washer"), 0)
+
+	assert.Equal(t, http.StatusBadRequest, s.do("GET", "/api/v1/audit?limit=-1", "admin", "").Code)
+	assert.Equal(t, http.StatusBadRequest, s.do("GET", "/api/v1/audit?since=yesterday", "admin", "").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("GET", "/api/v1/audit", "writer", "").Code)
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// maxBatchSize is the maximum number of requests accepted by a single
+// batch
+const maxBatchSize = 100
+
+// Operations supported by batch requests
+const (
+	batchRead = "read"
+	batchSet  = "set"
+)
+
+// batchRequest is a single request of a batch
+type batchRequest struct {
+	Op       string      `json:"op"`
+	Thing    string      `json:"thing"`
+	Property string      `json:"property"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// itemResult is the result of reading or setting a single property
+type itemResult struct {
+	Thing    string      `json:"thing,omitempty"`
+	Property string      `json:"property"`
+	Status   int         `json:"status"`
+	Value    interface{} `json:"value,omitempty"`
+	Error    error       `json:"error,omitempty"`
+}
+
+// setError sets the status of the result. A nil error marks set requests
+// as accepted
+func (r *itemResult) setError(err error) {
+	if err == nil {
+		r.Status = http.StatusAccepted
+		return
+	}
+
+	r.Error = errors.MayWrap(500, err)
+	r.Status = r.Error.(errors.HTTPError).StatusCode()
+}
+
+// resultStatus returns the HTTP status code for a list of results. If
+// any item failed 207 Multi-Status is returned
+func resultStatus(results []*itemResult) int {
+	status := http.StatusAccepted
+	for _, r := range results {
+		if r.Error != nil {
+			return http.StatusMultiStatus
+		}
+
+		if r.Status == http.StatusOK {
+			status = http.StatusOK
+		}
+	}
+
+	return status
+}
+
+// postBatch handles `POST /api/v1/batch` and reads or sets properties of
+// multiple things. Set requests are grouped by thing and published in the
+// order of the batch. Results are returned in the order of the requests
+func postBatch(ctx context.Context, m *macaron.Context, store registry.Registry, mc *control.MissionControl, a *auth.Authenticator) (int, interface{}) {
+	var requests []batchRequest
+
+	defer m.Req.Request.Body.Close()
+	if err := json.NewDecoder(m.Req.Request.Body).Decode(&requests); err != nil {
+		return render.Unspecified, errors.WrapWithStatus(400, err)
+	}
+
+	if len(requests) == 0 {
+		return render.Unspecified, errors.NewWithStatus(400, "empty batch")
+	}
+
+	if len(requests) > maxBatchSize {
+		return render.Unspecified, errors.NewWithStatus(http.StatusRequestEntityTooLarge, "too many requests in batch")
+	}
+
+	things := make(map[string]*spec.Thing)
+	getThing := func(id string) (*spec.Thing, error) {
+		if t, ok := things[id]; ok {
+			return t, nil
+		}
+
+		t, err := store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		things[id] = t
+		return t, nil
+	}
+
+	results := make([]*itemResult, len(requests))
+
+	// set requests are collected per thing and executed after all
+	// reads
+	var order []string
+	sets := make(map[string][]control.PropertyValue)
+	indexes := make(map[string][]int)
+
+	for idx, req := range requests {
+		result := &itemResult{
+			Thing:    req.Thing,
+			Property: req.Property,
+		}
+		results[idx] = result
+
+		var op auth.Operation
+		switch req.Op {
+		case batchRead:
+			op = auth.OpRead
+		case batchSet:
+			op = auth.OpSet
+		default:
+			result.setError(errors.NewWithStatus(400, "invalid operation: "+req.Op))
+			continue
+		}
+
+		thing, err := getThing(req.Thing)
+		if err != nil {
+			result.setError(err)
+			continue
+		}
+
+		if err := a.AuthorizeRequest(m, op, thing); err != nil {
+			result.setError(err)
+			continue
+		}
+
+		if thing.Property(req.Property) == nil {
+			result.setError(errors.NewWithStatus(404, "unknown property: "+req.Property))
+			continue
+		}
+
+		if op == auth.OpRead {
+			value, err := store.GetItemValue(ctx, thing.ID, req.Property)
+			if err != nil {
+				result.setError(err)
+				continue
+			}
+
+			result.Status = http.StatusOK
+			result.Value = value
+			continue
+		}
+
+		if _, ok := sets[thing.ID]; !ok {
+			order = append(order, thing.ID)
+		}
+		sets[thing.ID] = append(sets[thing.ID], control.PropertyValue{
+			PropertyID: req.Property,
+			Value:      req.Value,
+		})
+		indexes[thing.ID] = append(indexes[thing.ID], idx)
+	}
+
+	for _, thingID := range order {
+		for idx, err := range mc.SetItems(ctx, thingID, sets[thingID]) {
+			results[indexes[thingID][idx]].setError(err)
+		}
+	}
+
+	return resultStatus(results), results
+}
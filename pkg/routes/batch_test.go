@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PostBatch(t *testing.T) {
+	s := newTestServer(t, &auth.Config{
+		Tokens: testTokens,
+		Rules: []auth.Rule{
+			{Subjects: []string{"token:reader", "token:writer"}, Things: []string{"*"}, Operations: []auth.Operation{auth.OpRead}},
+			{Subjects: []string{"token:writer"}, Things: []string{"lamp"}, Operations: []auth.Operation{auth.OpSet}},
+		},
+	})
+	s.create(t, testThing("lamp", "kitchen"), testThing("washer", "bath"))
+
+	values, err := s.store.ItemValues(context.Background(), "washer", "temperature")
+	assert.Nil(t, err)
+	assert.Nil(t, values.Put(context.Background(), 40.0))
+
+	type result struct {
+		Thing    string      `json:"thing"`
+		Property string      `json:"property"`
+		Status   int         `json:"status"`
+		Value    interface{} `json:"value"`
+	}
+
+	cases := []struct {
+		token   string
+		body    string
+		status  int
+		results []result
+		topics  []string
+	}{
+		{
+			"reader",
+			`[{"op": "read", "thing": "washer", "property": "temperature"}]`,
+			http.StatusOK,
+			[]result{{"washer", "temperature", 200, 40.0}},
+			nil,
+		},
+		{
+			"writer",
+			`[{"op": "set", "thing": "lamp", "property": "on", "value": true}]`,
+			http.StatusAccepted,
+			[]result{{"lamp", "on", 202, nil}},
+			[]string{"things/lamp/on/set"},
+		},
+		{
+			// reads and sets of the same batch
+			"writer",
+			`[{"op": "set", "thing": "lamp", "property": "on", "value": false}, {"op": "read", "thing": "washer", "property": "temperature"}]`,
+			http.StatusOK,
+			[]result{{"lamp", "on", 202, nil}, {"washer", "temperature", 200, 40.0}},
+			[]string{"things/lamp/on/set"},
+		},
+		{
+			"writer",
+			`[{"op": "set", "thing": "washer", "property": "on", "value": true}, {"op": "set", "thing": "lamp", "property": "on", "value": true}]`,
+			http.StatusMultiStatus,
+			[]result{{"washer", "on", 403, nil}, {"lamp", "on", 202, nil}},
+			[]string{"things/lamp/on/set"},
+		},
+		{
+			"reader",
+			`[{"op": "set", "thing": "lamp", "property": "on", "value": true}]`,
+			http.StatusMultiStatus,
+			[]result{{"lamp", "on", 403, nil}},
+			nil,
+		},
+		{
+			"reader",
+			`[{"op": "read", "thing": "lamp", "property": "color"}, {"op": "read", "thing": "fridge", "property": "on"}, {"op": "toggle", "thing": "lamp", "property": "on"}]`,
+			http.StatusMultiStatus,
+			[]result{{"lamp", "color", 404, nil}, {"fridge", "on", 404, nil}, {"lamp", "on", 400, nil}},
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		before := len(s.client.topics())
+
+		rec := s.do("POST", "/api/v1/batch", c.token, c.body)
+		assert.Equal(t, c.status, rec.Code, c.body)
+
+		var results []result
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &results), c.body)
+		assert.Equal(t, c.results, results, c.body)
+
+		assert.ElementsMatch(t, c.topics, s.client.topics()[before:], c.body)
+	}
+}
+
+func Test_PostBatchInvalid(t *testing.T) {
+	s := newTestServer(t, &auth.Config{Tokens: testTokens})
+	s.create(t, testThing("lamp", "kitchen"))
+
+	read := `{"op": "read", "thing": "lamp", "property": "on"}`
+	batch := func(n int) string {
+		requests := make([]string, n)
+		for idx := range requests {
+			requests[idx] = read
+		}
+
+		return "[" + strings.Join(requests, ",") + "]"
+	}
+
+	assert.Equal(t, http.StatusBadRequest, s.do("POST", "/api/v1/batch", "reader", `[]`).Code)
+	assert.Equal(t, http.StatusBadRequest, s.do("POST", "/api/v1/batch", "reader", `{}`).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, s.do("POST", "/api/v1/batch", "reader", batch(maxBatchSize+1)).Code)
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, s.do("POST", "/api/v1/batch", "reader", batch(maxBatchSize)).Code)
+	assert.Equal(t, http.StatusUnauthorized, s.do("POST", "/api/v1/batch", "", batch(1)).Code)
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// Representations of a thing with distinct entity tags
+const (
+	// reprDefinition is the thing definition of the gateway
+	reprDefinition = ""
+
+	// reprTD is the W3C WoT thing description
+	reprTD = "td"
+)
+
+// etagEpoch is part of all entity tags. Revisions of in-memory registries
+// start again after a restart so tags of different processes must differ
+var etagEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// etag returns the entity tag of representation repr of the thing definition
+func etag(t *spec.Thing, repr string) string {
+	tag := etagEpoch + "-" + strconv.FormatUint(t.Revision, 10)
+	if repr != reprDefinition {
+		tag += "-" + repr
+	}
+
+	return `"` + tag + `"`
+}
+
+// setETag adds the entity tag of representation repr of t to the response
+func setETag(m *macaron.Context, t *spec.Thing, repr string) {
+	m.Resp.Header().Set("ETag", etag(t, repr))
+}
+
+// matchesETag returns true if header holds `*` or the entity tag of one of
+// the representations of t. Weak entity tags only match if weak is set
+func matchesETag(header string, t *spec.Thing, weak bool, reprs ...string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		for _, repr := range reprs {
+			if tag == etag(t, repr) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch checks the If-Match header of the request against the current
+// thing definition. It returns the revision that must be passed to the
+// registry to make sure the thing is not modified concurrently. Zero is
+// returned if the request does not contain an If-Match header. The entity
+// tags of all representations are accepted as they share the revision
+func checkIfMatch(m *macaron.Context, current *spec.Thing) (uint64, error) {
+	header := m.Req.Header.Get("If-Match")
+	if header == "" {
+		return 0, nil
+	}
+
+	if !matchesETag(header, current, false, reprDefinition, reprTD) {
+		return 0, driver.ErrRevisionMismatch
+	}
+
+	return current.Revision, nil
+}
+
+// notModified returns true if the If-None-Match header of the request
+// matches the entity tag of representation repr of t
+func notModified(m *macaron.Context, t *spec.Thing, repr string) bool {
+	header := m.Req.Header.Get("If-None-Match")
+
+	return header != "" && matchesETag(header, t, true, repr)
+}
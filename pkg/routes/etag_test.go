@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ETag(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.create(t, testThing("lamp", "kitchen"))
+
+	definition := s.do("GET", "/api/v1/things/lamp", "", "").Header().Get("ETag")
+	td := s.do("GET", "/api/v1/things/lamp", "", "", "Accept", wot.MediaType).Header().Get("ETag")
+
+	assert.NotEmpty(t, definition)
+	assert.NotEmpty(t, td)
+	assert.NotEqual(t, definition, td)
+	assert.Contains(t, definition, etagEpoch)
+
+	cases := []struct {
+		accept      string
+		ifNoneMatch string
+		status      int
+	}{
+		{"", definition, http.StatusNotModified},
+		{"", "W/" + definition, http.StatusNotModified},
+		{"", `"other", ` + definition, http.StatusNotModified},
+		{"", "*", http.StatusNotModified},
+		{"", td, http.StatusOK},
+		{"", `"1"`, http.StatusOK},
+		{wot.MediaType, td, http.StatusNotModified},
+		{wot.MediaType, definition, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		rec := s.do("GET", "/api/v1/things/lamp", "", "", "Accept", c.accept, "If-None-Match", c.ifNoneMatch)
+		assert.Equal(t, c.status, rec.Code, c.accept+" "+c.ifNoneMatch)
+	}
+}
+
+func Test_IfMatch(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.create(t, testThing("lamp", "kitchen"))
+
+	patch := func(ifMatch, title string) int {
+		return s.do("PATCH", "/api/v1/things/lamp", "", `{"title": "`+title+`"}`,
+			"Content-Type", mergePatchContentType,
+			"If-Match", ifMatch,
+		).Code
+	}
+
+	first := s.do("GET", "/api/v1/things/lamp", "", "").Header().Get("ETag")
+	td := s.do("GET", "/api/v1/things/lamp", "", "", "Accept", wot.MediaType).Header().Get("ETag")
+
+	assert.Equal(t, http.StatusOK, patch(first, "a"))
+
+	// the thing has been modified in between
+	assert.Equal(t, http.StatusPreconditionFailed, patch(first, "b"))
+	assert.Equal(t, http.StatusPreconditionFailed, patch(td, "b"))
+
+	// tags of a previous gateway process do not match
+	assert.Equal(t, http.StatusPreconditionFailed, patch(`"1"`, "b"))
+
+	// weak tags never match
+	current := s.do("GET", "/api/v1/things/lamp", "", "").Header().Get("ETag")
+	assert.Equal(t, http.StatusPreconditionFailed, patch("W/"+current, "b"))
+	assert.Equal(t, http.StatusOK, patch(current, "b"))
+
+	current = s.do("GET", "/api/v1/things/lamp", "", "", "Accept", wot.MediaType).Header().Get("ETag")
+	assert.Equal(t, http.StatusOK, patch(current, "c"))
+
+	assert.Equal(t, http.StatusOK, patch("*", "d"))
+
+	assert.Equal(t, http.StatusPreconditionFailed, s.do("DELETE", "/api/v1/things/lamp", "", "", "If-Match", first).Code)
+	assert.Equal(t, http.StatusAccepted, s.do("DELETE", "/api/v1/things/lamp", "", "", "If-Match", "*").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("DELETE", "/api/v1/things/lamp", "", "", "If-Match", "*").Code)
+}
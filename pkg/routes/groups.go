@@ -0,0 +1,400 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// groupSetRequest selects the properties of all group members that should
+// be set to Value. Either Property or PropertyType must be set
+type groupSetRequest struct {
+	// Property may hold the ID of the property to set
+	Property string `json:"property,omitempty"`
+
+	// PropertyType may hold the @type of the properties to set
+	PropertyType string `json:"propertyType,omitempty"`
+
+	// Value is the new value of the properties
+	Value interface{} `json:"value"`
+}
+
+// matches returns true if the request selects the property id
+func (r *groupSetRequest) matches(id string, prop *spec.Property) bool {
+	if r.Property != "" {
+		return id == r.Property
+	}
+
+	return prop.TypeAnnotation == r.PropertyType
+}
+
+// maxGroupUpdateAttempts limits how often a group is read and stored
+// again if it has been modified concurrently
+const maxGroupUpdateAttempts = 5
+
+// getGroups handles `GET /api/v1/groups` and returns all groups
+func getGroups(ctx context.Context, m *macaron.Context, store registry.Registry, a *auth.Authenticator) interface{} {
+	groups, err := store.AllGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	for idx, g := range groups {
+		groups[idx] = visibleGroup(ctx, m, store, a, g)
+	}
+
+	return groups
+}
+
+// getGroup handles `GET /api/v1/groups/:groupID` and returns the group
+func getGroup(ctx context.Context, m *macaron.Context, groupID GroupID, store registry.Registry, a *auth.Authenticator) interface{} {
+	group, err := store.GetGroup(ctx, string(groupID))
+	if err != nil {
+		return err
+	}
+
+	return visibleGroup(ctx, m, store, a, group)
+}
+
+// createGroup handles `POST /api/v1/groups` and creates a new group. The
+// client must be allowed to manage all things of the group
+func createGroup(ctx context.Context, m *macaron.Context, group spec.Group, store registry.Registry, a *auth.Authenticator) (int, interface{}) {
+	group.ApplyDefaults()
+
+	things, err := groupThings(ctx, m, store, a, nil, group.Things)
+	if err != nil {
+		return render.Unspecified, err
+	}
+	group.Things = things
+
+	if err := store.CreateGroup(ctx, &group); err != nil {
+		return render.Unspecified, err
+	}
+
+	return http.StatusCreated, group
+}
+
+// updateGroup handles `PUT /api/v1/groups/:groupID` and replaces the group.
+// The client must be allowed to manage all things added or removed. Things
+// it may not read are kept
+func updateGroup(ctx context.Context, m *macaron.Context, groupID GroupID, group spec.Group, store registry.Registry, a *auth.Authenticator) interface{} {
+	if string(groupID) != group.ID {
+		return errors.NewWithStatus(http.StatusForbidden, "group IDs cannot be changed")
+	}
+
+	group.ApplyDefaults()
+
+	updated, err := modifyGroup(ctx, store, group.ID, func(current *spec.Group) (bool, error) {
+		things, err := groupThings(ctx, m, store, a, current.Things, group.Things)
+		if err != nil {
+			return false, err
+		}
+
+		revision := current.Revision
+		*current = group
+		current.Things = things
+		current.Revision = revision
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return visibleGroup(ctx, m, store, a, updated)
+}
+
+// deleteGroup handles `DELETE /api/v1/groups/:groupID`. The client must be
+// allowed to manage all things of the group
+func deleteGroup(ctx context.Context, m *macaron.Context, groupID GroupID, store registry.Registry, a *auth.Authenticator) interface{} {
+	g, err := store.GetGroup(ctx, string(groupID))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range g.Things {
+		err := a.AuthorizeRequest(m, auth.OpAdmin, groupThing(ctx, store, id))
+		if err == driver.ErrUnknownThing {
+			// do not disclose which of the things is hidden
+			return auth.ErrNotPermitted
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := store.DeleteGroup(ctx, string(groupID)); err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
+
+// getGroupThings handles `GET /api/v1/groups/:groupID/things` and returns
+// all members of the group and its sub-groups the client may read
+func getGroupThings(ctx context.Context, m *macaron.Context, groupID GroupID, store registry.Registry, a *auth.Authenticator, base baseurl.URL) interface{} {
+	members, err := registry.Members(ctx, store, string(groupID))
+	if err != nil {
+		return err
+	}
+
+	models := []*thingModel{}
+
+	baseURL := thingsURL(base)
+	for _, t := range members {
+		if a.AuthorizeRequest(m, auth.OpRead, t) != nil {
+			continue
+		}
+
+		model, err := getThingModel(baseURL, t)
+		if err != nil {
+			return err
+		}
+
+		models = append(models, model)
+	}
+
+	return models
+}
+
+// addGroupThing handles `PUT /api/v1/groups/:groupID/things/:thingID` and
+// adds the thing to the group
+func addGroupThing(ctx context.Context, groupID GroupID, thingID ThingID, store registry.Registry) interface{} {
+	if _, err := store.Get(ctx, string(thingID)); err != nil {
+		return err
+	}
+
+	_, err := modifyGroup(ctx, store, string(groupID), func(group *spec.Group) (bool, error) {
+		if group.HasThing(string(thingID)) {
+			return false, nil
+		}
+
+		group.Things = append(group.Things, string(thingID))
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
+
+// removeGroupThing handles `DELETE /api/v1/groups/:groupID/things/:thingID`
+// and removes the thing from the group. Things that are members of a
+// location because of their Location cannot be removed
+func removeGroupThing(ctx context.Context, groupID GroupID, thingID ThingID, store registry.Registry) interface{} {
+	_, err := modifyGroup(ctx, store, string(groupID), func(group *spec.Group) (bool, error) {
+		if !group.HasThing(string(thingID)) {
+			return false, errors.NewWithStatus(404, "thing has not been added to the group")
+		}
+
+		things := make([]string, 0, len(group.Things))
+		for _, id := range group.Things {
+			if id != string(thingID) {
+				things = append(things, id)
+			}
+		}
+		group.Things = things
+
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
+
+// modifyGroup passes the current definition of the group id to fn and
+// stores it if fn reports a change. If the group has been modified in
+// between, fn is called again with the new definition
+func modifyGroup(ctx context.Context, store registry.Registry, id string, fn func(*spec.Group) (bool, error)) (*spec.Group, error) {
+	for attempt := 1; ; attempt++ {
+		group, err := store.GetGroup(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		changed, err := fn(group)
+		if err != nil {
+			return nil, err
+		}
+
+		if !changed {
+			return group, nil
+		}
+
+		err = store.UpdateGroup(ctx, group)
+		if err == driver.ErrGroupRevisionMismatch && attempt < maxGroupUpdateAttempts {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return group, nil
+	}
+}
+
+// groupThings returns the things of a group after the client replaced
+// current with requested. Things the client may not read are kept as it
+// cannot see them. Things added must exist and the client must be allowed
+// to manage all things added or removed
+func groupThings(ctx context.Context, m *macaron.Context, store registry.Registry, a *auth.Authenticator, current, requested []string) ([]string, error) {
+	isCurrent := make(map[string]bool, len(current))
+	for _, id := range current {
+		isCurrent[id] = true
+	}
+
+	things := []string{}
+	keep := make(map[string]bool)
+
+	for _, id := range requested {
+		if keep[id] {
+			continue
+		}
+		keep[id] = true
+		things = append(things, id)
+
+		if isCurrent[id] {
+			continue
+		}
+
+		thing, err := store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := a.AuthorizeRequest(m, auth.OpAdmin, thing); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range current {
+		if keep[id] {
+			continue
+		}
+
+		thing := groupThing(ctx, store, id)
+		if a.AuthorizeRequest(m, auth.OpRead, thing) != nil {
+			keep[id] = true
+			things = append(things, id)
+			continue
+		}
+
+		if err := a.AuthorizeRequest(m, auth.OpAdmin, thing); err != nil {
+			return nil, err
+		}
+	}
+
+	return things, nil
+}
+
+// visibleGroup returns a copy of g without the things the client may not
+// read
+func visibleGroup(ctx context.Context, m *macaron.Context, store registry.Registry, a *auth.Authenticator, g *spec.Group) *spec.Group {
+	copy := *g
+	copy.Things = nil
+
+	for _, id := range g.Things {
+		if a.AuthorizeRequest(m, auth.OpRead, groupThing(ctx, store, id)) == nil {
+			copy.Things = append(copy.Things, id)
+		}
+	}
+
+	return &copy
+}
+
+// groupThing returns the thing id of a group. Things that do not exist
+// anymore are returned with their ID only so access rules can still be
+// checked
+func groupThing(ctx context.Context, store registry.Registry, id string) *spec.Thing {
+	thing, err := store.Get(ctx, id)
+	if err != nil {
+		return &spec.Thing{ID: id}
+	}
+
+	return thing
+}
+
+// setGroupProperties handles `POST /api/v1/groups/:groupID/properties` and
+// sets the selected properties of all members of the group and its
+// sub-groups. Things the client may not read are skipped. It returns a
+// result per property
+func setGroupProperties(ctx context.Context, m *macaron.Context, groupID GroupID, store registry.Registry, mc *control.MissionControl, a *auth.Authenticator) (int, interface{}) {
+	var req groupSetRequest
+
+	defer m.Req.Request.Body.Close()
+	if err := json.NewDecoder(m.Req.Request.Body).Decode(&req); err != nil {
+		return render.Unspecified, errors.WrapWithStatus(400, err)
+	}
+
+	if (req.Property == "") == (req.PropertyType == "") {
+		return render.Unspecified, errors.NewWithStatus(400, "either property or propertyType must be set")
+	}
+
+	members, err := registry.Members(ctx, store, string(groupID))
+	if err != nil {
+		return render.Unspecified, err
+	}
+
+	results := []*itemResult{}
+
+	for _, t := range members {
+		if a.AuthorizeRequest(m, auth.OpRead, t) != nil {
+			continue
+		}
+
+		var values []control.PropertyValue
+		for id, prop := range t.Properties {
+			if prop.Readonly || !req.matches(id, prop) {
+				continue
+			}
+
+			values = append(values, control.PropertyValue{
+				PropertyID: id,
+				Value:      req.Value,
+			})
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].PropertyID < values[j].PropertyID
+		})
+
+		thingResults := make([]*itemResult, len(values))
+		for idx, v := range values {
+			thingResults[idx] = &itemResult{Thing: t.ID, Property: v.PropertyID}
+		}
+		results = append(results, thingResults...)
+
+		if err := a.AuthorizeRequest(m, auth.OpSet, t); err != nil {
+			for _, r := range thingResults {
+				r.setError(err)
+			}
+			continue
+		}
+
+		for idx, err := range mc.SetItems(ctx, t.ID, values) {
+			thingResults[idx].setError(err)
+		}
+	}
+
+	return resultStatus(results), results
+}
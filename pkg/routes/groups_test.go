@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// newGroupTestServer returns a test server with the things lamp and fan in
+// the kitchen and a washer. The token lamp-admin may only manage the lamp
+// and read the fan
+func newGroupTestServer(t *testing.T) *testServer {
+	all := []auth.Operation{auth.OpRead, auth.OpSet, auth.OpAdmin}
+
+	s := newTestServer(t, &auth.Config{
+		Tokens: append(testTokens, auth.TokenConfig{Name: "lamp-admin", Token: "lamp-admin", Scopes: []auth.Scope{auth.ScopeAdmin}}),
+		Rules: []auth.Rule{
+			{Subjects: []string{"token:admin"}, Things: []string{"*"}, Operations: all},
+			{Subjects: []string{"token:writer"}, Things: []string{"*"}, Operations: []auth.Operation{auth.OpRead, auth.OpSet}},
+			{Subjects: []string{"token:reader"}, Things: []string{"*"}, Operations: []auth.Operation{auth.OpRead}},
+			{Subjects: []string{"token:lamp-admin"}, Things: []string{"lamp"}, Operations: all},
+			{Subjects: []string{"token:lamp-admin"}, Things: []string{"fan"}, Operations: []auth.Operation{auth.OpRead}},
+		},
+	})
+	s.create(t, testThing("lamp", "kitchen"), testThing("fan", "kitchen"), testThing("washer", "bath"))
+
+	return s
+}
+
+// groupThingIDs returns the things of the group id as returned by the API
+func (s *testServer) groupThingIDs(t *testing.T, token, id string) []string {
+	rec := s.do("GET", "/api/v1/groups/"+id, token, "")
+	if !assert.Equal(t, http.StatusOK, rec.Code) {
+		return nil
+	}
+
+	var g spec.Group
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &g))
+
+	return g.Things
+}
+
+// storedThingIDs returns the things of the group id as stored in the
+// registry
+func (s *testServer) storedThingIDs(t *testing.T, id string) []string {
+	g, err := s.store.GetGroup(context.Background(), id)
+	if !assert.Nil(t, err) {
+		return nil
+	}
+
+	return g.Things
+}
+
+func Test_GroupMembership(t *testing.T) {
+	s := newGroupTestServer(t)
+
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "admin", `{"id": "appliances", "things": ["lamp", "washer", "lamp"]}`).Code)
+	assert.Equal(t, []string{"lamp", "washer"}, s.storedThingIDs(t, "appliances"))
+
+	assert.Equal(t, http.StatusNoContent, s.do("PUT", "/api/v1/groups/appliances/things/fan", "admin", "").Code)
+	assert.Equal(t, http.StatusNoContent, s.do("PUT", "/api/v1/groups/appliances/things/fan", "admin", "").Code)
+	assert.Equal(t, []string{"lamp", "washer", "fan"}, s.groupThingIDs(t, "admin", "appliances"))
+
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", "/api/v1/groups/appliances/things/fan", "admin", "").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("DELETE", "/api/v1/groups/appliances/things/fan", "admin", "").Code)
+	assert.Equal(t, []string{"lamp", "washer"}, s.storedThingIDs(t, "appliances"))
+
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/v1/groups/appliances/things/fridge", "admin", "").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/v1/groups/unknown/things/fan", "admin", "").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("POST", "/api/v1/groups", "admin", `{"id": "fridges", "things": ["fridge"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, s.do("PUT", "/api/v1/groups/appliances/things/fan", "writer", "").Code)
+}
+
+func Test_GroupACL(t *testing.T) {
+	s := newGroupTestServer(t)
+
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "admin", `{"id": "appliances", "things": ["lamp", "washer"]}`).Code)
+
+	// things the client may not read are hidden
+	assert.Equal(t, []string{"lamp"}, s.groupThingIDs(t, "lamp-admin", "appliances"))
+
+	rec := s.do("GET", "/api/v1/groups", "lamp-admin", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var groups []*spec.Group
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &groups))
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, []string{"lamp"}, groups[0].Things)
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		// the fan may only be read
+		{"PUT", "/api/v1/groups/appliances", `{"id": "appliances", "things": ["lamp", "fan"]}`, http.StatusForbidden},
+		{"POST", "/api/v1/groups", `{"id": "fans", "things": ["fan"]}`, http.StatusForbidden},
+		{"PUT", "/api/v1/groups/appliances/things/fan", "", http.StatusForbidden},
+		// the washer is not visible at all
+		{"POST", "/api/v1/groups", `{"id": "washers", "things": ["washer"]}`, http.StatusNotFound},
+		{"DELETE", "/api/v1/groups/appliances/things/washer", "", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.status, s.do(c.method, c.path, "lamp-admin", c.body).Code, c.method+" "+c.path+" "+c.body)
+	}
+	assert.Equal(t, []string{"lamp", "washer"}, s.storedThingIDs(t, "appliances"))
+
+	// removing the lamp keeps the hidden washer
+	rec = s.do("PUT", "/api/v1/groups/appliances", "lamp-admin", `{"id": "appliances", "title": "Appliances"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"washer"}, s.storedThingIDs(t, "appliances"))
+	assert.Empty(t, s.groupThingIDs(t, "lamp-admin", "appliances"))
+
+	g, err := s.store.GetGroup(context.Background(), "appliances")
+	assert.Nil(t, err)
+	assert.Equal(t, "Appliances", g.Title)
+
+	assert.Equal(t, http.StatusOK, s.do("PUT", "/api/v1/groups/appliances", "lamp-admin", `{"id": "appliances", "things": ["lamp"]}`).Code)
+	assert.Equal(t, []string{"lamp", "washer"}, s.storedThingIDs(t, "appliances"))
+
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "lamp-admin", `{"id": "lamps", "things": ["lamp"]}`).Code)
+
+	// groups may only be deleted if the client may manage all their things
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "admin", `{"id": "fans", "things": ["fan"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, s.do("DELETE", "/api/v1/groups/fans", "lamp-admin", "").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("DELETE", "/api/v1/groups/appliances", "lamp-admin", "").Code)
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", "/api/v1/groups/lamps", "lamp-admin", "").Code)
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", "/api/v1/groups/appliances", "admin", "").Code)
+
+	for _, id := range []string{"fans", "appliances", "lamps"} {
+		_, err := s.store.GetGroup(context.Background(), id)
+		assert.Equal(t, id == "fans", err == nil, id)
+	}
+}
+
+func Test_GroupFanOut(t *testing.T) {
+	s := newGroupTestServer(t)
+
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "admin", `{"id": "kitchen", "kind": "location"}`).Code)
+	assert.Equal(t, http.StatusCreated, s.do("POST", "/api/v1/groups", "admin", `{"id": "appliances", "things": ["washer"]}`).Code)
+
+	rec := s.do("GET", "/api/v1/groups/kitchen/things", "reader", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var members []struct {
+		Title string `json:"title"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &members))
+	assert.Len(t, members, 2)
+
+	rec = s.do("POST", "/api/v1/groups/kitchen/properties", "writer", `{"propertyType": "OnOffProperty", "value": true}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	topics := s.client.topics()
+	sort.Strings(topics)
+	assert.Equal(t, []string{"things/fan/on/set", "things/lamp/on/set"}, topics)
+
+	rec = s.do("POST", "/api/v1/groups/appliances/properties", "writer", `{"property": "on", "value": false}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Len(t, s.client.topics(), 3)
+
+	// the lamp admin may only read the fan
+	rec = s.do("POST", "/api/v1/groups/kitchen/properties", "lamp-admin", `{"property": "on", "value": false}`)
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+	assert.Len(t, s.client.topics(), 4)
+
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/api/v1/groups/kitchen/properties", "reader", `{"property": "on", "value": false}`).Code)
+	assert.Equal(t, http.StatusBadRequest, s.do("POST", "/api/v1/groups/kitchen/properties", "writer", `{"value": false}`).Code)
+}
+
+// racingRegistry modifies the group the first time it is updated through
+// it so the update fails
+type racingRegistry struct {
+	registry.Registry
+
+	raced bool
+}
+
+func (r *racingRegistry) UpdateGroup(ctx context.Context, g *spec.Group) error {
+	if !r.raced {
+		r.raced = true
+
+		other, err := r.Registry.GetGroup(ctx, g.ID)
+		if err != nil {
+			return err
+		}
+
+		other.Things = append(other.Things, "washer")
+		if err := r.Registry.UpdateGroup(ctx, other); err != nil {
+			return err
+		}
+	}
+
+	return r.Registry.UpdateGroup(ctx, g)
+}
+
+func Test_ModifyGroup(t *testing.T) {
+	ctx := context.Background()
+	store := &racingRegistry{Registry: registry.New(memory.New())}
+
+	assert.Nil(t, store.CreateGroup(ctx, &spec.Group{ID: "appliances", Kind: spec.GroupGeneric}))
+
+	calls := 0
+	g, err := modifyGroup(ctx, store, "appliances", func(g *spec.Group) (bool, error) {
+		calls++
+		g.Things = append(g.Things, "lamp")
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []string{"washer", "lamp"}, g.Things)
+
+	stored, err := store.GetGroup(ctx, "appliances")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"washer", "lamp"}, stored.Things)
+}
@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+)
+
+// healthCheckTimeout limits the time spent checking the registry
+const healthCheckTimeout = 2 * time.Second
+
+// getHealth handles `GET /healthz`. It reports the state of all components
+// and only fails if the registry cannot be reached
+func getHealth(ctx context.Context, mc *control.MissionControl) (int, interface{}) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	health := mc.Health(ctx)
+
+	if health.Registry.Status != control.StatusOK {
+		return http.StatusServiceUnavailable, health
+	}
+
+	return http.StatusOK, health
+}
+
+// getReadiness handles `GET /readyz`. It fails unless the MQTT client is
+// connected, the registry is reachable and all status topics are subscribed
+func getReadiness(ctx context.Context, mc *control.MissionControl) (int, interface{}) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	health := mc.Health(ctx)
+
+	if !health.Ready() {
+		return http.StatusServiceUnavailable, health
+	}
+
+	return http.StatusOK, health
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+// unavailableRegistry is a registry that cannot list its things
+type unavailableRegistry struct {
+	registry.Registry
+}
+
+func (unavailableRegistry) All(context.Context) ([]*spec.Thing, error) {
+	return nil, errors.New("connection refused")
+}
+
+func Test_Health(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	check := func(path string, status int) *control.Health {
+		rec := s.do("GET", path, "", "")
+		assert.Equal(t, status, rec.Code, path)
+
+		var h control.Health
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &h), path)
+		return &h
+	}
+
+	// no message has been received yet
+	h := check("/readyz", http.StatusOK)
+	assert.Nil(t, h.MQTT.LastMessage)
+	check("/healthz", http.StatusOK)
+
+	s.client.connected = false
+	h = check("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, control.StatusUnavailable, h.MQTT.Status)
+	assert.False(t, h.MQTT.Connected)
+	check("/healthz", http.StatusOK)
+	s.client.connected = true
+
+	mc, err := control.New(
+		control.WithRegistry(unavailableRegistry{s.store}),
+		control.WithMQTTClient(s.client),
+	)
+	assert.Nil(t, err)
+	s.m.Map(mc)
+
+	h = check("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, control.StatusUnavailable, h.Registry.Status)
+	assert.Equal(t, control.StatusOK, h.MQTT.Status)
+	check("/healthz", http.StatusServiceUnavailable)
+}
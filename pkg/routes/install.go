@@ -4,28 +4,42 @@ import (
 	"context"
 
 	"github.com/go-macaron/binding"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/metrics"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
 	"gopkg.in/macaron.v1"
 )
 
 type ThingID string
 type PropertyID string
+type GroupID string
 
-// Install will install all routes exposed via the REST API
-func Install(m *macaron.Macaron) error {
-	// directly expose the context via macarons dependecy injection
+// Params holds the names of all path parameters used by the REST API
+var Params = []string{":thingID", ":propID", ":tokenID", ":groupID"}
+
+// Install will install all routes exposed via the REST API. All routes are
+// mounted under prefix
+func Install(m *macaron.Macaron, prefix string) error {
+	// directly expose the context via macarons dependecy injection. The context
+	// carries the client so changes can be attributed in the audit log
 	m.Use(func(ctx *macaron.Context) {
-		ctx.MapTo(ctx.Req.Context(), (*context.Context)(nil))
-	})
+		actor := audit.Actor{
+			RemoteAddr: ctx.RemoteAddr(),
+		}
 
-	m.Get("/", func(ctx *macaron.Context) {
-		ctx.JSON(200, map[string]interface{}{
-			"version": "v1",
-		})
+		if p, _ := auth.PrincipalFrom(ctx); p != nil {
+			actor.Principal = p.Subject
+		}
+
+		ctx.MapTo(audit.WithActor(ctx.Req.Context(), actor), (*context.Context)(nil))
 	})
 
 	thingRequestBinding := binding.Bind(spec.Thing{})
+	groupRequestBinding := binding.Bind(spec.Group{})
 
 	thingID := func(ctx *macaron.Context) {
 		thingID := ctx.Params("thingID")
@@ -45,42 +59,151 @@ func Install(m *macaron.Macaron) error {
 
 		ctx.Map(PropertyID(propID))
 	}
+	groupID := func(ctx *macaron.Context) {
+		groupID := ctx.Params("groupID")
+		if groupID == "" {
+			ctx.JSON(400, errors.NewWithStatus(400, "invalid group ID"))
+			return
+		}
+
+		ctx.Map(GroupID(groupID))
+	}
+
+	read := auth.Require(auth.ScopeRead)
+	write := auth.Require(auth.ScopeWrite)
+	admin := auth.Require(auth.ScopeAdmin)
+
+	// thingAccess checks the access rules for the thing of the request. Unknown
+	// things are reported by the route handler itself
+	thingAccess := func(op auth.Operation) macaron.Handler {
+		return func(ctx *macaron.Context, thingID ThingID, store registry.Registry, a *auth.Authenticator) {
+			thing, err := store.Get(ctx.Req.Context(), string(thingID))
+			if err != nil {
+				return
+			}
+
+			if err := a.AuthorizeRequest(ctx, op, thing); err != nil {
+				ctx.JSON(err.(errors.HTTPError).StatusCode(), err)
+			}
+		}
+	}
+	// unrestricted rejects principals whose access is limited by rules
+	unrestricted := func(ctx *macaron.Context, a *auth.Authenticator) {
+		if err := a.AuthorizeUnrestricted(ctx); err != nil {
+			ctx.JSON(err.(errors.HTTPError).StatusCode(), err)
+		}
+	}
+
+	canRead := thingAccess(auth.OpRead)
+	canSet := thingAccess(auth.OpSet)
+	canAdmin := thingAccess(auth.OpAdmin)
+
+	m.Group(baseurl.NormalizePrefix(prefix), func() {
+		m.Get("/", func(ctx *macaron.Context) {
+			ctx.JSON(200, map[string]interface{}{
+				"version": "v1",
+			})
+		})
+
+		// health checks are not authenticated so they can be used
+		// by container orchestrators
+		m.Get("/healthz", getHealth)
+		m.Get("/readyz", getReadiness)
+
+		// /metrics
+		m.Get("/metrics", read, func(ctx *macaron.Context, e *metrics.Exporter, a *auth.Authenticator) {
+			e.Handler(func(t *spec.Thing) bool {
+				return a.AuthorizeRequest(ctx, auth.OpRead, t) == nil
+			}).ServeHTTP(ctx.Resp, ctx.Req.Request)
+		})
 
-	// /api/v1
-	m.Group("/api/v1", func() {
-
-		// /api/v1/things
-		m.Group("/things", func() {
-
-			m.Get("", getAllThings)
-			m.Post("", thingRequestBinding, createThing)
-
-			// /api/v1/things/{thingID}
-			m.Group("/:thingID", func() {
-				m.Get("", getThing)
-				m.Put("", thingRequestBinding, updateThing)
-				m.Delete("", deleteThing)
-
-				// /api/v1/things/{thingID}/properties
-				m.Group("/properties", func() {
-					m.Get("", getProperties)
-
-					// /api/v1/things/{thingID}/properties/{propID}
-					m.Group("/:propID", func() {
-						m.Get("", getProperty)
-						m.Get("/history", getValues)
-						m.Post("", setProperty)
-					}, propID)
-				})
-
-				m.Get("/actions", func() []string {
-					return []string{}
-				})
-				m.Get("/events", func() []string {
-					return []string{}
-				})
-
-			}, thingID)
+		// /api/v1
+		m.Group("/api/v1", func() {
+
+			// /api/v1/tokens
+			m.Group("/tokens", func() {
+				m.Get("", getTokens)
+				m.Post("", createToken)
+				m.Delete("/:tokenID", deleteToken)
+			}, admin, unrestricted)
+
+			// /api/v1/openapi.json
+			m.Get("/openapi.json", read, getOpenAPI)
+
+			// /api/v1/schema/thing
+			m.Get("/schema/thing", read, getDefinitionSchema)
+
+			// /api/v1/batch
+			m.Post("/batch", read, postBatch)
+
+			// /api/v1/audit
+			m.Get("/audit", admin, getAuditLog)
+
+			// /api/v1/payload
+			m.Group("/payload", func() {
+				m.Get("/handlers", read, getHandlerTypes)
+				m.Post("/test", admin, testHandler)
+			})
+
+			// /api/v1/groups
+			m.Group("/groups", func() {
+				m.Get("", read, getGroups)
+				m.Post("", admin, groupRequestBinding, createGroup)
+
+				// /api/v1/groups/{groupID}
+				m.Group("/:groupID", func() {
+					m.Get("", read, getGroup)
+					m.Put("", admin, groupRequestBinding, updateGroup)
+					m.Delete("", admin, deleteGroup)
+					m.Post("/properties", write, setGroupProperties)
+
+					// /api/v1/groups/{groupID}/things
+					m.Group("/things", func() {
+						m.Get("", read, getGroupThings)
+						m.Put("/:thingID", admin, thingID, canAdmin, addGroupThing)
+						m.Delete("/:thingID", admin, thingID, canAdmin, removeGroupThing)
+					})
+				}, groupID)
+			})
+
+			// /api/v1/things
+			m.Group("/things", func() {
+
+				m.Get("", read, getAllThings)
+				m.Post("", admin, thingRequestBinding, createThing)
+
+				// /api/v1/things/{thingID}
+				m.Group("/:thingID", func() {
+					m.Get("", read, canRead, getThing)
+					m.Put("", admin, canAdmin, thingRequestBinding, updateThing)
+					m.Patch("", admin, canAdmin, patchThing)
+					m.Delete("", admin, canAdmin, deleteThing)
+					m.Get("/schema", read, canRead, getThingSchema)
+
+					// /api/v1/things/{thingID}/properties
+					m.Group("/properties", func() {
+						m.Get("", read, canRead, getProperties)
+						m.Put("", write, canSet, setProperties)
+
+						// /api/v1/things/{thingID}/properties/{propID}
+						m.Group("/:propID", func() {
+							m.Get("", read, canRead, getProperty)
+							m.Get("/history", read, canRead, getValues)
+							m.Post("", write, canSet, setProperty)
+							m.Put("/definition", admin, canAdmin, putPropertyDefinition)
+							m.Delete("/definition", admin, canAdmin, deletePropertyDefinition)
+						}, propID)
+					})
+
+					m.Get("/actions", read, canRead, func() []string {
+						return []string{}
+					})
+					m.Get("/events", read, canRead, func() []string {
+						return []string{}
+					})
+
+				}, thingID)
+			})
 		})
 	})
 
@@ -3,10 +3,12 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
 	"github.com/sirupsen/logrus"
@@ -97,3 +99,84 @@ func setProperty(ctx context.Context, m *macaron.Context, thingID ThingID, propI
 
 	return http.StatusAccepted
 }
+
+// setProperties handles `PUT /api/v1/things/:thingID/properties` and sets
+// multiple properties at once. The properties are set in the order they
+// appear in the request body
+func setProperties(ctx context.Context, m *macaron.Context, thingID ThingID, store registry.Registry, mc *control.MissionControl) (int, interface{}) {
+	thing, err := store.Get(ctx, string(thingID))
+	if err != nil {
+		return render.Unspecified, err
+	}
+
+	defer m.Req.Request.Body.Close()
+	values, err := decodePropertyValues(m.Req.Request.Body)
+	if err != nil {
+		return render.Unspecified, errors.WrapWithStatus(400, err)
+	}
+
+	if len(values) == 0 {
+		return render.Unspecified, errors.NewWithStatus(400, "Invalid payload")
+	}
+
+	results := make([]*itemResult, len(values))
+	var pending []control.PropertyValue
+	var indexes []int
+
+	for idx, v := range values {
+		results[idx] = &itemResult{Property: v.PropertyID}
+
+		if thing.Property(v.PropertyID) == nil {
+			results[idx].setError(errors.NewWithStatus(404, "unknown property: "+v.PropertyID))
+			continue
+		}
+
+		pending = append(pending, v)
+		indexes = append(indexes, idx)
+	}
+
+	for idx, err := range mc.SetItems(ctx, thing.ID, pending) {
+		results[indexes[idx]].setError(err)
+	}
+
+	return resultStatus(results), results
+}
+
+// decodePropertyValues decodes a JSON object of property values while
+// keeping the order of its members
+func decodePropertyValues(r io.Reader) ([]control.PropertyValue, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.NewWithStatus(400, "expected a JSON object")
+	}
+
+	var values []control.PropertyValue
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		values = append(values, control.PropertyValue{
+			PropertyID: tok.(string),
+			Value:      value,
+		})
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
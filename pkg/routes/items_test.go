@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DecodePropertyValues(t *testing.T) {
+	cases := []struct {
+		body   string
+		values []control.PropertyValue
+		valid  bool
+	}{
+		{`{}`, nil, true},
+		{`{"on": true}`, []control.PropertyValue{{PropertyID: "on", Value: true}}, true},
+		{
+			`{"z": 1, "a": "x", "m": {"b": [1]}}`,
+			[]control.PropertyValue{
+				{PropertyID: "z", Value: 1.0},
+				{PropertyID: "a", Value: "x"},
+				{PropertyID: "m", Value: map[string]interface{}{"b": []interface{}{1.0}}},
+			},
+			true,
+		},
+		{`[{"on": true}]`, nil, false},
+		{`"on"`, nil, false},
+		{`{"on": }`, nil, false},
+		{`{"on": true`, nil, false},
+		{``, nil, false},
+	}
+
+	for _, c := range cases {
+		values, err := decodePropertyValues(strings.NewReader(c.body))
+		if !c.valid {
+			assert.NotNil(t, err, c.body)
+			continue
+		}
+
+		assert.Nil(t, err, c.body)
+		assert.Equal(t, c.values, values, c.body)
+	}
+}
+
+func Test_SetProperties(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.create(t, testThing("lamp", "kitchen"))
+
+	rec := s.do("PUT", "/api/v1/things/lamp/properties", "", `{"on": true}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, []string{"things/lamp/on/set"}, s.client.topics())
+
+	rec = s.do("PUT", "/api/v1/things/lamp/properties", "", `{"color": "red", "on": false}`)
+	assert.Equal(t, http.StatusMultiStatus, rec.Code)
+
+	var results []*struct {
+		Property string `json:"property"`
+		Status   int    `json:"status"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "color", results[0].Property)
+		assert.Equal(t, http.StatusNotFound, results[0].Status)
+		assert.Equal(t, "on", results[1].Property)
+		assert.Equal(t, http.StatusAccepted, results[1].Status)
+	}
+	assert.Len(t, s.client.topics(), 2)
+
+	assert.Equal(t, http.StatusBadRequest, s.do("PUT", "/api/v1/things/lamp/properties", "", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, s.do("PUT", "/api/v1/things/lamp/properties", "", `[]`).Code)
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/v1/things/unknown/properties", "", `{"on": true}`).Code)
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/openapi"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"gopkg.in/macaron.v1"
+)
+
+// getOpenAPI handles `GET /api/v1/openapi.json` and returns the OpenAPI
+// document of the REST API. Only things readable by the client are included
+func getOpenAPI(ctx context.Context, m *macaron.Context, g *openapi.Generator, a *auth.Authenticator, base baseurl.URL) interface{} {
+	doc, err := g.Document(ctx, string(base)+"/api/v1", func(t *spec.Thing) bool {
+		return a.AuthorizeRequest(m, auth.OpRead, t) == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return doc
+}
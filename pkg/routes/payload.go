@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	"gopkg.in/macaron.v1"
+)
+
+// maxTestTimeout is the upper limit for the `timeout` option of handlers
+// tested through the API as they run while the request is served
+const maxTestTimeout = time.Second
+
+type payloadTestRequest struct {
+	// Spec holds the handler specification to test
+	Spec payload.HandlerSpec `json:"spec"`
+
+	// Payload holds the sample payload
+	Payload string `json:"payload"`
+
+	// Encoding holds the encoding of Payload. One of text (default),
+	// base64 or hex
+	Encoding string `json:"encoding,omitempty"`
+
+	// Topic may hold the topic the sample payload is received on
+	Topic string `json:"topic,omitempty"`
+}
+
+// getHandlerTypes handles `GET /api/v1/payload/handlers` and returns all
+// registered handler types and their options
+func getHandlerTypes() interface{} {
+	return payload.Types()
+}
+
+// testHandler handles `POST /api/v1/payload/test` and parses a sample payload
+// using the provided handler specification. The `timeout` option of the
+// specification is limited to maxTestTimeout
+func testHandler(m *macaron.Context) interface{} {
+	var req payloadTestRequest
+
+	defer m.Req.Request.Body.Close()
+	if err := json.NewDecoder(m.Req.Request.Body).Decode(&req); err != nil {
+		return errors.WrapWithStatus(400, err)
+	}
+
+	req.Spec.LimitDuration("timeout", maxTestTimeout)
+
+	body, err := payload.DecodeSample(req.Payload, req.Encoding)
+	if err != nil {
+		return errors.MayWrap(400, err)
+	}
+
+	res, err := req.Spec.Test(payload.NewSampleMessage(body, req.Topic))
+	if err != nil {
+		return err
+	}
+
+	return res
+}
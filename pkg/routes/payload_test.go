@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/json"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/lua"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TestHandler(t *testing.T) {
+	s := newTestServer(t, &auth.Config{Tokens: testTokens})
+
+	cases := []struct {
+		token  string
+		body   string
+		status int
+		result map[string]interface{}
+	}{
+		{"admin", `{"spec": {"type": "json", "path": "$.a"}, "payload": "{\"a\": 1}"}`, 200, map[string]interface{}{"value": 1.0}},
+		{"admin", `{"spec": {"type": "json", "path": "$.b"}, "payload": "{\"a\": 1}"}`, 200, nil},
+		{"admin", `{"spec": {"type": "json", "path": "$.{{index .segments 1}}"}, "payload": "{\"b\": 2}", "topic": "a/b"}`, 200, map[string]interface{}{"value": 2.0}},
+		{"admin", `{"spec": {"type": "json"}, "payload": "7b2261223a20317d", "encoding": "hex"}`, 200, map[string]interface{}{"value": map[string]interface{}{"a": 1.0}}},
+		{"admin", `{"spec": {"type": "json"}, "payload": "eyJhIjogMX0=", "encoding": "base64"}`, 200, map[string]interface{}{"value": map[string]interface{}{"a": 1.0}}},
+		{"admin", `{"spec": {"type": "json"}, "payload": "zz", "encoding": "hex"}`, 400, nil},
+		{"admin", `{"spec": {"type": "json"}, "payload": "", "encoding": "rot13"}`, 400, nil},
+		{"admin", `{"spec": {}, "payload": ""}`, 400, nil},
+		{"admin", `{"payload": ""}`, 400, nil},
+		{"admin", `{"spec": `, 400, nil},
+		{"writer", `{"spec": {"type": "json"}, "payload": "{}"}`, 403, nil},
+		{"", `{"spec": {"type": "json"}, "payload": "{}"}`, 401, nil},
+	}
+
+	for _, c := range cases {
+		rec := s.do("POST", "/api/v1/payload/test", c.token, c.body)
+		assert.Equal(t, c.status, rec.Code, c.body)
+
+		if c.status != http.StatusOK {
+			continue
+		}
+
+		var res map[string]interface{}
+		assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+
+		if c.result == nil {
+			assert.NotEmpty(t, res["error"], c.body)
+		} else {
+			assert.Equal(t, c.result, res, c.body)
+		}
+	}
+}
+
+func Test_TestHandlerTimeout(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	start := time.Now()
+	rec := s.do("POST", "/api/v1/payload/test", "", `{"spec": {"type": "lua", "code": "while true do end", "timeout": "5s"}, "payload": ""}`)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "error")
+	assert.True(t, time.Since(start) < maxTestTimeout+time.Second, time.Since(start).String())
+}
+
+func Test_GetHandlerTypes(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	rec := s.do("GET", "/api/v1/payload/handlers", "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var types []struct {
+		Type    string `json:"type"`
+		Options []struct {
+			Name string `json:"name"`
+		} `json:"options"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &types))
+
+	options := make(map[string][]string)
+	for _, info := range types {
+		for _, o := range info.Options {
+			options[info.Type] = append(options[info.Type], o.Name)
+		}
+	}
+
+	assert.Equal(t, []string{"path"}, options["json"])
+	assert.Contains(t, options["lua"], "timeout")
+	assert.Empty(t, options["json-extended"])
+}
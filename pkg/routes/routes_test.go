@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/audit"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/control"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver/memory"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/macaron.v1"
+)
+
+// token is a completed mqtt.Token
+type token struct{}
+
+func (token) Wait() bool                     { return true }
+func (token) WaitTimeout(time.Duration) bool { return true }
+func (token) Error() error                   { return nil }
+
+// fakeClient is a mqtt.Client that records published messages
+type fakeClient struct {
+	l         sync.Mutex
+	connected bool
+	published []string
+}
+
+func (c *fakeClient) IsConnected() bool                    { return c.connected }
+func (c *fakeClient) IsConnectionOpen() bool               { return c.connected }
+func (c *fakeClient) Connect() mqtt.Token                  { return token{} }
+func (c *fakeClient) Disconnect(uint)                      {}
+func (c *fakeClient) AddRoute(string, mqtt.MessageHandler) {}
+func (c *fakeClient) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.published = append(c.published, topic)
+	return token{}
+}
+
+func (c *fakeClient) Subscribe(string, byte, mqtt.MessageHandler) mqtt.Token {
+	return token{}
+}
+
+func (c *fakeClient) SubscribeMultiple(map[string]byte, mqtt.MessageHandler) mqtt.Token {
+	return token{}
+}
+
+func (c *fakeClient) Unsubscribe(...string) mqtt.Token {
+	return token{}
+}
+
+// topics returns the topics of all published messages
+func (c *fakeClient) topics() []string {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return append([]string{}, c.published...)
+}
+
+// testTokens configures static API tokens named after their scope
+var testTokens = []auth.TokenConfig{
+	{Name: "reader", Token: "reader", Scopes: []auth.Scope{auth.ScopeRead}},
+	{Name: "writer", Token: "writer", Scopes: []auth.Scope{auth.ScopeWrite}},
+	{Name: "admin", Token: "admin", Scopes: []auth.Scope{auth.ScopeAdmin}},
+}
+
+// testServer serves the REST API backed by an in-memory registry
+type testServer struct {
+	m      *macaron.Macaron
+	store  registry.Registry
+	client *fakeClient
+	mc     *control.MissionControl
+	log    *audit.Log
+}
+
+// newTestServer returns a new test server. Authentication is disabled if
+// cfg is nil
+func newTestServer(t *testing.T, cfg *auth.Config) *testServer {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	store := registry.New(memory.New())
+	log := audit.New(audit.NewRegistrySink(store, audit.Retention{}), logger)
+	client := &fakeClient{connected: true}
+
+	mc, err := control.New(
+		control.WithRegistry(store),
+		control.WithMQTTClient(client),
+		control.WithLogger(logger),
+	)
+	assert.Nil(t, err)
+
+	a, err := auth.New(cfg)
+	assert.Nil(t, err)
+
+	m := macaron.New()
+	render.Bind(m)
+	m.Map(log)
+	m.MapTo(audit.Registry(store, log), (*registry.Registry)(nil))
+	m.Use(macaron.Renderer())
+	m.Map(a)
+	m.Use(a.Middleware())
+	m.Map(wot.Binding{Bearer: a.Enabled()})
+	m.Use(baseurl.Middleware(baseurl.Config{}))
+	m.Map(mc)
+
+	assert.Nil(t, Install(m, ""))
+
+	return &testServer{
+		m:      m,
+		store:  store,
+		client: client,
+		mc:     mc,
+		log:    log,
+	}
+}
+
+// create adds things to the registry of the server
+func (s *testServer) create(t *testing.T, things ...*spec.Thing) {
+	for _, thing := range things {
+		assert.Nil(t, s.store.Create(context.Background(), thing))
+	}
+}
+
+// do performs a request using the bearer token (if any) and returns the
+// response. Requests with a body are sent as JSON unless the Content-Type
+// header is set
+func (s *testServer) do(method, path, bearer, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	for idx := 0; idx+1 < len(header); idx += 2 {
+		req.Header.Set(header[idx], header[idx+1])
+	}
+
+	rec := httptest.NewRecorder()
+	s.m.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// testThing returns a thing with a writable switch and a read-only
+// temperature property
+func testThing(id string, location string) *spec.Thing {
+	return &spec.Thing{
+		ID:       id,
+		Title:    id,
+		Location: location,
+		Properties: map[string]*spec.Property{
+			"on": {
+				Type:           spec.Boolean,
+				TypeAnnotation: "OnOffProperty",
+				MQTT: spec.MQTTPropertySettings{
+					StatusTopic: "things/" + id + "/on",
+					SetTopic:    "things/" + id + "/on/set",
+				},
+			},
+			"temperature": {
+				Type:     spec.Number,
+				Readonly: true,
+				MQTT: spec.MQTTPropertySettings{
+					StatusTopic: "things/" + id + "/temperature",
+				},
+			},
+		},
+	}
+}
+
+func Test_TestServer(t *testing.T) {
+	s := newTestServer(t, &auth.Config{Tokens: testTokens})
+
+	assert.Equal(t, http.StatusUnauthorized, s.do("GET", "/api/v1/things", "", "").Code)
+	assert.Equal(t, http.StatusOK, s.do("GET", "/api/v1/things", "reader", "").Code)
+}
@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/schema"
+)
+
+// getThingSchema handles `GET /api/v1/things/:thingID/schema` and returns the
+// JSON schema of the property values of the thing
+func getThingSchema(ctx context.Context, thingID ThingID, store registry.Registry) interface{} {
+	thing, err := store.Get(ctx, string(thingID))
+	if err != nil {
+		return err
+	}
+
+	return schema.ForThing(thing)
+}
+
+// getDefinitionSchema handles `GET /api/v1/schema/thing` and returns the JSON
+// schema of thing definitions
+func getDefinitionSchema() interface{} {
+	return schema.Definition()
+}
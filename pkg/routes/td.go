@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
+	"gopkg.in/macaron.v1"
+)
+
+// clientWantsTD returns true if the client requested W3C WoT thing
+// descriptions instead of the Mozilla Web Thing format
+func clientWantsTD(m *macaron.Context) bool {
+	m.Resp.Header().Add("Vary", "Accept")
+
+	return strings.Contains(m.Req.Header.Get("Accept"), wot.MediaType)
+}
+
+// thingsURL returns the absolute URL of the things collection as seen
+// by the client
+func thingsURL(base baseurl.URL) string {
+	return string(base) + "/api/v1/things"
+}
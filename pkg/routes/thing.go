@@ -2,22 +2,56 @@ package routes
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
 	"net/http"
 
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
 	"gopkg.in/macaron.v1"
 )
 
-// getThing handles `GET /api/v1/things/:thingID` and returns the thing
-func getThing(ctx context.Context, m *macaron.Context, thingID ThingID, store registry.Registry) interface{} {
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedPatch is returned if a PATCH request uses an unsupported
+// content type
+var ErrUnsupportedPatch = errors.NewWithStatus(http.StatusUnsupportedMediaType, "unsupported patch format, use "+mergePatchContentType+" or "+jsonPatchContentType)
+
+// getThing handles `GET /api/v1/things/:thingID` and returns the thing. A W3C
+// WoT thing description is returned if requested using the Accept header. The
+// revision of the thing is returned as part of the ETag
+func getThing(ctx context.Context, m *macaron.Context, thingID ThingID, store registry.Registry, binding wot.Binding, base baseurl.URL) interface{} {
 	thing, err := store.Get(ctx, string(thingID))
 	if err != nil {
 		return err
 	}
 
-	baseURL := "/api/v1/things"
+	repr := reprDefinition
+	if clientWantsTD(m) {
+		repr = reprTD
+	}
+
+	setETag(m, thing, repr)
+	if notModified(m, thing, repr) {
+		return http.StatusNotModified
+	}
+
+	if repr == reprTD {
+		binding.Base = thingsURL(base)
+		return render.WithContentType(wot.MediaType, wot.Describe(thing, binding))
+	}
+
+	baseURL := thingsURL(base)
 	model, err := getThingModel(baseURL, thing)
 	if err != nil {
 		return err
@@ -27,11 +61,130 @@ func getThing(ctx context.Context, m *macaron.Context, thingID ThingID, store re
 }
 
 // updateThing handles `PUT /api/v1/things/:thingID` and updates the thing
-func updateThing(ctx context.Context, thingID ThingID, updated spec.Thing, store registry.Registry) interface{} {
-	if err := spec.ValidateThing(&updated); err != nil {
+func updateThing(ctx context.Context, m *macaron.Context, thingID ThingID, updated spec.Thing, store registry.Registry, a *auth.Authenticator) interface{} {
+	if err := saveThing(ctx, m, thingID, &updated, store, a); err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
+
+// patchThing handles `PATCH /api/v1/things/:thingID` and applies a JSON Merge
+// Patch (RFC 7386) or JSON Patch (RFC 6902) to the thing definition depending
+// on the request content type. It returns the updated definition
+func patchThing(ctx context.Context, m *macaron.Context, thingID ThingID, store registry.Registry, a *auth.Authenticator) interface{} {
+	thing, err := store.Get(ctx, string(thingID))
+	if err != nil {
+		return err
+	}
+
+	defer m.Req.Request.Body.Close()
+	body, err := ioutil.ReadAll(m.Req.Request.Body)
+	if err != nil {
+		return errors.WrapWithStatus(400, err)
+	}
+
+	doc, err := json.Marshal(thing)
+	if err != nil {
+		return err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(m.Req.Header.Get("Content-Type"))
+	switch contentType {
+	case mergePatchContentType:
+		doc, err = jsonpatch.MergePatch(doc, body)
+		if err != nil {
+			return errors.WrapWithStatus(400, err)
+		}
+
+	case jsonPatchContentType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return errors.WrapWithStatus(400, err)
+		}
+
+		doc, err = patch.Apply(doc)
+		if err != nil {
+			return errors.WrapWithStatus(http.StatusUnprocessableEntity, err)
+		}
+
+	default:
+		return ErrUnsupportedPatch
+	}
+
+	var updated spec.Thing
+	if err := json.Unmarshal(doc, &updated); err != nil {
+		return errors.WrapWithStatus(http.StatusUnprocessableEntity, err)
+	}
+
+	// fail if the thing has been modified while applying the patch
+	updated.Revision = thing.Revision
+
+	if err := saveThing(ctx, m, thingID, &updated, store, a); err != nil {
 		return err
 	}
 
+	return &updated
+}
+
+// putPropertyDefinition handles `PUT /api/v1/things/:thingID/properties/:propID/definition`
+// and adds or replaces the definition of a single property
+func putPropertyDefinition(ctx context.Context, m *macaron.Context, thingID ThingID, propID PropertyID, store registry.Registry, a *auth.Authenticator) (int, interface{}) {
+	var prop spec.Property
+
+	defer m.Req.Request.Body.Close()
+	if err := json.NewDecoder(m.Req.Request.Body).Decode(&prop); err != nil {
+		return render.Unspecified, errors.WrapWithStatus(400, err)
+	}
+
+	thing, err := copyThing(ctx, store, thingID)
+	if err != nil {
+		return render.Unspecified, err
+	}
+
+	code := http.StatusOK
+	if thing.Property(string(propID)) == nil {
+		code = http.StatusCreated
+	}
+
+	if thing.Properties == nil {
+		thing.Properties = make(map[string]*spec.Property)
+	}
+	thing.Properties[string(propID)] = &prop
+
+	if err := saveThing(ctx, m, thingID, thing, store, a); err != nil {
+		return render.Unspecified, err
+	}
+
+	return code, &prop
+}
+
+// deletePropertyDefinition handles `DELETE /api/v1/things/:thingID/properties/:propID/definition`
+// and removes a property from the thing
+func deletePropertyDefinition(ctx context.Context, m *macaron.Context, thingID ThingID, propID PropertyID, store registry.Registry, a *auth.Authenticator) interface{} {
+	thing, err := copyThing(ctx, store, thingID)
+	if err != nil {
+		return err
+	}
+
+	if thing.Property(string(propID)) == nil {
+		return errors.NewWithStatus(404, "unknown property: "+string(propID))
+	}
+
+	delete(thing.Properties, string(propID))
+
+	if err := saveThing(ctx, m, thingID, thing, store, a); err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
+
+// saveThing applies defaults to the updated definition of the thing thingID,
+// validates it and stores it in the registry. If updated has a revision or the
+// request has an If-Match header, the update fails if the thing has been
+// modified in between. The new revision is returned as the ETag
+func saveThing(ctx context.Context, m *macaron.Context, thingID ThingID, updated *spec.Thing, store registry.Registry, a *auth.Authenticator) error {
 	// Seems like the user want's to change the thingID, check that we don't collide
 	// with an existing one
 	if string(thingID) != updated.ID {
@@ -39,21 +192,78 @@ func updateThing(ctx context.Context, thingID ThingID, updated spec.Thing, store
 		return errors.NewWithStatus(http.StatusForbidden, "thing IDs cannot be changed")
 	}
 
-	_, err := store.Get(ctx, string(thingID))
+	if err := updated.ApplyDefaults(); err != nil {
+		return errors.WrapWithStatus(400, err)
+	}
+
+	if err := spec.ValidateThing(updated); err != nil {
+		return err
+	}
+
+	// the updated thing must still be manageable by the client
+	if err := authorizeDefinition(m, a, updated); err != nil {
+		return err
+	}
+
+	current, err := store.Get(ctx, string(thingID))
 	if err != nil {
 		return err
 	}
 
-	if err := store.Update(ctx, &updated); err != nil {
+	revision, err := checkIfMatch(m, current)
+	if err != nil {
 		return err
 	}
 
-	return http.StatusNoContent
+	if revision != 0 {
+		updated.Revision = revision
+	}
+
+	if err := store.Update(ctx, updated); err != nil {
+		return err
+	}
+
+	setETag(m, updated, reprDefinition)
+
+	return nil
+}
+
+// copyThing returns a deep copy of the thing thingID that can be modified
+// without affecting the registry. Storing the copy fails if the thing has been
+// modified in between
+func copyThing(ctx context.Context, store registry.Registry, thingID ThingID) (*spec.Thing, error) {
+	thing, err := store.Get(ctx, string(thingID))
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := json.Marshal(thing)
+	if err != nil {
+		return nil, err
+	}
+
+	var copy spec.Thing
+	if err := json.Unmarshal(blob, &copy); err != nil {
+		return nil, err
+	}
+	copy.Revision = thing.Revision
+
+	return &copy, nil
 }
 
 // deleteThing handles `DELETE /api/v1/things/:thingID` and returns the thing
-func deleteThing(ctx context.Context, thingID ThingID, store registry.Registry) interface{} {
-	if err := store.Delete(ctx, string(thingID)); err != nil {
+func deleteThing(ctx context.Context, m *macaron.Context, thingID ThingID, store registry.Registry) interface{} {
+	current, err := store.Get(ctx, string(thingID))
+	if err != nil {
+		return err
+	}
+
+	revision, err := checkIfMatch(m, current)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Delete(ctx, string(thingID), revision); err != nil {
 		return err
 	}
 
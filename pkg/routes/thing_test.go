@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PatchThing(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.create(t, testThing("lamp", "kitchen"))
+
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		title       string
+		properties  []string
+	}{
+		{
+			mergePatchContentType,
+			`{"title": "Kitchen lamp", "properties": {"temperature": null}}`,
+			http.StatusOK, "Kitchen lamp", []string{"on"},
+		},
+		{
+			jsonPatchContentType + "; charset=utf-8",
+			`[{"op": "replace", "path": "/title", "value": "Lamp"}, {"op": "add", "path": "/properties/color", "value": {"type": "string"}}]`,
+			http.StatusOK, "Lamp", []string{"color", "on"},
+		},
+		{
+			jsonPatchContentType,
+			`[{"op": "remove", "path": "/properties/unknown"}]`,
+			http.StatusUnprocessableEntity, "Lamp", []string{"color", "on"},
+		},
+		{
+			jsonPatchContentType,
+			`{"op": "remove"}`,
+			http.StatusBadRequest, "Lamp", []string{"color", "on"},
+		},
+		{
+			mergePatchContentType,
+			`{"id": "other"}`,
+			http.StatusForbidden, "Lamp", []string{"color", "on"},
+		},
+		{
+			"application/json",
+			`{"title": "Ignored"}`,
+			http.StatusUnsupportedMediaType, "Lamp", []string{"color", "on"},
+		},
+	}
+
+	for _, c := range cases {
+		rec := s.do("PATCH", "/api/v1/things/lamp", "", c.body, "Content-Type", c.contentType)
+		assert.Equal(t, c.status, rec.Code, c.body)
+
+		thing, err := s.store.Get(context.Background(), "lamp")
+		if !assert.Nil(t, err) {
+			continue
+		}
+
+		assert.Equal(t, c.title, thing.Title, c.body)
+
+		var props []string
+		for id := range thing.Properties {
+			props = append(props, id)
+		}
+		assert.ElementsMatch(t, c.properties, props, c.body)
+
+		if c.status == http.StatusOK {
+			var updated spec.Thing
+			assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &updated))
+			assert.Equal(t, c.title, updated.Title, c.body)
+			assert.Equal(t, etag(thing, reprDefinition), rec.Header().Get("ETag"), c.body)
+		}
+	}
+
+	assert.Equal(t, http.StatusNotFound, s.do("PATCH", "/api/v1/things/unknown", "", "{}", "Content-Type", mergePatchContentType).Code)
+}
+
+func Test_PropertyDefinition(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.create(t, testThing("lamp", "kitchen"))
+
+	path := "/api/v1/things/lamp/properties/color/definition"
+
+	rec := s.do("PUT", path, "", `{"type": "string", "title": "Color"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = s.do("PUT", path, "", `{"type": "string", "title": "Light color"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	thing, err := s.store.Get(context.Background(), "lamp")
+	assert.Nil(t, err)
+	if assert.NotNil(t, thing.Property("color")) {
+		assert.Equal(t, "Light color", thing.Property("color").Title)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, s.do("PUT", path, "", `{"type": `).Code)
+	assert.Equal(t, http.StatusNotFound, s.do("PUT", "/api/v1/things/unknown/properties/color/definition", "", `{"type": "string"}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", path, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("DELETE", path, "", "").Code)
+	assert.Equal(t, http.StatusNotFound, s.do("DELETE", "/api/v1/things/lamp/properties/unknown/definition", "", "").Code)
+
+	thing, err = s.store.Get(context.Background(), "lamp")
+	assert.Nil(t, err)
+	assert.Nil(t, thing.Property("color"))
+	assert.NotNil(t, thing.Property("on"))
+}
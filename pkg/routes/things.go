@@ -2,26 +2,62 @@ package routes
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/baseurl"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/registry/driver"
 	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/wot"
 	"gopkg.in/macaron.v1"
 )
 
 // getAllThings handles a `GET /api/v1/things` request and returns all
-// things registered
-func getAllThings(ctx context.Context, m *macaron.Context, store registry.Registry) interface{} {
-	things, err := store.All(ctx)
+// things registered that the client is allowed to read. The things may be
+// filtered, sorted and paginated using query parameters. If there are more
+// things, the URL of the next page is returned in the Link header
+func getAllThings(ctx context.Context, m *macaron.Context, store registry.Registry, a *auth.Authenticator, binding wot.Binding, base baseurl.URL) interface{} {
+	q, err := thingsQuery(m)
 	if err != nil {
 		return err
 	}
 
+	q.Filter = func(t *spec.Thing) bool {
+		return a.AuthorizeRequest(m, auth.OpRead, t) == nil
+	}
+
+	page, err := store.Query(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	if page.Next != "" {
+		params := m.Req.URL.Query()
+		params.Set("cursor", page.Next)
+		m.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, thingsURL(base), params.Encode()))
+	}
+
+	if clientWantsTD(m) {
+		binding.Base = thingsURL(base)
+
+		descriptions := []*wot.ThingDescription{}
+		for _, t := range page.Things {
+			descriptions = append(descriptions, wot.Describe(t, binding))
+		}
+
+		return render.WithContentType(wot.MediaType, descriptions)
+	}
+
 	var models []*thingModel
 
-	baseURL := "/api/v1/things"
-	for _, t := range things {
+	baseURL := thingsURL(base)
+	for _, t := range page.Things {
 		model, err := getThingModel(baseURL, t)
 		if err != nil {
 			return err
@@ -33,11 +69,44 @@ func getAllThings(ctx context.Context, m *macaron.Context, store registry.Regist
 	return models
 }
 
+// thingsQuery parses the query parameters of a things list request. Sort
+// orders prefixed with "-" are descending
+func thingsQuery(m *macaron.Context) (*driver.Query, error) {
+	q := &driver.Query{
+		Type:         m.Query("type"),
+		Location:     m.Query("location"),
+		Title:        m.Query("title"),
+		PropertyType: m.Query("propertyType"),
+		Sort:         strings.TrimPrefix(m.Query("sort"), "-"),
+		Descending:   strings.HasPrefix(m.Query("sort"), "-"),
+		Cursor:       m.Query("cursor"),
+	}
+
+	if limit := m.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, errors.NewWithStatus(400, "invalid limit")
+		}
+
+		q.Limit = n
+	}
+
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
 // createThing handles a `POST /api/v1/things` request and creates a new thing
-func createThing(ctx context.Context, m *macaron.Context, thing spec.Thing, store registry.Registry) (int, interface{}) {
+func createThing(ctx context.Context, m *macaron.Context, thing spec.Thing, store registry.Registry, a *auth.Authenticator) (int, interface{}) {
 	// Make sure we have default values for all important fields
 	thing.ApplyDefaults()
 
+	if err := authorizeDefinition(m, a, &thing); err != nil {
+		return render.Unspecified, err
+	}
+
 	if err := spec.ValidateThing(&thing); err != nil {
 		return render.Unspecified, err
 	}
@@ -48,3 +117,14 @@ func createThing(ctx context.Context, m *macaron.Context, thing spec.Thing, stor
 
 	return http.StatusCreated, thing
 }
+
+// authorizeDefinition checks if the client may manage the thing described
+// by the request body
+func authorizeDefinition(m *macaron.Context, a *auth.Authenticator, thing *spec.Thing) error {
+	err := a.AuthorizeRequest(m, auth.OpAdmin, thing)
+	if err != nil && err != auth.ErrUnauthenticated {
+		return auth.ErrNotPermitted
+	}
+
+	return err
+}
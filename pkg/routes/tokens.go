@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/middleware/render"
+	"gopkg.in/macaron.v1"
+)
+
+type createTokenRequest struct {
+	Name   string       `json:"name"`
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+// getTokens handles `GET /api/v1/tokens` and returns all API tokens
+func getTokens(a *auth.Authenticator) interface{} {
+	if !a.Enabled() {
+		return auth.ErrDisabled
+	}
+
+	return a.Tokens()
+}
+
+// createToken handles `POST /api/v1/tokens` and creates a new API token. The
+// secret token is only returned once
+func createToken(m *macaron.Context, a *auth.Authenticator) (int, interface{}) {
+	var req createTokenRequest
+
+	defer m.Req.Request.Body.Close()
+	if err := json.NewDecoder(m.Req.Request.Body).Decode(&req); err != nil {
+		return render.Unspecified, errors.WrapWithStatus(400, err)
+	}
+
+	if req.Name == "" {
+		return render.Unspecified, errors.NewWithStatus(400, "missing token name")
+	}
+
+	token, err := a.CreateToken(req.Name, req.Scopes)
+	if err != nil {
+		return render.Unspecified, err
+	}
+
+	return http.StatusCreated, token
+}
+
+// deleteToken handles `DELETE /api/v1/tokens/:tokenID`
+func deleteToken(m *macaron.Context, a *auth.Authenticator) interface{} {
+	if err := a.DeleteToken(m.Params("tokenID")); err != nil {
+		return err
+	}
+
+	return http.StatusNoContent
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TokenPrivileges(t *testing.T) {
+	s := newTestServer(t, &auth.Config{
+		Tokens: []auth.TokenConfig{
+			{Name: "owner", Token: "owner", Scopes: []auth.Scope{auth.ScopeAdmin}},
+			{Name: "kitchen-admin", Token: "kitchen", Scopes: []auth.Scope{auth.ScopeAdmin}},
+		},
+		Rules: []auth.Rule{
+			{Subjects: []string{"token:owner"}, Things: []string{"*"}, Operations: []auth.Operation{auth.OpAdmin}},
+			{Subjects: []string{"token:kitchen-admin"}, Locations: []string{"kitchen"}, Operations: []auth.Operation{auth.OpAdmin}},
+		},
+	})
+	s.create(t, testThing("lamp", "kitchen"), testThing("safe", "office"))
+
+	// a restricted admin must neither mint a token named after a privileged
+	// one nor manage tokens at all
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/api/v1/tokens", "kitchen", `{"name": "owner", "scopes": ["admin"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, s.do("POST", "/api/v1/tokens", "kitchen", `{"name": "other", "scopes": ["admin"]}`).Code)
+	assert.Equal(t, http.StatusForbidden, s.do("GET", "/api/v1/tokens", "kitchen", "").Code)
+
+	// names of configured and created tokens cannot be reused
+	assert.Equal(t, http.StatusConflict, s.do("POST", "/api/v1/tokens", "owner", `{"name": "owner", "scopes": ["admin"]}`).Code)
+
+	rec := s.do("POST", "/api/v1/tokens", "owner", `{"name": "backup", "scopes": ["admin"]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created auth.Token
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEqual(t, "owner", created.ID)
+	assert.NotEmpty(t, created.Token)
+
+	assert.Equal(t, http.StatusConflict, s.do("POST", "/api/v1/tokens", "owner", `{"name": "backup", "scopes": ["read"]}`).Code)
+
+	// the created token is not granted the rules of the owner
+	assert.Equal(t, http.StatusNotFound, s.do("GET", "/api/v1/things/safe", created.Token, "").Code)
+	assert.Equal(t, http.StatusForbidden, s.do("DELETE", "/api/v1/tokens/"+created.ID, "kitchen", "").Code)
+	assert.Equal(t, http.StatusNoContent, s.do("DELETE", "/api/v1/tokens/"+created.ID, "owner", "").Code)
+}
@@ -0,0 +1,173 @@
+package schema
+
+import (
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+)
+
+// DefinitionID is the $id of the thing definition schema
+const DefinitionID = "https://github.com/ppacher/webthings-mqtt-gateway/thing.schema.json"
+
+var jsonTypes = []interface{}{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// Definition returns the schema of thing definition files as loaded from
+// the things directory or sent to `POST /api/v1/things`. Status handlers
+// are described using the options of all registered handler types
+func Definition() *Schema {
+	str := func(description string) *Schema {
+		return &Schema{Type: "string", Description: description}
+	}
+	template := func(description string) *Schema {
+		return &Schema{Type: "string", Format: "go-template", Description: description}
+	}
+	stringList := &Schema{Type: "array", Items: &Schema{Type: "string"}}
+
+	return &Schema{
+		Schema: Draft,
+		ID:     DefinitionID,
+		Title:  "Thing definition",
+		Type:   "object",
+		Properties: map[string]*Schema{
+			"@context":    str("URI of a schema repository for @type annotations"),
+			"@type":       stringList,
+			"id":          str("unique identifier of the thing"),
+			"title":       str("human friendly name"),
+			"description": str("additional description"),
+			"location":    str("location of the thing"),
+			"icon":        str("data URI or URI of an icon"),
+			"properties": {
+				Type:                 "object",
+				AdditionalProperties: &Schema{Ref: "#/definitions/property"},
+			},
+			"mqtt": {Ref: "#/definitions/mqttThingSettings"},
+		},
+		Required:             []string{"id"},
+		AdditionalProperties: false,
+		Definitions: map[string]*Schema{
+			"property": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"@context":    str("URI of a schema repository for the @type annotation"),
+					"@type":       str("capability type of the property"),
+					"id":          str("identifier of the property. Defaults to its key"),
+					"title":       str("human friendly name"),
+					"description": str("additional description"),
+					"unit":        str("SI unit of the value"),
+					"type": {
+						Description: "primitive JSON type or MIME type of the value",
+						AnyOf: []*Schema{
+							{Type: "string", Enum: jsonTypes},
+							{Type: "string", Format: "mime-type"},
+						},
+					},
+					"enum":       {Type: "array"},
+					"readOnly":   {Type: "boolean"},
+					"minimum":    {Type: "number"},
+					"maximum":    {Type: "number"},
+					"multipleOf": {Type: "number"},
+					"mqtt":       {Ref: "#/definitions/mqttPropertySettings"},
+				},
+				AdditionalProperties: false,
+			},
+			"mqttThingSettings": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"connected":        template("topic the connection status of the thing is published to"),
+					"propertyDefaults": {Ref: "#/definitions/mqttPropertySettings"},
+				},
+				AdditionalProperties: false,
+			},
+			"mqttPropertySettings": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"statusTopic":   template("topic status updates are published to"),
+					"statusHandler": {Ref: "#/definitions/statusHandler"},
+					"setTopic":      template("topic set requests are published to"),
+					"setPayload":    template("payload published to the set topic"),
+					"setEncoding": {
+						Type:        "string",
+						Description: "encoding of the set payload",
+						Enum:        encodings(),
+					},
+					"coercion": {Ref: "#/definitions/coercion"},
+				},
+				AdditionalProperties: false,
+			},
+			"coercion": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"disabled":    {Type: "boolean"},
+					"trueValues":  stringList,
+					"falseValues": stringList,
+				},
+				AdditionalProperties: false,
+			},
+			"statusHandler": StatusHandler(),
+		},
+	}
+}
+
+// StatusHandler returns the schema of payload handler specifications. It
+// contains one alternative for each registered handler type
+func StatusHandler() *Schema {
+	types := payload.Types()
+
+	s := &Schema{
+		Description: "payload handler used to parse status updates",
+		OneOf:       make([]*Schema, 0, len(types)),
+	}
+
+	for _, info := range types {
+		handler := &Schema{
+			Title: string(info.Type),
+			Type:  "object",
+			Properties: map[string]*Schema{
+				"type": {Type: "string", Enum: []interface{}{string(info.Type)}},
+			},
+			Required: []string{"type"},
+		}
+
+		for _, opt := range info.Options {
+			handler.Properties[opt.Name] = FromOption(opt)
+			if opt.Required {
+				handler.Required = append(handler.Required, opt.Name)
+			}
+		}
+
+		s.OneOf = append(s.OneOf, handler)
+	}
+
+	return s
+}
+
+// FromOption returns the schema of a handler option
+func FromOption(opt payload.Option) *Schema {
+	s := &Schema{
+		Description: opt.Description,
+	}
+
+	switch len(opt.Type) {
+	case 0:
+		// any value
+	case 1:
+		s.Type = opt.Type[0]
+	default:
+		types := make([]interface{}, len(opt.Type))
+		for i, t := range opt.Type {
+			types[i] = t
+		}
+		s.Type = types
+	}
+
+	return s
+}
+
+func encodings() []interface{} {
+	names := payload.Encodings()
+
+	res := make([]interface{}, len(names))
+	for i, n := range names {
+		res[i] = n
+	}
+
+	return res
+}
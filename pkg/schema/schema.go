@@ -0,0 +1,92 @@
+// Package schema builds JSON schemas for thing properties
+package schema
+
+import (
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+// Draft is the JSON schema version of generated root schemas
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON schema. Only the keywords required by the gateway are
+// supported. It is also used as an OpenAPI 3 schema object
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MultipleOf           *float64           `json:"multipleOf,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+
+	// Unit holds the unit of numeric values
+	Unit string `json:"x-unit,omitempty"`
+}
+
+// FromProperty returns the schema of the values of prop. Properties with a
+// non-JSON type (like a MIME type) are described as binary strings
+func FromProperty(prop *spec.Property) *Schema {
+	s := &Schema{
+		Title:       prop.Title,
+		Description: prop.Description,
+		Enum:        prop.Enum,
+		ReadOnly:    prop.Readonly,
+		Unit:        prop.Unit,
+	}
+
+	switch {
+	case prop.Type == "":
+		// any value
+	case spec.IsJSONEncodableValue(prop.Type):
+		s.Type = string(prop.Type)
+	default:
+		s.Type = "string"
+		s.Format = "binary"
+	}
+
+	if prop.Type == spec.Number || prop.Type == spec.Integer {
+		s.Minimum = prop.Minimum
+		s.Maximum = prop.Maximum
+		s.MultipleOf = prop.MultipleOf
+	}
+
+	return s
+}
+
+// FromProperties returns the schema of an object holding the values of all
+// properties of t, as returned by `GET /things/:thingID/properties`
+func FromProperties(t *spec.Thing) *Schema {
+	s := &Schema{
+		Title:      t.Title,
+		Type:       "object",
+		Properties: make(map[string]*Schema, len(t.Properties)),
+	}
+
+	for id, prop := range t.Properties {
+		s.Properties[id] = FromProperty(prop)
+	}
+
+	return s
+}
+
+// ForThing returns the root schema of the property values of t. It can be
+// used by clients to validate values before setting them
+func ForThing(t *spec.Thing) *Schema {
+	s := FromProperties(t)
+	s.Schema = Draft
+	s.Description = t.Description
+
+	return s
+}
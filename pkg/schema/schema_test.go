@@ -0,0 +1,101 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+	_ "github.com/ppacher/webthings-mqtt-gateway/pkg/payload/json"
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromProperty(t *testing.T) {
+	min := 0.0
+	max := 100.0
+
+	cases := []struct {
+		p *spec.Property
+		s *Schema
+	}{
+		{
+			&spec.Property{Type: spec.Number, Unit: "percent", Minimum: &min, Maximum: &max, Readonly: true},
+			&Schema{Type: "number", Unit: "percent", Minimum: &min, Maximum: &max, ReadOnly: true},
+		},
+		{
+			&spec.Property{Type: spec.String, Enum: []interface{}{"on", "off"}, Minimum: &min},
+			&Schema{Type: "string", Enum: []interface{}{"on", "off"}},
+		},
+		{
+			&spec.Property{Type: "image/png", Title: "Snapshot"},
+			&Schema{Type: "string", Format: "binary", Title: "Snapshot"},
+		},
+		{
+			&spec.Property{},
+			&Schema{},
+		},
+	}
+
+	for idx, c := range cases {
+		assert.Equal(t, c.s, FromProperty(c.p), "case #%d", idx)
+	}
+}
+
+func Test_ForThing(t *testing.T) {
+	s := ForThing(&spec.Thing{
+		ID:          "lamp",
+		Title:       "Lamp",
+		Description: "Living room lamp",
+		Properties: map[string]*spec.Property{
+			"on": {Type: spec.Boolean},
+		},
+	})
+
+	assert.Equal(t, Draft, s.Schema)
+	assert.Equal(t, "object", s.Type)
+	assert.Equal(t, "Living room lamp", s.Description)
+	assert.Equal(t, "boolean", s.Properties["on"].Type)
+}
+
+func Test_FromOption(t *testing.T) {
+	assert.Equal(t, &Schema{Type: "string"}, FromOption(payload.Option{Type: []string{"string"}}))
+	assert.Equal(t, &Schema{Type: []interface{}{"number", "string"}}, FromOption(payload.Option{Type: []string{"number", "string"}}))
+	assert.Equal(t, &Schema{Description: "any"}, FromOption(payload.Option{Description: "any"}))
+}
+
+func Test_Definition(t *testing.T) {
+	s := Definition()
+
+	assert.Equal(t, DefinitionID, s.ID)
+	assert.Equal(t, []string{"id"}, s.Required)
+
+	for _, key := range []string{"property", "mqttThingSettings", "mqttPropertySettings", "coercion", "statusHandler"} {
+		assert.NotNil(t, s.Definitions[key], key)
+	}
+
+	var jsonHandler *Schema
+	for _, h := range s.Definitions["statusHandler"].OneOf {
+		if h.Title == "json" {
+			jsonHandler = h
+		}
+	}
+
+	if assert.NotNil(t, jsonHandler) {
+		assert.Equal(t, []interface{}{"json"}, jsonHandler.Properties["type"].Enum)
+		assert.Equal(t, "string", jsonHandler.Properties["path"].Type)
+	}
+
+	assert.Contains(t, s.Definitions["mqttPropertySettings"].Properties["setEncoding"].Enum, "json")
+
+	// the schema must use the JSON keys of the settings
+	typ := reflect.TypeOf(spec.MQTTPropertySettings{})
+	for idx := 0; idx < typ.NumField(); idx++ {
+		key := strings.Split(typ.Field(idx).Tag.Get("json"), ",")[0]
+		assert.Contains(t, s.Definitions["mqttPropertySettings"].Properties, key, typ.Field(idx).Name)
+	}
+
+	_, err := json.Marshal(s)
+	assert.Nil(t, err)
+}
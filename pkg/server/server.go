@@ -60,7 +60,8 @@ func (s *server) Listen(m http.Handler) (err error) {
 		if err != nil && added {
 			// it's very unlikely to have any listeners yet
 			fmt.Printf("error: %s\n", err.Error())
-			ctx, _ := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+			ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(1*time.Minute))
+			defer cancel()
 			s.Shutdown(ctx)
 		}
 	}()
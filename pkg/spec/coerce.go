@@ -0,0 +1,270 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Default sets of strings that are interpreted as boolean values when
+// coercing to `boolean`. Comparison is case-insensitive
+var (
+	DefaultTrueValues  = []string{"true", "on", "yes", "1"}
+	DefaultFalseValues = []string{"false", "off", "no", "0"}
+)
+
+// CoercionSettings configures how values extracted by a status handler are
+// converted to the declared type of a property
+type CoercionSettings struct {
+	// Disabled disables type coercion for the property. Values returned by
+	// the status handler are stored as they are
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	// TrueValues holds strings that should be interpreted as `true` for
+	// `boolean` properties. Defaults to DefaultTrueValues
+	TrueValues []string `json:"trueValues,omitempty" yaml:"trueValues,omitempty"`
+
+	// FalseValues holds strings that should be interpreted as `false` for
+	// `boolean` properties. Defaults to DefaultFalseValues
+	FalseValues []string `json:"falseValues,omitempty" yaml:"falseValues,omitempty"`
+}
+
+// CoercionError is returned if a value cannot be converted to the declared
+// type of a property
+type CoercionError struct {
+	ThingID    string
+	PropertyID string
+	Type       Primitive
+	Value      interface{}
+	Err        error
+}
+
+// Error implements the error interface for CoercionError
+func (c *CoercionError) Error() string {
+	return fmt.Sprintf("thing %s: property %s: cannot coerce %v (%T) to %s: %s", c.ThingID, c.PropertyID, c.Value, c.Value, c.Type, c.Err.Error())
+}
+
+// Coerce converts value to the declared type of the property. Properties
+// without a type or with a non-JSON type (like a MIME type) are returned
+// unchanged. If the value cannot be converted an error of type *CoercionError
+// is returned
+func (i *Property) Coerce(t *Thing, value interface{}) (interface{}, error) {
+	settings := i.MQTT.Coercion
+	if settings == nil {
+		settings = &CoercionSettings{}
+	}
+
+	if settings.Disabled || i.Type == "" || !IsJSONEncodableValue(i.Type) || value == nil {
+		return value, nil
+	}
+
+	res, err := coerceValue(i.Type, value, settings)
+	if err != nil {
+		thingID := ""
+		if t != nil {
+			thingID = t.ID
+		}
+
+		return nil, &CoercionError{
+			ThingID:    thingID,
+			PropertyID: i.ID,
+			Type:       i.Type,
+			Value:      value,
+			Err:        err,
+		}
+	}
+
+	return res, nil
+}
+
+func coerceValue(p Primitive, value interface{}, settings *CoercionSettings) (interface{}, error) {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+
+	switch p {
+	case Null:
+		return nil, nil
+	case Boolean:
+		return toBool(value, settings)
+	case Number:
+		return toFloat(value)
+	case Integer:
+		f, err := toFloat(value)
+		if err != nil {
+			return nil, err
+		}
+		f = math.Round(f)
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, fmt.Errorf("integer out of range")
+		}
+		return int64(f), nil
+	case String:
+		return toString(value)
+	case Object:
+		return toObject(value)
+	case Array:
+		return toArray(value)
+	}
+
+	return value, nil
+}
+
+func toBool(value interface{}, settings *CoercionSettings) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		trueValues := settings.TrueValues
+		if len(trueValues) == 0 {
+			trueValues = DefaultTrueValues
+		}
+
+		falseValues := settings.FalseValues
+		if len(falseValues) == 0 {
+			falseValues = DefaultFalseValues
+		}
+
+		s := strings.TrimSpace(v)
+		for _, t := range trueValues {
+			if strings.EqualFold(s, t) {
+				return true, nil
+			}
+		}
+
+		for _, f := range falseValues {
+			if strings.EqualFold(s, f) {
+				return false, nil
+			}
+		}
+
+		return false, fmt.Errorf("unknown boolean value %q", v)
+	}
+
+	f, err := toFloat(value)
+	if err != nil {
+		return false, err
+	}
+
+	return f != 0, nil
+}
+
+// toFloat converts value to a finite float64. NaN and infinite values are
+// rejected
+func toFloat(value interface{}) (float64, error) {
+	f, err := toAnyFloat(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("not a finite number")
+	}
+
+	return f, nil
+}
+
+func toAnyFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+
+	return 0, fmt.Errorf("not a number")
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	if f, err := toFloat(value); err == nil {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	blob, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(blob), nil
+}
+
+func toObject(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("not an object")
+	}
+
+	m := make(map[string]interface{}, rv.Len())
+	for _, key := range rv.MapKeys() {
+		m[fmt.Sprintf("%v", key.Interface())] = rv.MapIndex(key).Interface()
+	}
+
+	return m, nil
+}
+
+func toArray(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case string:
+		var a []interface{}
+		if err := json.Unmarshal([]byte(v), &a); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("not an array")
+	}
+
+	a := make([]interface{}, rv.Len())
+	for idx := range a {
+		a[idx] = rv.Index(idx).Interface()
+	}
+
+	return a, nil
+}
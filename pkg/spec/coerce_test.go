@@ -0,0 +1,68 @@
+package spec
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PropertyCoerce(t *testing.T) {
+	cases := []struct {
+		p   Primitive
+		s   *CoercionSettings
+		i   interface{}
+		o   interface{}
+		err bool
+	}{
+		{Number, nil, "21.5", 21.5, false},
+		{Number, nil, " 10 ", 10.0, false},
+		{Number, nil, true, 1.0, false},
+		{Number, nil, "foo", nil, true},
+		{Integer, nil, 1.6, int64(2), false},
+		{Integer, nil, "41.2", int64(41), false},
+		{Number, nil, math.NaN(), nil, true},
+		{Number, nil, "NaN", nil, true},
+		{Number, nil, math.Inf(-1), nil, true},
+		{Integer, nil, "+Inf", nil, true},
+		{Integer, nil, math.NaN(), nil, true},
+		{Integer, nil, 1e19, nil, true},
+		{Boolean, nil, math.NaN(), nil, true},
+		{Boolean, nil, "ON", true, false},
+		{Boolean, nil, "off", false, false},
+		{Boolean, nil, "1", true, false},
+		{Boolean, nil, 0.0, false, false},
+		{Boolean, nil, "maybe", nil, true},
+		{Boolean, &CoercionSettings{TrueValues: []string{"open"}, FalseValues: []string{"closed"}}, "OPEN", true, false},
+		{Boolean, &CoercionSettings{TrueValues: []string{"open"}}, "on", nil, true},
+		{String, nil, 12.5, "12.5", false},
+		{String, nil, []byte("foo"), "foo", false},
+		{Object, nil, `{"a": 1}`, map[string]interface{}{"a": 1.0}, false},
+		{Object, nil, map[interface{}]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}, false},
+		{Object, nil, "[1]", nil, true},
+		{Array, nil, "[1, 2]", []interface{}{1.0, 2.0}, false},
+		{Array, nil, []string{"a"}, []interface{}{"a"}, false},
+		{Array, nil, 1.0, nil, true},
+		{Number, &CoercionSettings{Disabled: true}, "21.5", "21.5", false},
+		{"image/png", nil, "raw", "raw", false},
+	}
+
+	for _, c := range cases {
+		prop := &Property{
+			ID:   "prop",
+			Type: c.p,
+			MQTT: MQTTPropertySettings{
+				Coercion: c.s,
+			},
+		}
+
+		res, err := prop.Coerce(&Thing{ID: "thing"}, c.i)
+		if c.err {
+			assert.NotNil(t, err)
+			assert.IsType(t, &CoercionError{}, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.o, res)
+		}
+	}
+}
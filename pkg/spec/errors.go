@@ -23,6 +23,9 @@ var (
 
 	// ErrInvalidPayloadHandler indicates that the payload handler configured is unknown
 	ErrInvalidPayloadHandler = errors.NewWithStatus(http.StatusBadRequest, "invalid payload handler")
+
+	// ErrInvalidSetEncoding indicates that the set payload encoding configured is unknown
+	ErrInvalidSetEncoding = errors.NewWithStatus(http.StatusBadRequest, "invalid set payload encoding")
 )
 
 // ValidationError wraps a set of error messages that were found when
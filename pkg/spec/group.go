@@ -0,0 +1,112 @@
+package spec
+
+import (
+	"net/http"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/errors"
+)
+
+// Kinds of groups
+const (
+	// GroupLocation groups things by their physical location. Locations may
+	// be nested (e.g. house, floor and room). Things are members of a
+	// location if their Location member equals the ID of the location
+	GroupLocation = "location"
+
+	// GroupGeneric is an arbitrary group of things
+	GroupGeneric = "group"
+)
+
+var (
+	// ErrMissingGroupID indicates that the group has no ID specified
+	ErrMissingGroupID = errors.NewWithStatus(http.StatusBadRequest, "group ID is missing")
+
+	// ErrInvalidGroupKind indicates that the group kind is unknown
+	ErrInvalidGroupKind = errors.NewWithStatus(http.StatusBadRequest, "invalid or unknown group kind")
+
+	// ErrInvalidGroupParent indicates that a group is its own parent
+	ErrInvalidGroupParent = errors.NewWithStatus(http.StatusBadRequest, "group cannot be its own parent")
+)
+
+// Group groups things either by location or arbitrarily. Groups may be
+// nested using Parent. Members of a group include the members of all its
+// sub-groups
+type Group struct {
+	// ID uniquely identifies the group
+	ID string `json:"id" yaml:"id"`
+
+	// Title may hold a human-friendly name of the group
+	Title string `json:"title,omitempty" yaml:"title,omitempty"`
+
+	// Description may hold an additional description of the group
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Kind is either GroupLocation or GroupGeneric and defaults to the
+	// latter
+	Kind string `json:"kind" yaml:"kind"`
+
+	// Parent may hold the ID of the parent group. Locations may only be
+	// nested in locations and groups only in groups
+	Parent string `json:"parent,omitempty" yaml:"parent,omitempty"`
+
+	// Things holds the IDs of things explicitly added to the group
+	Things []string `json:"things,omitempty" yaml:"things,omitempty"`
+
+	// Revision is incremented by the registry driver whenever the group
+	// is stored. It is not part of the definition itself
+	//
+	// @no-spec
+	Revision uint64 `json:"-" yaml:"-"`
+}
+
+// ApplyDefaults applies default values to the group
+func (g *Group) ApplyDefaults() {
+	if g.Kind == "" {
+		g.Kind = GroupGeneric
+	}
+}
+
+// HasThing returns true if the thing id has been added to the group
+func (g *Group) HasThing(id string) bool {
+	for _, t := range g.Things {
+		if t == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Contains returns true if t is a direct member of the group, either
+// because it has been added explicitly or by its location
+func (g *Group) Contains(t *Thing) bool {
+	if g.Kind == GroupLocation && t.Location == g.ID {
+		return true
+	}
+
+	return g.HasThing(t.ID)
+}
+
+// ValidateGroup validates the group definition. References to other
+// groups are validated by the registry
+func ValidateGroup(g *Group) error {
+	var err []error
+
+	if g.ID == "" {
+		err = append(err, ErrMissingGroupID)
+	}
+
+	if g.Kind != GroupLocation && g.Kind != GroupGeneric {
+		err = append(err, ErrInvalidGroupKind)
+	}
+
+	if g.Parent != "" && g.Parent == g.ID {
+		err = append(err, ErrInvalidGroupParent)
+	}
+
+	if len(err) == 0 {
+		return nil
+	}
+
+	return NewValidationError(err...)
+}
@@ -1,5 +1,7 @@
 package spec
 
+import "github.com/ppacher/webthings-mqtt-gateway/pkg/payload"
+
 const (
 	// DefaultStatusReportTopic is the default topic used when listening for
 	// item status reports
@@ -129,11 +131,29 @@ func (i *Property) ApplyDefaults(t *Thing) error {
 		}
 	}
 
+	if i.MQTT.Coercion == nil && t.MQTT.PropertyDefaults != nil {
+		i.MQTT.Coercion = t.MQTT.PropertyDefaults.Coercion
+	}
+
+	if i.MQTT.SetEncoding == "" && t.MQTT.PropertyDefaults != nil {
+		i.MQTT.SetEncoding = t.MQTT.PropertyDefaults.SetEncoding
+	}
+
 	return nil
 }
 
 // ValidateProperty validates the item and returns an error if the validation
 // failed. The error is of type *ValidationError and may be cased by err.(*spec.ValidationError)
 func ValidateProperty(i *Property) error {
-	return nil
+	var err []error
+
+	if i.MQTT.SetEncoding != "" && !payload.IsValidEncoding(i.MQTT.SetEncoding) {
+		err = append(err, ErrInvalidSetEncoding)
+	}
+
+	if len(err) == 0 {
+		return nil
+	}
+
+	return NewValidationError(err...)
 }
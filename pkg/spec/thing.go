@@ -25,7 +25,16 @@ type MQTTPropertySettings struct {
 	// SetPayload defines the payload that should be published to `SetTopic` when a thing
 	// property should be set. This memeber is always interpreted as a GoLang template string
 	// (see text/template)
-	SetPayload string
+	SetPayload string `json:"setPayload,omitempty" yaml:"setPayload,omitempty"`
+
+	// SetEncoding may hold the name of a payload encoding (like "cbor" or "msgpack").
+	// If set, the rendered `SetPayload` is decoded as JSON and re-encoded using
+	// SetEncoding before being published
+	SetEncoding string `json:"setEncoding,omitempty" yaml:"setEncoding,omitempty"`
+
+	// Coercion configures how values returned by `StatusHandler` are converted
+	// to the declared type of the property
+	Coercion *CoercionSettings `json:"coercion,omitempty" yaml:"coercion,omitempty"`
 }
 
 type MQTTThingSettings struct {
@@ -105,6 +114,13 @@ type Thing struct {
 	// MQTT defines topic and payload handlers for MQTT. A controller may use this information to
 	// to wrap a mqtt-smarthome compatible thing to WoT
 	MQTT MQTTThingSettings `json:"mqtt"`
+
+	// Revision is incremented by the registry driver whenever the thing
+	// definition is stored. It is not part of the definition itself but
+	// exposed as the ETag of the thing
+	//
+	// @no-spec
+	Revision uint64 `json:"-" yaml:"-"`
 }
 
 // ApplyDefaults adds default values to all missing thing and item fields
@@ -0,0 +1,104 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TopicPattern is an MQTT topic filter that may contain named wildcards.
+// A single-level wildcard may be named by appending the name directly to the
+// `+` (like `+sensor`) and the multi-level wildcard by appending it to `#`
+// (like `#rest`). Named wildcards are replaced by their anonymous counterparts
+// when subscribing and the matched topic levels are made available as captures.
+//
+// Example:
+//
+//		p, _ := ParseTopicPattern("tele/plug/+sensor/SENSOR")
+//		// p.Filter == "tele/plug/+/SENSOR"
+//		captures, ok := p.Match("tele/plug/AM2301/SENSOR")
+//		// ok == true, captures["sensor"] == "AM2301"
+//
+type TopicPattern struct {
+	// Filter holds the MQTT topic filter used for subscriptions
+	Filter string
+
+	levels []string
+	names  []string
+}
+
+// ParseTopicPattern parses topic as a topic pattern
+func ParseTopicPattern(topic string) (*TopicPattern, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("empty topic")
+	}
+
+	levels := strings.Split(topic, "/")
+	names := make([]string, len(levels))
+	filter := make([]string, len(levels))
+
+	for idx, level := range levels {
+		filter[idx] = level
+
+		if strings.HasPrefix(level, "+") || strings.HasPrefix(level, "#") {
+			names[idx] = level[1:]
+			filter[idx] = level[:1]
+
+			if level[0] == '#' && idx != len(levels)-1 {
+				return nil, fmt.Errorf("%s: multi-level wildcard must be the last topic level", topic)
+			}
+		}
+
+		if strings.ContainsAny(names[idx], "+#") || (names[idx] == "" && len(level) > 1 && strings.ContainsAny(level, "+#")) {
+			return nil, fmt.Errorf("%s: invalid use of wildcards in topic level %q", topic, level)
+		}
+	}
+
+	return &TopicPattern{
+		Filter: strings.Join(filter, "/"),
+		levels: filter,
+		names:  names,
+	}, nil
+}
+
+// Match checks if topic matches the pattern and returns the values of all named
+// wildcards
+func (p *TopicPattern) Match(topic string) (map[string]string, bool) {
+	levels := strings.Split(topic, "/")
+	captures := make(map[string]string)
+
+	for idx, level := range p.levels {
+		if level == "#" {
+			// `#` also matches the parent level
+			if idx > len(levels) {
+				return nil, false
+			}
+
+			if p.names[idx] != "" {
+				captures[p.names[idx]] = strings.Join(levels[idx:], "/")
+			}
+
+			return captures, true
+		}
+
+		if idx >= len(levels) {
+			return nil, false
+		}
+
+		if level == "+" {
+			if p.names[idx] != "" {
+				captures[p.names[idx]] = levels[idx]
+			}
+			continue
+		}
+
+		if level != levels[idx] {
+			return nil, false
+		}
+	}
+
+	if len(levels) != len(p.levels) {
+		return nil, false
+	}
+
+	return captures, true
+}
@@ -0,0 +1,42 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TopicPattern(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		filter   string
+		topic    string
+		match    bool
+		captures map[string]string
+	}{
+		{"tele/plug/SENSOR", "tele/plug/SENSOR", "tele/plug/SENSOR", true, map[string]string{}},
+		{"tele/plug/SENSOR", "tele/plug/SENSOR", "tele/plug/STATE", false, nil},
+		{"tele/+device/SENSOR", "tele/+/SENSOR", "tele/plug/SENSOR", true, map[string]string{"device": "plug"}},
+		{"tele/+/SENSOR", "tele/+/SENSOR", "tele/plug/SENSOR", true, map[string]string{}},
+		{"tele/+device/SENSOR", "tele/+/SENSOR", "tele/plug/sub/SENSOR", false, nil},
+		{"tele/+device/SENSOR", "tele/+/SENSOR", "tele/plug", false, nil},
+		{"tele/#rest", "tele/#", "tele/plug/SENSOR", true, map[string]string{"rest": "plug/SENSOR"}},
+		{"tele/#", "tele/#", "tele", true, map[string]string{}},
+		{"tele/+a/+b", "tele/+/+", "tele/x/y", true, map[string]string{"a": "x", "b": "y"}},
+	}
+
+	for _, c := range cases {
+		p, err := ParseTopicPattern(c.pattern)
+		assert.Nil(t, err)
+		assert.Equal(t, c.filter, p.Filter)
+
+		captures, ok := p.Match(c.topic)
+		assert.Equal(t, c.match, ok, c.pattern+" <> "+c.topic)
+		assert.Equal(t, c.captures, captures)
+	}
+
+	for _, invalid := range []string{"", "tele/#/SENSOR", "tele/pl+ug", "tele/+a+b"} {
+		_, err := ParseTopicPattern(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -0,0 +1,266 @@
+// Package wot converts thing definitions into W3C Web of Things (WoT)
+// Thing Descriptions 1.1
+//
+// @see https://www.w3.org/TR/wot-thing-description11/
+package wot
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+)
+
+const (
+	// MediaType is the media type of thing descriptions
+	MediaType = "application/td+json"
+
+	// ContextV11 is the context URI of thing descriptions 1.1
+	ContextV11 = "https://www.w3.org/2022/wot/td/v1.1"
+
+	// MQTTVocabulary is the namespace of the MQTT binding vocabulary
+	// used with the `mqv` prefix
+	MQTTVocabulary = "http://www.example.org/mqtt-binding#"
+)
+
+// ThingDescription is a WoT thing description
+type ThingDescription struct {
+	Context             []interface{}                     `json:"@context"`
+	Type                []string                          `json:"@type,omitempty"`
+	ID                  string                            `json:"id,omitempty"`
+	Title               string                            `json:"title"`
+	Description         string                            `json:"description,omitempty"`
+	Base                string                            `json:"base,omitempty"`
+	SecurityDefinitions map[string]*SecurityScheme        `json:"securityDefinitions"`
+	Security            []string                          `json:"security"`
+	Properties          map[string]*PropertyAffordance    `json:"properties"`
+	Actions             map[string]*InteractionAffordance `json:"actions"`
+	Events              map[string]*InteractionAffordance `json:"events"`
+	Links               []Link                            `json:"links,omitempty"`
+}
+
+// SecurityScheme describes how clients authenticate
+type SecurityScheme struct {
+	Scheme string `json:"scheme"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// InteractionAffordance holds the members shared by all affordances
+type InteractionAffordance struct {
+	Type        string  `json:"@type,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Forms       []*Form `json:"forms"`
+}
+
+// PropertyAffordance describes a property of a thing
+type PropertyAffordance struct {
+	InteractionAffordance
+
+	DataType   string        `json:"type,omitempty"`
+	Unit       string        `json:"unit,omitempty"`
+	Enum       []interface{} `json:"enum,omitempty"`
+	ReadOnly   bool          `json:"readOnly"`
+	Observable bool          `json:"observable"`
+	Minimum    *float64      `json:"minimum,omitempty"`
+	Maximum    *float64      `json:"maximum,omitempty"`
+	MultipleOf *float64      `json:"multipleOf,omitempty"`
+}
+
+// Form describes how an operation is performed
+type Form struct {
+	Href        string      `json:"href"`
+	Op          interface{} `json:"op,omitempty"`
+	ContentType string      `json:"contentType,omitempty"`
+
+	// HTTP binding
+	Method string `json:"htv:methodName,omitempty"`
+
+	// MQTT binding
+	Topic         string `json:"mqv:topic,omitempty"`
+	Filter        string `json:"mqv:filter,omitempty"`
+	ControlPacket string `json:"mqv:controlPacket,omitempty"`
+}
+
+// Link is a web link
+type Link struct {
+	Href string `json:"href"`
+	Rel  string `json:"rel,omitempty"`
+}
+
+// Binding holds the information required to describe how things are
+// accessed
+type Binding struct {
+	// Base is the URL of the things collection of the REST API
+	// (like http://gateway:8080/api/v1/things)
+	Base string
+
+	// Broker is the URL of the MQTT broker. If empty, no MQTT forms
+	// are added
+	Broker string
+
+	// Bearer should be set if the REST API requires bearer tokens
+	Bearer bool
+}
+
+// Describe returns the thing description of t
+func Describe(t *spec.Thing, b Binding) *ThingDescription {
+	base := strings.TrimSuffix(b.Base, "/") + "/" + url.PathEscape(t.ID) + "/"
+
+	td := &ThingDescription{
+		Context: []interface{}{
+			ContextV11,
+			map[string]string{"mqv": MQTTVocabulary},
+		},
+		Type:        t.TypeAnnotation,
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Base:        base,
+		Properties:  make(map[string]*PropertyAffordance, len(t.Properties)),
+		Actions:     map[string]*InteractionAffordance{},
+		Events:      map[string]*InteractionAffordance{},
+	}
+
+	if t.ContextAnnotation != "" {
+		td.Context = append(td.Context, t.ContextAnnotation)
+	}
+
+	if !isURI(td.ID) {
+		td.ID = strings.TrimSuffix(base, "/")
+	}
+
+	if td.Title == "" {
+		td.Title = t.ID
+	}
+
+	if b.Bearer {
+		td.SecurityDefinitions = map[string]*SecurityScheme{
+			"bearer_sc": {Scheme: "bearer", In: "header", Name: "Authorization"},
+		}
+		td.Security = []string{"bearer_sc"}
+	} else {
+		td.SecurityDefinitions = map[string]*SecurityScheme{
+			"nosec_sc": {Scheme: "nosec"},
+		}
+		td.Security = []string{"nosec_sc"}
+	}
+
+	if t.Icon != "" {
+		td.Links = append(td.Links, Link{Href: t.Icon, Rel: "icon"})
+	}
+
+	for id, prop := range t.Properties {
+		td.Properties[id] = describeProperty(t, id, prop, b)
+	}
+
+	return td
+}
+
+// describeProperty returns the affordance of prop including forms for
+// the REST API and the MQTT topics of the property
+func describeProperty(t *spec.Thing, id string, prop *spec.Property, b Binding) *PropertyAffordance {
+	affordance := &PropertyAffordance{
+		InteractionAffordance: InteractionAffordance{
+			Type:        prop.TypeAnnotation,
+			Title:       prop.Title,
+			Description: prop.Description,
+		},
+		Unit:       prop.Unit,
+		Enum:       prop.Enum,
+		ReadOnly:   prop.Readonly,
+		Observable: prop.MQTT.StatusTopic != "",
+	}
+
+	contentType := "application/json"
+	switch {
+	case prop.Type == "":
+	case spec.IsJSONEncodableValue(prop.Type):
+		affordance.DataType = string(prop.Type)
+	default:
+		contentType = string(prop.Type)
+	}
+
+	if prop.Type == spec.Number || prop.Type == spec.Integer {
+		affordance.Minimum = prop.Minimum
+		affordance.Maximum = prop.Maximum
+		affordance.MultipleOf = prop.MultipleOf
+	}
+
+	href := "properties/" + url.PathEscape(id)
+	affordance.Forms = append(affordance.Forms, &Form{
+		Href:        href,
+		Op:          "readproperty",
+		ContentType: contentType,
+	})
+
+	if !prop.Readonly {
+		affordance.Forms = append(affordance.Forms, &Form{
+			Href:        href,
+			Op:          "writeproperty",
+			ContentType: contentType,
+			Method:      "POST",
+		})
+	}
+
+	if b.Broker == "" {
+		return affordance
+	}
+
+	if topic, err := spec.TopicFromTemplate(prop.MQTT.StatusTopic, t, prop); err == nil && topic != "" {
+		if pattern, err := spec.ParseTopicPattern(topic); err == nil {
+			affordance.Forms = append(affordance.Forms, &Form{
+				Href:          b.Broker,
+				Op:            "observeproperty",
+				Filter:        pattern.Filter,
+				ControlPacket: "subscribe",
+			})
+		}
+	}
+
+	if !prop.Readonly {
+		// set topics that depend on the value cannot be described
+		topic, err := spec.TopicFromTemplate(prop.MQTT.SetTopic, t, prop)
+		if err == nil && topic != "" && !strings.Contains(topic, "<no value>") {
+			affordance.Forms = append(affordance.Forms, &Form{
+				Href:          b.Broker,
+				Op:            "writeproperty",
+				Topic:         topic,
+				ControlPacket: "publish",
+			})
+		}
+	}
+
+	return affordance
+}
+
+// BrokerURL converts the address of an MQTT broker as used by the MQTT
+// client (like tcp://broker:1883) into an mqtt:// or mqtts:// URL
+func BrokerURL(broker string) string {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt", "":
+		u.Scheme = "mqtt"
+	case "ssl", "tls", "tcps", "mqtts":
+		u.Scheme = "mqtts"
+	default:
+		return ""
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+// isURI returns true if id is an absolute URI like "urn:dev:ops:lamp" or
+// "https://example.com/lamp" and can be used as the ID of a thing
+// description as is
+func isURI(id string) bool {
+	u, err := url.Parse(id)
+	return err == nil && u.Scheme != ""
+}
@@ -0,0 +1,105 @@
+package wot
+
+import (
+	"testing"
+
+	"github.com/ppacher/webthings-mqtt-gateway/pkg/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_BrokerURL(t *testing.T) {
+	cases := map[string]string{
+		"tcp://broker:1883":      "mqtt://broker:1883",
+		"ssl://broker:8883":      "mqtts://broker:8883",
+		"tcp://user:pw@broker:1": "mqtt://broker:1",
+		"ws://broker:80":         "",
+		"broker":                 "",
+	}
+
+	for i, o := range cases {
+		assert.Equal(t, o, BrokerURL(i), i)
+	}
+}
+
+func Test_Describe(t *testing.T) {
+	thing := &spec.Thing{
+		ContextAnnotation: "https://iot.mozilla.org/schemas/",
+		TypeAnnotation:    []string{"OnOffSwitch"},
+		ID:                "lamp",
+		Properties: map[string]*spec.Property{
+			"on": {
+				ID:             "on",
+				TypeAnnotation: "OnOffProperty",
+				Type:           spec.Boolean,
+			},
+			"power": {
+				ID:       "power",
+				Type:     spec.Number,
+				Unit:     "watt",
+				Readonly: true,
+			},
+			"brightness": {
+				ID:   "brightness",
+				Type: spec.Integer,
+				MQTT: spec.MQTTPropertySettings{
+					SetTopic: "lamp/brightness/{{.value}}",
+				},
+			},
+		},
+	}
+	thing.ApplyDefaults()
+
+	td := Describe(thing, Binding{
+		Base:   "http://gateway:8080/api/v1/things",
+		Broker: "mqtt://broker:1883",
+		Bearer: true,
+	})
+
+	assert.Equal(t, []interface{}{ContextV11, map[string]string{"mqv": MQTTVocabulary}, "https://iot.mozilla.org/schemas/"}, td.Context)
+	assert.Equal(t, "http://gateway:8080/api/v1/things/lamp", td.ID)
+	assert.Equal(t, "http://gateway:8080/api/v1/things/lamp/", td.Base)
+	assert.Equal(t, "lamp", td.Title)
+	assert.Equal(t, []string{"bearer_sc"}, td.Security)
+	assert.Equal(t, "bearer", td.SecurityDefinitions["bearer_sc"].Scheme)
+	assert.NotNil(t, td.Actions)
+	assert.NotNil(t, td.Events)
+
+	on := td.Properties["on"]
+	assert.Equal(t, "boolean", on.DataType)
+	assert.Equal(t, "OnOffProperty", on.Type)
+	assert.True(t, on.Observable)
+	assert.Equal(t, []*Form{
+		{Href: "properties/on", Op: "readproperty", ContentType: "application/json"},
+		{Href: "properties/on", Op: "writeproperty", ContentType: "application/json", Method: "POST"},
+		{Href: "mqtt://broker:1883", Op: "observeproperty", Filter: "lamp/status/on", ControlPacket: "subscribe"},
+		{Href: "mqtt://broker:1883", Op: "writeproperty", Topic: "lamp/set/on", ControlPacket: "publish"},
+	}, on.Forms)
+
+	power := td.Properties["power"]
+	assert.True(t, power.ReadOnly)
+	assert.Len(t, power.Forms, 2)
+
+	// the set topic depends on the value and cannot be described
+	assert.Len(t, td.Properties["brightness"].Forms, 3)
+
+	td = Describe(thing, Binding{Base: "http://gateway/api/v1/things"})
+	assert.Equal(t, []string{"nosec_sc"}, td.Security)
+	assert.Len(t, td.Properties["on"].Forms, 2)
+}
+
+func Test_DescribeID(t *testing.T) {
+	cases := []struct {
+		id string
+		td string
+	}{
+		{"lamp", "http://gateway/api/v1/things/lamp"},
+		{"living room", "http://gateway/api/v1/things/living%20room"},
+		{"urn:dev:ops:32473-lamp", "urn:dev:ops:32473-lamp"},
+		{"https://example.com/things/lamp", "https://example.com/things/lamp"},
+	}
+
+	for _, c := range cases {
+		td := Describe(&spec.Thing{ID: c.id}, Binding{Base: "http://gateway/api/v1/things"})
+		assert.Equal(t, c.td, td.ID, c.id)
+	}
+}